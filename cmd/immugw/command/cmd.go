@@ -17,17 +17,18 @@ limitations under the License.
 package immugw
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/codenotary/immudb/cmd/docs/man"
 	c "github.com/codenotary/immudb/cmd/helper"
 	"github.com/codenotary/immudb/cmd/version"
 	"github.com/codenotary/immudb/embedded/logger"
 	"github.com/codenotary/immudb/pkg/client"
-	"github.com/codenotary/immudb/pkg/client/homedir"
-	"github.com/codenotary/immudb/pkg/client/tokenservice"
 	"github.com/codenotary/immugw/cmd/immugw/command/service"
 	"github.com/codenotary/immugw/pkg/gw"
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	daem "github.com/takama/daemon"
@@ -61,6 +62,8 @@ Environment variables:
   IMMUGW_DIR=.
   IMMUGW_PIDFILE=
   IMMUGW_LOGFILE=
+  IMMUGW_LOG_LEVEL=
+  IMMUGW_CONFIG_WATCH=false
   IMMUGW_DETACHED=false
   IMMUGW_MTLS=false
   IMMUGW_SERVERNAME=localhost
@@ -69,6 +72,49 @@ Environment variables:
   IMMUGW_AUDIT_USERNAME=immugwauditor
   IMMUGW_AUDIT_PASSWORD=
   IMMUGW_AUDIT_SIGNATURE=ignore
+  IMMUGW_AUDIT_DATABASES=
+  IMMUGW_AUDIT_NOTIFICATION_URLS=
+  IMMUGW_AUDIT_NOTIFICATION_SECRET=
+  IMMUGW_AUDIT_NOTIFICATION_RETRIES=10
+  IMMUGW_AUDIT_NOTIFICATION_RETRY_INTERVAL=30s
+  IMMUGW_AUDIT_SERVER_SIGNING_PUBKEY=
+  IMMUGW_AUDIT_RUN_TOKEN=
+  IMMUGW_SERVER_SIGNING_PUBKEY=
+  IMMUGW_TLS_CERTIFICATE=
+  IMMUGW_TLS_KEY=
+  IMMUGW_TLS_MIN_VERSION=1.2
+  IMMUGW_TLS_CLIENT_CAS=
+  IMMUGW_SHUTDOWN_TIMEOUT=30s
+  IMMUGW_LIVENESS_CHECKS=
+  IMMUGW_READINESS_CHECKS=immudb,clients,state-dirs,audit
+  IMMUGW_TRACING_EXPORTER=
+  IMMUGW_TRACING_ENDPOINT=localhost:4317
+  IMMUGW_TRACING_INSECURE=false
+  IMMUGW_TRACING_FILE=
+  IMMUGW_TRACING_SAMPLE_RATIO=1
+  IMMUGW_ACCESS_LOG=false
+  IMMUGW_ACCESS_LOG_FILE=
+  IMMUGW_API_KEYS_FILE=
+  IMMUGW_JWT_JWKS=
+  IMMUGW_JWT_ISSUER=
+  IMMUGW_JWT_AUDIENCE=
+  IMMUGW_JWT_MAPPING_FILE=
+  IMMUGW_POLICY_FILE=
+  IMMUGW_POLICY_DRY_RUN=false
+  IMMUGW_RATE_LIMITS_FILE=
+  IMMUGW_CORS_ALLOWED_ORIGINS=*
+  IMMUGW_CORS_ALLOWED_METHODS=GET,POST,HEAD
+  IMMUGW_CORS_ALLOWED_HEADERS=Origin,Accept,Content-Type,X-Requested-With
+  IMMUGW_CORS_EXPOSED_HEADERS=
+  IMMUGW_CORS_ALLOW_CREDENTIALS=false
+  IMMUGW_CORS_MAX_AGE=0s
+  IMMUGW_MAX_READ_BODY_SIZE=1048576
+  IMMUGW_MAX_WRITE_BODY_SIZE=33554432
+  IMMUGW_MAX_ADMIN_BODY_SIZE=1048576
+  IMMUGW_MAX_STREAM_SIZE=1073741824
+  IMMUGW_STRICT_JSON=false
+  IMMUGW_CLIENT_IDLE_TIMEOUT=15m
+  IMMUGW_MAX_USER_CLIENTS=1000
   IMMUGW_PKEY=./tools/mtls/4_client/private/localhost.key.pem
   IMMUGW_CERTIFICATE=./tools/mtls/4_client/certs/localhost.cert.pem
   IMMUGW_CLIENTCAS=./tools/mtls/2_intermediate/certs/ca-chain.cert.pem`,
@@ -101,8 +147,6 @@ func (cl *Commandline) Immugw(immugwServer gw.ImmuGw) func(*cobra.Command, []str
 			return err
 		}
 
-		options = options.WithTokenService(tokenservice.NewFileTokenService().WithHds(homedir.NewHomedirService()))
-
 		cliOpts := client.DefaultOptions().
 			WithDir(options.Dir).
 			WithPort(options.ImmudbPort).
@@ -110,24 +154,32 @@ func (cl *Commandline) Immugw(immugwServer gw.ImmuGw) func(*cobra.Command, []str
 			WithHealthCheckRetries(1).
 			WithMTLs(options.MTLs).
 			WithMTLsOptions(options.MTLsOptions).
+			WithServerSigningPubKey(options.ServerSigningPubKey).
 			WithMaxRecvMsgSize(4 * 1024 * 1024).
 			WithAuth(true).
 			WithConfig("")
 
 		immuGwServer := immugwServer.WithOptions(options).WithCliOptions(*cliOpts)
 
-		if options.Logfile != "" {
-			if flogger, file, err := logger.NewFileLogger("immugw ", options.Logfile); err == nil {
-				defer func() {
-					if err = file.Close(); err != nil {
-						c.QuitToStdErr(err)
-					}
-				}()
-				immuGwServer.WithLogger(flogger)
-			} else {
-				return err
+		// the server owns the logger, and replaces it when the log settings
+		// are reloaded
+		flogger, err := gw.NewLogger(options)
+		if err != nil {
+			return err
+		}
+		immuGwServer.WithLogger(flogger).WithOptionsLoader(func() (gw.Options, error) {
+			return reloadOptions(cmd)
+		})
+		if options.ConfigWatch {
+			// the startup logger is closed when the log settings are
+			// reloaded, the logger of the server is not
+			var l logger.Logger = flogger
+			if s, ok := immuGwServer.(*gw.ImmuGwServer); ok {
+				l = s.Logger
 			}
+			watchConfig(immuGwServer, l)
 		}
+
 		plauncher := c.NewPlauncher()
 		if options.Detached {
 			if err := plauncher.Detached(); err == nil {
@@ -150,6 +202,31 @@ func (cl *Commandline) Immugw(immugwServer gw.ImmuGw) func(*cobra.Command, []str
 	}
 }
 
+// reloadOptions reads the configuration file again and parses the options
+func reloadOptions(cmd *cobra.Command) (gw.Options, error) {
+	if viper.ConfigFileUsed() != "" {
+		if err := viper.ReadInConfig(); err != nil {
+			return gw.Options{}, err
+		}
+	}
+	return parseOptions(cmd)
+}
+
+// watchConfig reloads the configuration when the configuration file changes
+func watchConfig(immuGwServer gw.ImmuGw, l logger.Logger) {
+	if viper.ConfigFileUsed() == "" {
+		l.Warningf("config-watch is enabled but no configuration file is used")
+		return
+	}
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		l.Infof("configuration file %s changed, reloading configuration ...", e.Name)
+		if err := immuGwServer.Reload(); err != nil {
+			l.Errorf("configuration reload: %s", err)
+		}
+	})
+	viper.WatchConfig()
+}
+
 func parseOptions(cmd *cobra.Command) (options gw.Options, err error) {
 	dir, err := c.ResolvePath(viper.GetString("dir"), true)
 	if err != nil {
@@ -164,6 +241,91 @@ func parseOptions(cmd *cobra.Command) (options gw.Options, err error) {
 	auditUsername := viper.GetString("audit-username")
 	auditPassword := viper.GetString("audit-password")
 	auditSignature := viper.GetString("audit-signature")
+	auditDatabases := splitList(viper.GetStringSlice("audit-databases"))
+	auditNotificationURLs := splitList(viper.GetStringSlice("audit-notification-urls"))
+	auditNotificationSecret := viper.GetString("audit-notification-secret")
+	auditNotificationRetries := viper.GetInt("audit-notification-retries")
+	auditNotificationRetryInterval := viper.GetDuration("audit-notification-retry-interval")
+	auditRunToken := viper.GetString("audit-run-token")
+	auditServerSigningPubKey, err := c.ResolvePath(viper.GetString("audit-server-signing-pubkey"), true)
+	if err != nil {
+		return options, err
+	}
+	serverSigningPubKey, err := c.ResolvePath(viper.GetString("server-signing-pubkey"), true)
+	if err != nil {
+		return options, err
+	}
+	tlsCertificate, err := c.ResolvePath(viper.GetString("tls-certificate"), true)
+	if err != nil {
+		return options, err
+	}
+	tlsKey, err := c.ResolvePath(viper.GetString("tls-key"), true)
+	if err != nil {
+		return options, err
+	}
+	tlsMinVersion := viper.GetString("tls-min-version")
+	shutdownTimeout := viper.GetDuration("shutdown-timeout")
+	livenessChecks := splitList(viper.GetStringSlice("liveness-checks"))
+	readinessChecks := splitList(viper.GetStringSlice("readiness-checks"))
+	tracingExporter := viper.GetString("tracing-exporter")
+	tracingEndpoint := viper.GetString("tracing-endpoint")
+	tracingInsecure := viper.GetBool("tracing-insecure")
+	tracingFile, err := c.ResolvePath(viper.GetString("tracing-file"), true)
+	if err != nil {
+		return options, err
+	}
+	tracingSampleRatio := viper.GetFloat64("tracing-sample-ratio")
+	accessLog := viper.GetBool("access-log")
+	accessLogFile, err := c.ResolvePath(viper.GetString("access-log-file"), true)
+	if err != nil {
+		return options, err
+	}
+	apiKeysFile, err := c.ResolvePath(viper.GetString("api-keys-file"), true)
+	if err != nil {
+		return options, err
+	}
+	jwtJWKS := viper.GetString("jwt-jwks")
+	if !strings.HasPrefix(jwtJWKS, "http://") && !strings.HasPrefix(jwtJWKS, "https://") {
+		if jwtJWKS, err = c.ResolvePath(jwtJWKS, true); err != nil {
+			return options, err
+		}
+	}
+	jwtIssuer := viper.GetString("jwt-issuer")
+	jwtAudience := viper.GetString("jwt-audience")
+	jwtMappingFile, err := c.ResolvePath(viper.GetString("jwt-mapping-file"), true)
+	if err != nil {
+		return options, err
+	}
+	policyFile, err := c.ResolvePath(viper.GetString("policy-file"), true)
+	if err != nil {
+		return options, err
+	}
+	policyDryRun := viper.GetBool("policy-dry-run")
+	rateLimitsFile, err := c.ResolvePath(viper.GetString("rate-limits-file"), true)
+	if err != nil {
+		return options, err
+	}
+	corsAllowedOrigins := splitList(viper.GetStringSlice("cors-allowed-origins"))
+	corsAllowedMethods := splitList(viper.GetStringSlice("cors-allowed-methods"))
+	corsAllowedHeaders := splitList(viper.GetStringSlice("cors-allowed-headers"))
+	corsExposedHeaders := splitList(viper.GetStringSlice("cors-exposed-headers"))
+	corsAllowCredentials := viper.GetBool("cors-allow-credentials")
+	corsMaxAge := viper.GetDuration("cors-max-age")
+	var corsRoutes []gw.CORSRoute
+	if err := viper.UnmarshalKey("cors-routes", &corsRoutes); err != nil {
+		return options, fmt.Errorf("invalid cors-routes: %w", err)
+	}
+	maxReadBodySize := viper.GetInt64("max-read-body-size")
+	maxWriteBodySize := viper.GetInt64("max-write-body-size")
+	maxAdminBodySize := viper.GetInt64("max-admin-body-size")
+	maxStreamSize := viper.GetInt64("max-stream-size")
+	strictJSON := viper.GetBool("strict-json")
+	clientIdleTimeout := viper.GetDuration("client-idle-timeout")
+	maxUserClients := viper.GetInt("max-user-clients")
+	tlsClientCAs, err := c.ResolvePath(viper.GetString("tls-client-cas"), true)
+	if err != nil {
+		return options, err
+	}
 	pidfile, err := c.ResolvePath(viper.GetString("pidfile"), true)
 	if err != nil {
 		return options, err
@@ -172,6 +334,8 @@ func parseOptions(cmd *cobra.Command) (options gw.Options, err error) {
 	if err != nil {
 		return options, err
 	}
+	logLevel := viper.GetString("log-level")
+	configWatch := viper.GetBool("config-watch")
 	mtls := viper.GetBool("mtls")
 	detached := viper.GetBool("detached")
 	servername := viper.GetString("servername")
@@ -199,8 +363,54 @@ func parseOptions(cmd *cobra.Command) (options gw.Options, err error) {
 		WithAuditUsername(auditUsername).
 		WithAuditPassword(auditPassword).
 		WithAuditSignature(auditSignature).
+		WithAuditDatabases(auditDatabases).
+		WithAuditNotificationURLs(auditNotificationURLs).
+		WithAuditNotificationSecret(auditNotificationSecret).
+		WithAuditNotificationRetries(auditNotificationRetries).
+		WithAuditNotificationRetryInterval(auditNotificationRetryInterval).
+		WithAuditServerSigningPubKey(auditServerSigningPubKey).
+		WithAuditRunToken(auditRunToken).
+		WithServerSigningPubKey(serverSigningPubKey).
+		WithTLSCertificate(tlsCertificate).
+		WithTLSKey(tlsKey).
+		WithTLSMinVersion(tlsMinVersion).
+		WithTLSClientCAs(tlsClientCAs).
+		WithShutdownTimeout(shutdownTimeout).
+		WithLivenessChecks(livenessChecks).
+		WithReadinessChecks(readinessChecks).
+		WithTracingExporter(tracingExporter).
+		WithTracingEndpoint(tracingEndpoint).
+		WithTracingInsecure(tracingInsecure).
+		WithTracingFile(tracingFile).
+		WithTracingSampleRatio(tracingSampleRatio).
+		WithAccessLog(accessLog).
+		WithAccessLogFile(accessLogFile).
+		WithAPIKeysFile(apiKeysFile).
+		WithJWTJWKS(jwtJWKS).
+		WithJWTIssuer(jwtIssuer).
+		WithJWTAudience(jwtAudience).
+		WithJWTMappingFile(jwtMappingFile).
+		WithPolicyFile(policyFile).
+		WithPolicyDryRun(policyDryRun).
+		WithRateLimitsFile(rateLimitsFile).
+		WithCORSAllowedOrigins(corsAllowedOrigins).
+		WithCORSAllowedMethods(corsAllowedMethods).
+		WithCORSAllowedHeaders(corsAllowedHeaders).
+		WithCORSExposedHeaders(corsExposedHeaders).
+		WithCORSAllowCredentials(corsAllowCredentials).
+		WithCORSMaxAge(corsMaxAge).
+		WithCORSRoutes(corsRoutes).
+		WithMaxReadBodySize(maxReadBodySize).
+		WithMaxWriteBodySize(maxWriteBodySize).
+		WithMaxAdminBodySize(maxAdminBodySize).
+		WithMaxStreamSize(maxStreamSize).
+		WithStrictJSON(strictJSON).
+		WithClientIdleTimeout(clientIdleTimeout).
+		WithMaxUserClients(maxUserClients).
 		WithPidfile(pidfile).
 		WithLogfile(logfile).
+		WithLogLevel(logLevel).
+		WithConfigWatch(configWatch).
 		WithMTLs(mtls).
 		WithDetached(detached)
 	if mtls {
@@ -226,8 +436,53 @@ func (cl *Commandline) setupFlags(cmd *cobra.Command, options gw.Options, mtlsOp
 	cmd.Flags().String("audit-username", options.AuditUsername, "immudb username used to login during audit")
 	cmd.Flags().String("audit-password", options.AuditPassword, "immudb password used to login during audit; can be plain-text or base64 encoded (must be prefixed with 'enc:' if it is encoded)")
 	cmd.Flags().String("audit-signature", "", "audit signature mode. ignore|validate. If 'ignore' is set auditor doesn't check for the root server signature. If 'validate' is set auditor verify that the root is signed properly by immudb server. Default value is 'ignore'")
+	cmd.Flags().StringSlice("audit-databases", options.AuditDatabases, "comma separated list of databases to audit. All the databases the audit user has access to are audited if empty")
+	cmd.Flags().StringSlice("audit-notification-urls", options.AuditNotificationURLs, "comma separated list of webhook URLs the auditor posts a notification to when it detects a tampered database")
+	cmd.Flags().String("audit-notification-secret", options.AuditNotificationSecret, "secret the audit notifications are signed with (HMAC-SHA256 in the X-Immugw-Signature header). Required when audit-notification-urls is set")
+	cmd.Flags().Int("audit-notification-retries", options.AuditNotificationRetries, "maximum number of delivery attempts of an audit notification")
+	cmd.Flags().Duration("audit-notification-retry-interval", options.AuditNotificationRetryInterval, "interval before retrying to deliver an audit notification, doubled at every failed attempt")
+	cmd.Flags().String("audit-server-signing-pubkey", options.AuditServerSigningPubKey, "path to the public key immudb signs its states with. Required when audit-signature is set to 'validate'")
+	cmd.Flags().String("audit-run-token", options.AuditRunToken, "bearer token required to run an audit on demand with POST /audit/run on the metrics server. The endpoint is disabled if empty")
+	cmd.Flags().String("server-signing-pubkey", options.ServerSigningPubKey, "path to the public key immudb signs its states with. If set, verified endpoints reject states not signed with it")
+	cmd.Flags().String("tls-certificate", options.TLSCertificate, "certificate file path of the REST API listener. The REST API is served over TLS if set")
+	cmd.Flags().String("tls-key", options.TLSKey, "private key file path of the REST API listener")
+	cmd.Flags().String("tls-min-version", options.TLSMinVersion, "minimum TLS version accepted by the REST API listener. 1.0|1.1|1.2|1.3")
+	cmd.Flags().String("tls-client-cas", options.TLSClientCAs, "CA bundle file path the REST API listener verifies client certificates against. Client certificates are required if set")
+	cmd.Flags().Duration("shutdown-timeout", options.ShutdownTimeout, "maximum time to wait for in-flight requests to complete on shutdown")
+	cmd.Flags().StringSlice("liveness-checks", options.LivenessChecks, "comma separated list of the checks of the /livez endpoint of the metrics server. immudb|clients|state-dirs|audit")
+	cmd.Flags().StringSlice("readiness-checks", options.ReadinessChecks, "comma separated list of the checks of the /readyz endpoint of the metrics server. immudb|clients|state-dirs|audit")
+	cmd.Flags().String("tracing-exporter", options.TracingExporter, "exporter of the traces of the REST requests. otlp|stdout|file. Tracing is disabled if empty")
+	cmd.Flags().String("tracing-endpoint", options.TracingEndpoint, "OTLP gRPC endpoint the traces are exported to with the otlp exporter")
+	cmd.Flags().Bool("tracing-insecure", options.TracingInsecure, "export the traces to the OTLP endpoint without TLS")
+	cmd.Flags().String("tracing-file", options.TracingFile, "file path the traces are appended to with the file exporter")
+	cmd.Flags().Float64("tracing-sample-ratio", options.TracingSampleRatio, "ratio of the traces sampled, from 0 to 1. Requests carrying a trace context follow the sampling decision of the caller")
+	cmd.Flags().Bool("access-log", options.AccessLog, "write a JSON line for every REST request to the access log")
+	cmd.Flags().String("access-log-file", options.AccessLogFile, "access log path with filename. The access log is written to the standard output if empty")
+	cmd.Flags().String("api-keys-file", options.APIKeysFile, "path of the JSON file of the API keys the REST requests can be authenticated with ('Authorization: ApiKey <key>'). API keys are disabled if empty")
+	cmd.Flags().String("jwt-jwks", options.JWTJWKS, "file path or http(s) URL of the JWKS the JWT bearer tokens of the REST requests are verified with. JWT authentication is disabled if empty")
+	cmd.Flags().String("jwt-issuer", options.JWTIssuer, "issuer the JWT bearer tokens must be issued by. Required when jwt-jwks is set")
+	cmd.Flags().String("jwt-audience", options.JWTAudience, "audience the JWT bearer tokens must be issued for. The audience is not checked if empty")
+	cmd.Flags().String("jwt-mapping-file", options.JWTMappingFile, "path of the JSON file mapping the claims of the JWT bearer tokens to immudb users. Required when jwt-jwks is set")
+	cmd.Flags().String("policy-file", options.PolicyFile, "path of the YAML, TOML or JSON route policy file allowing or denying the REST routes. Every route is allowed if empty")
+	cmd.Flags().Bool("policy-dry-run", options.PolicyDryRun, "log the decisions of the route policy without enforcing them")
+	cmd.Flags().String("rate-limits-file", options.RateLimitsFile, "path of the YAML, TOML or JSON file of the rate limits and in flight quotas of the REST callers. No request is limited if empty")
+	cmd.Flags().StringSlice("cors-allowed-origins", options.CORSAllowedOrigins, "comma separated list of the origins allowed to make cross-origin REST requests, an origin can have one wildcard, e.g. https://*.example.com")
+	cmd.Flags().StringSlice("cors-allowed-methods", options.CORSAllowedMethods, "comma separated list of the methods allowed in cross-origin REST requests")
+	cmd.Flags().StringSlice("cors-allowed-headers", options.CORSAllowedHeaders, "comma separated list of the headers allowed in cross-origin REST requests, e.g. Authorization")
+	cmd.Flags().StringSlice("cors-exposed-headers", options.CORSExposedHeaders, "comma separated list of the response headers exposed to cross-origin REST requests, e.g. X-Request-Id")
+	cmd.Flags().Bool("cors-allow-credentials", options.CORSAllowCredentials, "allow cross-origin REST requests with credentials. Not allowed when every origin is allowed")
+	cmd.Flags().Duration("cors-max-age", options.CORSMaxAge, "time the browsers can cache the result of a CORS preflight request. Not cached if 0")
+	cmd.Flags().Int64("max-read-body-size", options.MaxReadBodySize, "maximum size in bytes of the bodies of the read REST routes, larger ones are rejected with the 413 status. Unlimited if 0")
+	cmd.Flags().Int64("max-write-body-size", options.MaxWriteBodySize, "maximum size in bytes of the bodies of the write REST routes. Unlimited if 0")
+	cmd.Flags().Int64("max-admin-body-size", options.MaxAdminBodySize, "maximum size in bytes of the bodies of the administrative REST routes. Unlimited if 0")
+	cmd.Flags().Int64("max-stream-size", options.MaxStreamSize, "maximum size in bytes of the values uploaded to the stream REST routes, which are not buffered. Unlimited if 0")
+	cmd.Flags().Bool("strict-json", options.StrictJSON, "reject the JSON request bodies with unknown fields or data after the JSON value")
+	cmd.Flags().Duration("client-idle-timeout", options.ClientIdleTimeout, "time after which the immudb clients of the users not sending requests are disconnected. Idle clients are never disconnected if 0")
+	cmd.Flags().Int("max-user-clients", options.MaxUserClients, "maximum number of immudb clients of the users, the least recently used idle ones being disconnected to connect new ones. Unlimited if 0")
 	cmd.Flags().String("pidfile", options.Pidfile, "pid path with filename. E.g. /var/run/immugw.pid")
 	cmd.Flags().String("logfile", options.Logfile, "log path with filename. E.g. /tmp/immugw/immugw.log")
+	cmd.Flags().String("log-level", options.LogLevel, "log level. debug|info|warn|error. The LOG_LEVEL environment variable is used if empty")
+	cmd.Flags().Bool("config-watch", options.ConfigWatch, "reload the configuration when the configuration file changes. The configuration is also reloaded on SIGHUP")
 	cmd.Flags().BoolP("mtls", "m", options.MTLs, "enable mutual tls")
 	cmd.Flags().BoolP(c.DetachedFlag, c.DetachedShortFlag, options.Detached, "run immudb in background")
 	cmd.Flags().String("servername", mtlsOptions.Servername, "used to verify the hostname on the returned certificates")
@@ -247,11 +502,70 @@ func setupDefaults(options gw.Options, mtlsOptions client.MTLsOptions) {
 	viper.SetDefault("audit-username", options.AuditUsername)
 	viper.SetDefault("audit-password", options.AuditPassword)
 	viper.SetDefault("audit-signature", options.AuditSignature)
+	viper.SetDefault("audit-databases", options.AuditDatabases)
+	viper.SetDefault("audit-notification-urls", options.AuditNotificationURLs)
+	viper.SetDefault("audit-notification-secret", options.AuditNotificationSecret)
+	viper.SetDefault("audit-notification-retries", options.AuditNotificationRetries)
+	viper.SetDefault("audit-notification-retry-interval", options.AuditNotificationRetryInterval)
+	viper.SetDefault("audit-server-signing-pubkey", options.AuditServerSigningPubKey)
+	viper.SetDefault("audit-run-token", options.AuditRunToken)
+	viper.SetDefault("server-signing-pubkey", options.ServerSigningPubKey)
+	viper.SetDefault("tls-certificate", options.TLSCertificate)
+	viper.SetDefault("tls-key", options.TLSKey)
+	viper.SetDefault("tls-min-version", options.TLSMinVersion)
+	viper.SetDefault("tls-client-cas", options.TLSClientCAs)
+	viper.SetDefault("shutdown-timeout", options.ShutdownTimeout)
+	viper.SetDefault("liveness-checks", options.LivenessChecks)
+	viper.SetDefault("readiness-checks", options.ReadinessChecks)
+	viper.SetDefault("tracing-exporter", options.TracingExporter)
+	viper.SetDefault("tracing-endpoint", options.TracingEndpoint)
+	viper.SetDefault("tracing-insecure", options.TracingInsecure)
+	viper.SetDefault("tracing-file", options.TracingFile)
+	viper.SetDefault("tracing-sample-ratio", options.TracingSampleRatio)
+	viper.SetDefault("access-log", options.AccessLog)
+	viper.SetDefault("access-log-file", options.AccessLogFile)
+	viper.SetDefault("api-keys-file", options.APIKeysFile)
+	viper.SetDefault("jwt-jwks", options.JWTJWKS)
+	viper.SetDefault("jwt-issuer", options.JWTIssuer)
+	viper.SetDefault("jwt-audience", options.JWTAudience)
+	viper.SetDefault("jwt-mapping-file", options.JWTMappingFile)
+	viper.SetDefault("policy-file", options.PolicyFile)
+	viper.SetDefault("policy-dry-run", options.PolicyDryRun)
+	viper.SetDefault("rate-limits-file", options.RateLimitsFile)
+	viper.SetDefault("cors-allowed-origins", options.CORSAllowedOrigins)
+	viper.SetDefault("cors-allowed-methods", options.CORSAllowedMethods)
+	viper.SetDefault("cors-allowed-headers", options.CORSAllowedHeaders)
+	viper.SetDefault("cors-exposed-headers", options.CORSExposedHeaders)
+	viper.SetDefault("cors-allow-credentials", options.CORSAllowCredentials)
+	viper.SetDefault("cors-max-age", options.CORSMaxAge)
+	viper.SetDefault("max-read-body-size", options.MaxReadBodySize)
+	viper.SetDefault("max-write-body-size", options.MaxWriteBodySize)
+	viper.SetDefault("max-admin-body-size", options.MaxAdminBodySize)
+	viper.SetDefault("max-stream-size", options.MaxStreamSize)
+	viper.SetDefault("strict-json", options.StrictJSON)
+	viper.SetDefault("client-idle-timeout", options.ClientIdleTimeout)
+	viper.SetDefault("max-user-clients", options.MaxUserClients)
 	viper.SetDefault("pidfile", options.Pidfile)
 	viper.SetDefault("logfile", options.Logfile)
+	viper.SetDefault("log-level", options.LogLevel)
+	viper.SetDefault("config-watch", options.ConfigWatch)
 	viper.SetDefault("mtls", options.MTLs)
 	viper.SetDefault("detached", options.Detached)
 	viper.SetDefault("certificate", mtlsOptions.Certificate)
 	viper.SetDefault("pkey", mtlsOptions.Pkey)
 	viper.SetDefault("clientcas", mtlsOptions.ClientCAs)
 }
+
+// splitList splits comma separated values, as the ones coming from
+// environment variables, dropping the empty ones
+func splitList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
@@ -19,7 +19,9 @@ package immugw
 import (
 	"github.com/codenotary/immudb/cmd/helper"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/codenotary/immudb/cmd/version"
 	"github.com/codenotary/immugw/pkg/gw"
@@ -43,3 +45,44 @@ func TestNewCmd(t *testing.T) {
 	require.NoError(t, err)
 	require.NoError(t, cmd.Execute())
 }
+
+func TestSplitList(t *testing.T) {
+	require.Nil(t, splitList(nil))
+	require.Equal(t, []string{"db1", "db2", "db3"}, splitList([]string{"db1, db2", "", "db3,"}))
+}
+
+func TestParseCORSRoutes(t *testing.T) {
+	cl := Commandline{config: helper.Config{Name: "immugw"}}
+	cmd, err := cl.NewCmd(new(gw.ImmuGwServerMock))
+	require.NoError(t, err)
+
+	viper.SetConfigType("toml")
+	require.NoError(t, viper.ReadConfig(strings.NewReader(`
+cors-allowed-origins = ["https://*.example.com"]
+cors-max-age = "10m"
+
+[[cors-routes]]
+prefix = "/db/*/delete"
+allowed-origins = ["https://admin.example.com"]
+allow-credentials = true
+max-age = "1m"
+
+[[cors-routes]]
+prefix = "/user"
+allowed-origins = []
+`)))
+	defer viper.Reset()
+
+	options, err := parseOptions(cmd)
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://*.example.com"}, options.CORSAllowedOrigins)
+	require.Equal(t, 10*time.Minute, options.CORSMaxAge)
+	require.Len(t, options.CORSRoutes, 2)
+	require.Equal(t, "/db/*/delete", options.CORSRoutes[0].Prefix)
+	require.Equal(t, []string{"https://admin.example.com"}, options.CORSRoutes[0].AllowedOrigins)
+	require.True(t, *options.CORSRoutes[0].AllowCredentials)
+	require.Equal(t, time.Minute, options.CORSRoutes[0].MaxAge)
+	require.Nil(t, options.CORSRoutes[0].AllowedMethods)
+	require.NotNil(t, options.CORSRoutes[1].AllowedOrigins)
+	require.Empty(t, options.CORSRoutes[1].AllowedOrigins)
+}
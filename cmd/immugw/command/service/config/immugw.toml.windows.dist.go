@@ -25,6 +25,10 @@ immudb-address = "127.0.0.1"
 immudb-port = 3322
 pidfile = "%programdata%\\Immugw\\config\\immugw.pid"
 logfile = "%programdata%\\Immugw\\config\\immugw.log"
+# debug, info, warn or error, the LOG_LEVEL environment variable is used if empty
+log-level = ""
+# reload the configuration when this file changes, it is also reloaded on SIGHUP
+config-watch = false
 mtls = false
 detached = false
 servername = "localhost"
@@ -36,4 +40,73 @@ audit = false
 audit-interval = "5m"
 audit-username = "immugwauditor"
 # password can be plaintext or base64
-audit-password = ""`)
+audit-password = ""
+# databases to audit, all the databases the audit user has access to are audited if empty
+audit-databases = []
+# webhook URLs notified when the auditor detects a tampered database
+audit-notification-urls = []
+# secret the audit notifications are signed with
+audit-notification-secret = ""
+audit-notification-retries = 10
+audit-notification-retry-interval = "30s"
+# path to the immudb signing public key, required when audit-signature is "validate"
+audit-server-signing-pubkey = ""
+# bearer token required by POST /audit/run, the endpoint is disabled if empty
+audit-run-token = ""
+# path to the immudb signing public key, verified endpoints reject states not signed with it
+server-signing-pubkey = ""
+# REST API listener TLS, the REST API is served in cleartext if tls-certificate is empty
+tls-certificate = ""
+tls-key = ""
+tls-min-version = "1.2"
+# client certificates are required and verified against this CA bundle if set
+tls-client-cas = ""
+# maximum time to wait for in-flight requests to complete on shutdown
+shutdown-timeout = "30s"
+# checks of the /livez and /readyz endpoints of the metrics server: immudb, clients, state-dirs and audit
+liveness-checks = []
+readiness-checks = ["immudb", "clients", "state-dirs", "audit"]
+# exporter of the traces of the REST requests: otlp, stdout or file. Tracing is disabled if empty
+tracing-exporter = ""
+tracing-endpoint = "localhost:4317"
+tracing-insecure = false
+tracing-file = ""
+# ratio of the traces sampled, from 0 to 1
+tracing-sample-ratio = 1.0
+# JSON access log of the REST requests, written to the standard output unless a file is set
+access-log = false
+access-log-file = ""
+# JSON file of the API keys the REST requests can be authenticated with. API keys are disabled if empty
+api-keys-file = ""
+# JWKS file or http(s) URL the JWT bearer tokens are verified with. JWT authentication is disabled if empty
+jwt-jwks = ""
+jwt-issuer = ""
+# the audience is not checked if empty
+jwt-audience = ""
+# JSON file mapping the claims of the JWT bearer tokens to immudb users
+jwt-mapping-file = ""
+# YAML, TOML or JSON route policy file, reloaded with the configuration. Every route is allowed if empty
+policy-file = ""
+# log the decisions of the route policy without enforcing them
+policy-dry-run = false
+# YAML, TOML or JSON file of the rate limits of the REST callers, reloaded with the configuration. No request is limited if empty
+rate-limits-file = ""
+# CORS policy of the REST API, origins can have one wildcard, e.g. "https://*.example.com"
+cors-allowed-origins = ["*"]
+cors-allowed-methods = ["GET", "POST", "HEAD"]
+cors-allowed-headers = ["Origin", "Accept", "Content-Type", "X-Requested-With"]
+cors-exposed-headers = []
+cors-allow-credentials = false
+cors-max-age = "0s"
+# maximum size in bytes of the bodies of the read, write and administrative REST routes, unlimited if 0
+max-read-body-size = 1048576
+max-write-body-size = 33554432
+max-admin-body-size = 1048576
+# maximum size in bytes of the values uploaded to the stream REST routes, unlimited if 0
+max-stream-size = 1073741824
+# reject the JSON request bodies with unknown fields or trailing data
+strict-json = false
+# time after which the immudb clients of the users not sending requests are disconnected
+client-idle-timeout = "15m"
+# maximum number of immudb clients of the users, unlimited if 0
+max-user-clients = 1000`)
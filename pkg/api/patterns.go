@@ -133,6 +133,107 @@ func Pattern_ImmuService_VerifiableSQLGet_0() runtime.Pattern {
 	)
 }
 
+// Pattern_ImmuService_VerifiedScan_0 exposes the runtime Pattern for the verified scan request
+func Pattern_ImmuService_VerifiedScan_0() runtime.Pattern {
+	return runtime.MustPattern(runtime.NewPattern(
+		1,
+		[]int{
+			int(utilities.OpLitPush), 0,
+			int(utilities.OpPush), 0,
+			int(utilities.OpConcatN), 1,
+			int(utilities.OpCapture), 1,
+			int(utilities.OpLitPush), 2,
+			int(utilities.OpLitPush), 3,
+		},
+		[]string{"db", "databaseName", "verified", "scan"},
+		"",
+		runtime.AssumeColonVerbOpt(true)),
+	)
+}
+
+// Pattern_ImmuService_VerifiedHistory_0 exposes the runtime Pattern for the verified history request
+func Pattern_ImmuService_VerifiedHistory_0() runtime.Pattern {
+	return runtime.MustPattern(runtime.NewPattern(
+		1,
+		[]int{
+			int(utilities.OpLitPush), 0,
+			int(utilities.OpPush), 0,
+			int(utilities.OpConcatN), 1,
+			int(utilities.OpCapture), 1,
+			int(utilities.OpLitPush), 2,
+			int(utilities.OpLitPush), 3,
+		},
+		[]string{"db", "databaseName", "verified", "history"},
+		"",
+		runtime.AssumeColonVerbOpt(true)),
+	)
+}
+
+// Pattern_ImmuService_StreamSet_0 exposes the runtime Pattern for the stream set request, the key being the rest of the path
+func Pattern_ImmuService_StreamSet_0() runtime.Pattern {
+	return runtime.MustPattern(runtime.NewPattern(
+		1,
+		[]int{
+			int(utilities.OpLitPush), 0,
+			int(utilities.OpPush), 0,
+			int(utilities.OpConcatN), 1,
+			int(utilities.OpCapture), 1,
+			int(utilities.OpLitPush), 2,
+			int(utilities.OpLitPush), 3,
+			int(utilities.OpPushM), 0,
+			int(utilities.OpConcatN), 1,
+			int(utilities.OpCapture), 4,
+		},
+		[]string{"db", "databaseName", "stream", "set", "key"},
+		"",
+		runtime.AssumeColonVerbOpt(true)),
+	)
+}
+
+// Pattern_ImmuService_StreamVerifiedSet_0 exposes the runtime Pattern for the stream verified set request, the key being the rest of the path
+func Pattern_ImmuService_StreamVerifiedSet_0() runtime.Pattern {
+	return runtime.MustPattern(runtime.NewPattern(
+		1,
+		[]int{
+			int(utilities.OpLitPush), 0,
+			int(utilities.OpPush), 0,
+			int(utilities.OpConcatN), 1,
+			int(utilities.OpCapture), 1,
+			int(utilities.OpLitPush), 2,
+			int(utilities.OpLitPush), 3,
+			int(utilities.OpLitPush), 4,
+			int(utilities.OpPushM), 0,
+			int(utilities.OpConcatN), 1,
+			int(utilities.OpCapture), 5,
+		},
+		[]string{"db", "databaseName", "stream", "verified", "set", "key"},
+		"",
+		runtime.AssumeColonVerbOpt(true)),
+	)
+}
+
+// Pattern_ImmuService_StreamVerifiedGet_0 exposes the runtime Pattern for the stream verified get request, the key being the rest of the path
+func Pattern_ImmuService_StreamVerifiedGet_0() runtime.Pattern {
+	return runtime.MustPattern(runtime.NewPattern(
+		1,
+		[]int{
+			int(utilities.OpLitPush), 0,
+			int(utilities.OpPush), 0,
+			int(utilities.OpConcatN), 1,
+			int(utilities.OpCapture), 1,
+			int(utilities.OpLitPush), 2,
+			int(utilities.OpLitPush), 3,
+			int(utilities.OpLitPush), 4,
+			int(utilities.OpPushM), 0,
+			int(utilities.OpConcatN), 1,
+			int(utilities.OpCapture), 5,
+		},
+		[]string{"db", "databaseName", "stream", "verified", "get", "key"},
+		"",
+		runtime.AssumeColonVerbOpt(true)),
+	)
+}
+
 // default handlers
 
 var (
@@ -210,6 +210,49 @@ func TestCommonPatterns(t *testing.T) {
 			path:    "db/testdb/count/prefix/1/abc",
 			wantErr: true,
 		},
+		{
+			pattern: Pattern_ImmuService_VerifiedScan_0(),
+			path:    "db/testdb/verified/scan",
+			want: map[string]string{
+				"databaseName": "testdb",
+			},
+		},
+		{
+			pattern: Pattern_ImmuService_VerifiedHistory_0(),
+			path:    "db/testdb/verified/history",
+			want: map[string]string{
+				"databaseName": "testdb",
+			},
+		},
+		{
+			pattern: Pattern_ImmuService_StreamSet_0(),
+			path:    "db/testdb/stream/set/docs/report.pdf",
+			want: map[string]string{
+				"databaseName": "testdb",
+				"key":          "docs/report.pdf",
+			},
+		},
+		{
+			pattern: Pattern_ImmuService_StreamVerifiedSet_0(),
+			path:    "db/testdb/stream/verified/set/key1",
+			want: map[string]string{
+				"databaseName": "testdb",
+				"key":          "key1",
+			},
+		},
+		{
+			pattern: Pattern_ImmuService_StreamVerifiedGet_0(),
+			path:    "db/testdb/stream/verified/get/docs/report.pdf",
+			want: map[string]string{
+				"databaseName": "testdb",
+				"key":          "docs/report.pdf",
+			},
+		},
+		{
+			pattern: Pattern_ImmuService_StreamVerifiedGet_0(),
+			path:    "db/testdb/stream/get/key1",
+			wantErr: true,
+		},
 	} {
 		pat := spec.pattern
 		components, verb := segments(spec.path)
@@ -18,10 +18,16 @@ package client
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/codenotary/immudb/embedded/logger"
 	immuclient "github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/client/cache"
+	"github.com/codenotary/immudb/pkg/client/state"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -29,6 +35,9 @@ import (
 var (
 	// ErrDatabaseNotFound is returned when a database is not found
 	ErrDatabaseNotFound = status.Error(codes.NotFound, "database is not initialised")
+	// ErrTooManyUsers is returned when the maximum number of clients of the
+	// users is reached and all of them are in use
+	ErrTooManyUsers = status.Error(codes.ResourceExhausted, "too many user clients")
 )
 
 // New returns a new Client using the Options to connect to immudb.
@@ -38,19 +47,51 @@ func New(options *immuclient.Options) Client {
 	return newClient(options)
 }
 
+// StateServiceWrapper wraps the state service of the client of database db
+type StateServiceWrapper func(db string, s state.StateService) state.StateService
+
+// NewWithStateServiceWrapper returns a new Client like New, whose clients
+// keep their state through the state service returned by wrap
+func NewWithStateServiceWrapper(options *immuclient.Options, wrap StateServiceWrapper) Client {
+	c := newClient(options)
+	c.wrapStateService = wrap
+	return c
+}
+
 // newClient returns a new Client for defaultdb to the immudb server
 func newClient(opts *immuclient.Options) *client {
 	return &client{
 		opts:  opts,
 		dbMap: make(map[string]immuclient.ImmuClient),
+		users: make(map[userDB]*userClient),
 	}
 }
 
 // client implementa Client interface
 type client struct {
-	mu    sync.RWMutex
-	opts  *immuclient.Options
-	dbMap map[string]immuclient.ImmuClient
+	mu               sync.RWMutex
+	opts             *immuclient.Options
+	dbMap            map[string]immuclient.ImmuClient
+	wrapStateService StateServiceWrapper
+
+	// users are the clients of the users, every one keeping its own token,
+	// up to maxUsers if not 0
+	users    map[userDB]*userClient
+	maxUsers int
+	// shared makes every user share the client of the database, for mocks
+	shared bool
+}
+
+type userDB struct {
+	user string
+	db   string
+}
+
+type userClient struct {
+	cli      immuclient.ImmuClient
+	lastUsed time.Time
+	// inUse is the number of requests the client is serving
+	inUse int
 }
 
 // Add adds a new database to the client
@@ -63,22 +104,59 @@ func (c *client) Add(db string) (immuclient.ImmuClient, error) {
 		return cli, nil
 	}
 
-	// create state dir for db
+	cli, err := c.connect(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// add client to map
+	c.dbMap[db] = cli
+	return cli, nil
+}
+
+// connect returns a new client for database db. Every client keeps its token
+// in memory and its state in the state dir of db, the server signing public
+// key (if any) is inherited so that every verified call checks the state
+// signature.
+func (c *client) connect(db string) (immuclient.ImmuClient, error) {
 	opts := *c.opts
 	dir := filepath.Join(opts.Dir, fmt.Sprintf("state-%s", db))
 	opts.WithDir(dir).WithDatabase(db)
 
-	// create new client
 	cli, err := immuclient.NewImmuClient(&opts)
 	if err != nil {
 		return nil, err
 	}
 
-	// add client to map
-	c.dbMap[db] = cli
+	if c.wrapStateService != nil {
+		ss, err := newStateService(cli, &opts)
+		if err != nil {
+			return nil, err
+		}
+		cli.WithStateService(c.wrapStateService(db, ss))
+	}
 	return cli, nil
 }
 
+// newStateService returns a state service set up like the one created by
+// immuclient.NewImmuClient, which the client doesn't give access to
+func newStateService(cli immuclient.ImmuClient, opts *immuclient.Options) (state.StateService, error) {
+	serviceClient := cli.GetServiceClient()
+	ss, err := state.NewStateService(
+		cache.NewFileCache(opts.Dir),
+		logger.NewSimpleLogger("immuclient", os.Stderr),
+		state.NewStateProvider(serviceClient),
+		state.NewUUIDProvider(serviceClient),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.DisableIdentityCheck {
+		ss.SetServerIdentity(opts.Bind())
+	}
+	return ss, nil
+}
+
 // For returns the client connection for database db
 func (c *client) For(db string) (immuclient.ImmuClient, error) {
 	c.mu.RLock()
@@ -92,6 +170,167 @@ func (c *client) For(db string) (immuclient.ImmuClient, error) {
 	return v, nil
 }
 
+// ForUser returns the client of user for database db, connecting it on first
+// use. The database must have been added. The client is in use until the
+// returned function is called, the clients in use are never evicted. When
+// the maximum number of clients is reached, the least recently used one is
+// evicted to make room for a new one.
+func (c *client) ForUser(user string, db string) (immuclient.ImmuClient, func(), error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	shared, ok := c.dbMap[db]
+	if !ok {
+		return nil, nil, ErrDatabaseNotFound
+	}
+	if c.shared {
+		return shared, func() {}, nil
+	}
+
+	k := userDB{user: user, db: db}
+	uc, ok := c.users[k]
+	if !ok {
+		if c.maxUsers > 0 && len(c.users) >= c.maxUsers && !c.evictLeastRecentlyUsed() {
+			return nil, nil, ErrTooManyUsers
+		}
+		cli, err := c.connect(db)
+		if err != nil {
+			return nil, nil, err
+		}
+		uc = &userClient{cli: cli}
+		c.users[k] = uc
+	}
+	uc.lastUsed = time.Now()
+	uc.inUse++
+
+	var once sync.Once
+	return uc.cli, func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			uc.inUse--
+			uc.lastUsed = time.Now()
+		})
+	}, nil
+}
+
+// evictLeastRecentlyUsed disconnects and removes the least recently used
+// client of the users not in use, reporting whether there was one
+func (c *client) evictLeastRecentlyUsed() bool {
+	var lru *userDB
+	for k, uc := range c.users {
+		if uc.inUse > 0 {
+			continue
+		}
+		if lru == nil || uc.lastUsed.Before(c.users[*lru].lastUsed) {
+			k := k
+			lru = &k
+		}
+	}
+	if lru == nil {
+		return false
+	}
+	disconnect(c.users[*lru].cli)
+	delete(c.users, *lru)
+	return true
+}
+
+// WithMaxUsers sets the maximum number of clients of the users, unlimited if
+// 0. The clients above the maximum are evicted as new ones are needed.
+func (c *client) WithMaxUsers(max int) Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxUsers = max
+	return c
+}
+
+// Logout disconnects the clients of user and removes them, the first
+// disconnection error is returned
+func (c *client) Logout(user string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for k, uc := range c.users {
+		if k.user != user {
+			continue
+		}
+		if err := disconnect(uc.cli); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("unable to disconnect client of user %s on database %s: %w", user, k.db, err)
+		}
+		delete(c.users, k)
+	}
+	return firstErr
+}
+
+// EvictIdle disconnects and removes the clients of the users not used for
+// longer than idle, returning the number of clients evicted. The clients in
+// use are not idle, however long their requests.
+func (c *client) EvictIdle(idle time.Duration) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	evicted := 0
+	for k, uc := range c.users {
+		if uc.inUse > 0 || time.Since(uc.lastUsed) <= idle {
+			continue
+		}
+		disconnect(uc.cli)
+		delete(c.users, k)
+		evicted++
+	}
+	return evicted
+}
+
+// Users returns the number of clients of the users
+func (c *client) Users() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.users)
+}
+
+// Databases returns the databases a client has been added for, sorted by name
+func (c *client) Databases() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	dbs := make([]string, 0, len(c.dbMap))
+	for db := range c.dbMap {
+		dbs = append(dbs, db)
+	}
+	sort.Strings(dbs)
+	return dbs
+}
+
+// Close disconnects the clients of every database and user and removes them,
+// the first disconnection error is returned
+func (c *client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for k, uc := range c.users {
+		if err := disconnect(uc.cli); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("unable to disconnect client of user %s on database %s: %w", k.user, k.db, err)
+		}
+		delete(c.users, k)
+	}
+	for db, cli := range c.dbMap {
+		if err := disconnect(cli); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("unable to disconnect client of database %s: %w", db, err)
+		}
+		delete(c.dbMap, db)
+	}
+	return firstErr
+}
+
+func disconnect(cli immuclient.ImmuClient) error {
+	if !cli.IsConnected() {
+		return nil
+	}
+	return cli.Disconnect()
+}
+
 // NewMockClient returns a mock Client for defaultdb to the immudb server
 func NewMockClient(cli immuclient.ImmuClient, opts *immuclient.Options) Client {
 	return &client{
@@ -99,6 +338,7 @@ func NewMockClient(cli immuclient.ImmuClient, opts *immuclient.Options) Client {
 		dbMap: map[string]immuclient.ImmuClient{
 			"defaultdb": cli,
 		},
+		shared: true,
 	}
 }
 
@@ -109,5 +349,6 @@ func NewMockClientWithDb(cli immuclient.ImmuClient, opts *immuclient.Options, db
 		dbMap: map[string]immuclient.ImmuClient{
 			db: cli,
 		},
+		shared: true,
 	}
 }
@@ -23,9 +23,11 @@ import (
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/codenotary/immudb/pkg/api/schema"
 	immuclient "github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/client/state"
 	"github.com/codenotary/immudb/pkg/server"
 	"github.com/codenotary/immudb/pkg/server/servertest"
 	"github.com/stretchr/testify/require"
@@ -88,6 +90,7 @@ func Test_client_add(t *testing.T) {
 		require.NoError(t, err)
 	}
 	require.Equal(t, len(cli.(*client).dbMap), len(dbs))
+	require.Equal(t, []string{"bazdb", "foodb"}, cli.Databases())
 
 	// check if getting a db works
 	for _, db := range dbs {
@@ -197,3 +200,169 @@ func Test_client_mocks(t *testing.T) {
 	c = NewMockClientWithDb(nil, immuclient.DefaultOptions(), "bazdb")
 	require.Nil(t, c.(*client).dbMap["bazdb"])
 }
+
+func Test_client_close(t *testing.T) {
+	cli := newTestClient(t, nil)
+
+	dbs := []string{"foodb", "bazdb"}
+	var clients []immuclient.ImmuClient
+	for _, db := range dbs {
+		c, err := cli.Add(db)
+		require.NoError(t, err)
+		require.True(t, c.IsConnected())
+		clients = append(clients, c)
+	}
+
+	require.NoError(t, cli.Close())
+	require.Empty(t, cli.(*client).dbMap)
+	for _, c := range clients {
+		require.False(t, c.IsConnected())
+	}
+
+	_, err := cli.For("foodb")
+	require.ErrorIs(t, err, ErrDatabaseNotFound)
+
+	// closing an already closed client is a no-op
+	require.NoError(t, cli.Close())
+}
+
+type countingStateService struct {
+	state.StateService
+	db       string
+	sets     int
+	lastSeen uint64
+}
+
+func (s *countingStateService) SetState(db string, st *schema.ImmutableState) error {
+	s.sets++
+	s.lastSeen = st.TxId
+	return s.StateService.SetState(db, st)
+}
+
+func Test_client_state_service_wrapper(t *testing.T) {
+	cli := newTestClient(t, nil)
+
+	var wrapped *countingStateService
+	cli.(*client).wrapStateService = func(db string, s state.StateService) state.StateService {
+		wrapped = &countingStateService{StateService: s, db: db}
+		return wrapped
+	}
+
+	c, err := cli.Add("defaultdb")
+	require.NoError(t, err)
+	require.NotNil(t, wrapped)
+	require.Equal(t, "defaultdb", wrapped.db)
+
+	lr, err := c.Login(context.Background(), []byte("immudb"), []byte("immudb"))
+	require.NoError(t, err)
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", lr.Token))
+
+	hdr, err := c.VerifiedSet(ctx, []byte("key"), []byte("value"))
+	require.NoError(t, err)
+	require.Equal(t, 1, wrapped.sets)
+	require.Equal(t, hdr.Id, wrapped.lastSeen)
+}
+
+func Test_client_for_user(t *testing.T) {
+	cli := newTestClient(t, nil)
+
+	_, _, err := cli.ForUser("alice", "defaultdb")
+	require.ErrorIs(t, err, ErrDatabaseNotFound)
+
+	shared, err := cli.Add("defaultdb")
+	require.NoError(t, err)
+
+	alice, release, err := cli.ForUser("alice", "defaultdb")
+	require.NoError(t, err)
+	release()
+	require.NotSame(t, shared, alice)
+	require.Equal(t, shared.GetOptions().Dir, alice.GetOptions().Dir)
+
+	again, release, err := cli.ForUser("alice", "defaultdb")
+	require.NoError(t, err)
+	release()
+	require.Same(t, alice, again)
+
+	bob, releaseBob, err := cli.ForUser("bob", "defaultdb")
+	require.NoError(t, err)
+	require.NotSame(t, alice, bob)
+	require.Equal(t, 2, cli.Users())
+
+	// the users keep their own token
+	lr, err := alice.Login(context.Background(), []byte("immudb"), []byte("immudb"))
+	require.NoError(t, err)
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", lr.Token))
+	_, err = alice.UseDatabase(ctx, &schema.Database{DatabaseName: "defaultdb"})
+	require.NoError(t, err)
+	_, err = alice.CurrentState(context.Background())
+	require.NoError(t, err)
+	_, err = bob.CurrentState(context.Background())
+	require.Error(t, err)
+
+	require.NoError(t, cli.Logout("alice"))
+	require.False(t, alice.IsConnected())
+	require.True(t, bob.IsConnected())
+	require.Equal(t, 1, cli.Users())
+
+	// the clients in use are never idle
+	cli.(*client).users[userDB{user: "bob", db: "defaultdb"}].lastUsed = time.Now().Add(-2 * time.Hour)
+	require.Equal(t, 0, cli.EvictIdle(time.Hour))
+	require.True(t, bob.IsConnected())
+
+	releaseBob()
+	releaseBob()
+	require.Equal(t, 0, cli.EvictIdle(time.Hour))
+	cli.(*client).users[userDB{user: "bob", db: "defaultdb"}].lastUsed = time.Now().Add(-2 * time.Hour)
+	require.Equal(t, 1, cli.EvictIdle(time.Hour))
+	require.False(t, bob.IsConnected())
+	require.Equal(t, 0, cli.Users())
+
+	carol, _, err := cli.ForUser("carol", "defaultdb")
+	require.NoError(t, err)
+	require.NoError(t, cli.Close())
+	require.False(t, carol.IsConnected())
+	require.Equal(t, 0, cli.Users())
+}
+
+func Test_client_max_users(t *testing.T) {
+	cli := newTestClient(t, nil).WithMaxUsers(2)
+	_, err := cli.Add("defaultdb")
+	require.NoError(t, err)
+
+	alice, releaseAlice, err := cli.ForUser("alice", "defaultdb")
+	require.NoError(t, err)
+	bob, releaseBob, err := cli.ForUser("bob", "defaultdb")
+	require.NoError(t, err)
+
+	// all the clients are in use
+	_, _, err = cli.ForUser("carol", "defaultdb")
+	require.ErrorIs(t, err, ErrTooManyUsers)
+	require.Equal(t, 2, cli.Users())
+
+	// the least recently used idle client is evicted
+	releaseBob()
+	releaseAlice()
+	carol, releaseCarol, err := cli.ForUser("carol", "defaultdb")
+	require.NoError(t, err)
+	defer releaseCarol()
+	require.False(t, bob.IsConnected())
+	require.True(t, alice.IsConnected())
+	require.True(t, carol.IsConnected())
+	require.Equal(t, 2, cli.Users())
+
+	again, release, err := cli.ForUser("alice", "defaultdb")
+	require.NoError(t, err)
+	release()
+	require.Same(t, alice, again)
+	require.NoError(t, cli.Close())
+}
+
+func Test_client_mocks_for_user(t *testing.T) {
+	c := NewMockClientWithDb(nil, immuclient.DefaultOptions(), "bazdb")
+	cli, release, err := c.ForUser("alice", "bazdb")
+	require.NoError(t, err)
+	release()
+	require.Nil(t, cli)
+	require.Equal(t, 0, c.Users())
+	require.NoError(t, c.Logout("alice"))
+}
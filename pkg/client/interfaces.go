@@ -16,7 +16,11 @@ limitations under the License.
 
 package client
 
-import immuclient "github.com/codenotary/immudb/pkg/client"
+import (
+	"time"
+
+	immuclient "github.com/codenotary/immudb/pkg/client"
+)
 
 // Client is a multi database connection manager for immudb server
 type Client interface {
@@ -25,4 +29,29 @@ type Client interface {
 
 	// For returns the client for database db to the immudb server
 	For(db string) (immuclient.ImmuClient, error)
+
+	// ForUser returns the client of user for database db to the immudb
+	// server, in use until the returned function is called. The clients of
+	// every user keep their own token in memory.
+	ForUser(user string, db string) (immuclient.ImmuClient, func(), error)
+
+	// WithMaxUsers sets the maximum number of clients of the users, the
+	// least recently used ones being evicted as new ones are needed
+	WithMaxUsers(max int) Client
+
+	// Logout disconnects the clients of user from the immudb server
+	Logout(user string) error
+
+	// EvictIdle disconnects the clients of the users not used for longer
+	// than idle from the immudb server, returning how many were evicted
+	EvictIdle(idle time.Duration) int
+
+	// Users returns the number of clients of the users
+	Users() int
+
+	// Databases returns the databases a client has been added for, sorted by name
+	Databases() []string
+
+	// Close disconnects the clients of every database from the immudb server
+	Close() error
 }
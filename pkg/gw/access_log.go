@@ -0,0 +1,131 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AccessLogEntry is the access log line of a REST request
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"requestId"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Route      string    `json:"route"`
+	Database   string    `json:"database,omitempty"`
+	Status     int       `json:"status"`
+	GrpcCode   string    `json:"grpcCode"`
+	LatencyMs  float64   `json:"latencyMs"`
+	Bytes      int       `json:"bytes"`
+	User       string    `json:"user,omitempty"`
+	APIKey     string    `json:"apiKey,omitempty"`
+	Subject    string    `json:"subject,omitempty"`
+	// UnverifiedUser is the immudb user of the token of the request, read
+	// by the gateway without verifying the token
+	UnverifiedUser string `json:"unverifiedUser,omitempty"`
+	// ClientCertSubject is the subject of the verified client certificate
+	ClientCertSubject string `json:"clientCertSubject,omitempty"`
+}
+
+// accessLog writes a JSON line for every REST request
+type accessLog struct {
+	mu sync.Mutex
+	w  io.Writer
+	c  io.Closer
+}
+
+// newAccessLog returns the access log configured by the options, nil when
+// the access log is disabled. The lines are written to the standard output
+// unless an access log file is set.
+func newAccessLog(o Options) (*accessLog, error) {
+	if !o.AccessLog {
+		return nil, nil
+	}
+	if o.AccessLogFile == "" {
+		return &accessLog{w: os.Stdout}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(o.AccessLogFile), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(o.AccessLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &accessLog{w: f, c: f}, nil
+}
+
+// handler logs the requests served by h
+func (l *accessLog) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		req, route := withRequestRoute(req)
+		rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		h.ServeHTTP(rw, req)
+
+		e := AccessLogEntry{
+			Time:       start.UTC(),
+			RemoteAddr: req.RemoteAddr,
+			Method:     req.Method,
+			Path:       req.URL.Path,
+			Route:      route.Pattern,
+			Database:   route.Database,
+			Status:     rw.status,
+			GrpcCode:   route.grpcCode(rw.status).String(),
+			LatencyMs:  float64(time.Since(start)) / float64(time.Millisecond),
+			Bytes:      rw.size,
+			User:       route.User,
+			APIKey:     route.APIKey,
+			Subject:    route.Subject,
+		}
+		if e.Route == "" {
+			e.Route = unmatchedRoute
+		}
+		e.RequestID, _ = RequestIDFromContext(req.Context())
+		e.ClientCertSubject, _ = ClientCertSubjectFromContext(req.Context())
+		if e.User == "" {
+			e.UnverifiedUser = requestUser(req)
+		}
+		l.write(e)
+	})
+}
+
+func (l *accessLog) write(e AccessLogEntry) {
+	bs, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(bs, '\n'))
+}
+
+// Close closes the access log file, if any
+func (l *accessLog) Close() error {
+	if l == nil || l.c == nil {
+		return nil
+	}
+	return l.c.Close()
+}
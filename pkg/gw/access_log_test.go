@@ -0,0 +1,122 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codenotary/immudb/pkg/auth"
+	"github.com/codenotary/immugw/pkg/api"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewAccessLog(t *testing.T) {
+	l, err := newAccessLog(DefaultOptions())
+	require.NoError(t, err)
+	require.Nil(t, l)
+	require.NoError(t, l.Close())
+
+	l, err = newAccessLog(DefaultOptions().WithAccessLog(true))
+	require.NoError(t, err)
+	require.Equal(t, os.Stdout, l.w)
+	require.NoError(t, l.Close())
+}
+
+func TestAccessLog(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "logs", "access.log")
+	l, err := newAccessLog(DefaultOptions().WithAccessLog(true).WithAccessLogFile(file))
+	require.NoError(t, err)
+
+	mux := runtime.NewServeMux(runtime.WithProtoErrorHandler(routeErrorHandler(api.DefaultGWErrorHandler)))
+	handleRoute(mux, "VerifiedGet", http.MethodPost, api.Pattern_ImmuService_VerifiedGet_0(), func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		if pathParams["databaseName"] == "missingdb" {
+			_, outbound := runtime.MarshalerForRequest(mux, req)
+			runtime.HTTPError(req.Context(), mux, outbound, w, req, status.Error(codes.NotFound, "database not found"))
+			return
+		}
+		w.Write([]byte("{}"))
+	})
+	m := newRequestMetrics(prometheus.NewRegistry())
+	handler := clientCertSubjectHandler(requestIDHandler(l.handler(m.handler(mux))))
+
+	token, err := auth.GenerateToken(auth.User{Username: "alice"}, 0, 60)
+	require.NoError(t, err)
+
+	serve := func(url string, requestID string) {
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader("{}"))
+		require.NoError(t, err)
+		req.RemoteAddr = "127.0.0.1:51234"
+		req.Header.Set(RequestIDHeader, requestID)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "client1"}}}}}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	serve("/db/db1/verified/get", "req-1")
+	serve("/db/missingdb/verified/get", "req-2")
+	serve("/unknown", "req-3")
+	require.NoError(t, l.Close())
+
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var entries []AccessLogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AccessLogEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		entries = append(entries, e)
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, entries, 3)
+
+	e := entries[0]
+	require.Equal(t, "req-1", e.RequestID)
+	require.Equal(t, "127.0.0.1:51234", e.RemoteAddr)
+	require.Equal(t, http.MethodPost, e.Method)
+	require.Equal(t, "/db/db1/verified/get", e.Path)
+	require.Equal(t, "/db/{databaseName=*}/verified/get", e.Route)
+	require.Equal(t, "db1", e.Database)
+	require.Equal(t, http.StatusOK, e.Status)
+	require.Equal(t, "OK", e.GrpcCode)
+	require.Equal(t, 2, e.Bytes)
+	require.Empty(t, e.User)
+	require.Equal(t, "CN=client1", e.ClientCertSubject)
+	require.Equal(t, "alice", e.UnverifiedUser)
+	require.False(t, e.Time.IsZero())
+
+	require.Equal(t, "req-2", entries[1].RequestID)
+	require.Equal(t, http.StatusNotFound, entries[1].Status)
+	require.Equal(t, "NotFound", entries[1].GrpcCode)
+
+	require.Equal(t, unmatchedRoute, entries[2].Route)
+	require.Empty(t, entries[2].Database)
+	require.Equal(t, http.StatusNotImplemented, entries[2].Status)
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+)
+
+// apiKeyScheme is the authorization scheme of the requests authenticated
+// with an API key
+const apiKeyScheme = "ApiKey"
+
+// APIKeysFile is the file the API keys are read from
+type APIKeysFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// APIKey is a gateway API key, mapped to the immudb identity the requests
+// authenticated with it are run under. Only the SHA-256 hash of the key is
+// stored.
+type APIKey struct {
+	Name string `json:"name"`
+	// Hash is the hex encoded SHA-256 hash of the key
+	Hash string `json:"hash"`
+	// Username and Password are the immudb credentials of the identity, the
+	// password can be base64 encoded with the 'enc:' prefix
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Databases and Routes the key is allowed to access, all if empty. The
+	// routes are named after the immudb methods, e.g. VerifiedGet.
+	Databases []string `json:"databases,omitempty"`
+	Routes    []string `json:"routes,omitempty"`
+	// Roles of the key, matched by the route policies
+	Roles []string `json:"roles,omitempty"`
+}
+
+// apiKeys authenticates the requests carrying an API key, mapping them to
+// the immudb identity of the key by the hash of the key
+type apiKeys struct {
+	keys map[string]*identity
+}
+
+// loadAPIKeys reads the API keys of file, the identities of the keys log in
+// to immudb with client. No API keys are loaded if file is empty.
+func loadAPIKeys(file string, client schema.ImmuServiceClient) (*apiKeys, error) {
+	if file == "" {
+		return nil, nil
+	}
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var f APIKeysFile
+	if err := json.Unmarshal(bs, &f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAPIKeys, err)
+	}
+	return newAPIKeys(f.Keys, client)
+}
+
+func newAPIKeys(keys []APIKey, client schema.ImmuServiceClient) (*apiKeys, error) {
+	k := &apiKeys{keys: make(map[string]*identity, len(keys))}
+	sessions := newIdentitySessions(client)
+	names := make(map[string]bool, len(keys))
+	for i := range keys {
+		key := keys[i]
+		if key.Name == "" {
+			return nil, fmt.Errorf("%w: key %d has no name", ErrInvalidAPIKeys, i)
+		}
+		if names[key.Name] {
+			return nil, fmt.Errorf("%w: duplicate key %s", ErrInvalidAPIKeys, key.Name)
+		}
+		names[key.Name] = true
+
+		hash, err := hex.DecodeString(key.Hash)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("%w: key %s has no valid SHA-256 hash", ErrInvalidAPIKeys, key.Name)
+		}
+		key.Hash = hex.EncodeToString(hash)
+		if _, ok := k.keys[key.Hash]; ok {
+			return nil, fmt.Errorf("%w: key %s has the hash of another key", ErrInvalidAPIKeys, key.Name)
+		}
+		if key.Username == "" {
+			return nil, fmt.Errorf("%w: key %s has no username", ErrInvalidAPIKeys, key.Name)
+		}
+		id, err := newIdentity(key.Username, key.Password, key.Databases, key.Routes, sessions)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %s: %v", ErrInvalidAPIKeys, key.Name, err)
+		}
+		id.apiKey = key.Name
+		id.roles = key.Roles
+		k.keys[key.Hash] = id
+	}
+	return k, nil
+}
+
+type apiKeysKey struct{}
+
+// handler makes k available to the requests served by h
+func (k *apiKeys) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), apiKeysKey{}, k)))
+	})
+}
+
+// apiKeysFromContext returns the API keys of the request, nil API keys
+// authenticate no request
+func apiKeysFromContext(ctx context.Context) *apiKeys {
+	k, _ := ctx.Value(apiKeysKey{}).(*apiKeys)
+	return k
+}
+
+// apiKeyFromRequest returns the API key of the Authorization header of req,
+// if any
+func apiKeyFromRequest(req *http.Request) (string, bool) {
+	parts := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], apiKeyScheme) {
+		return "", false
+	}
+	return strings.TrimSpace(parts[1]), true
+}
+
+// authenticate returns the identity of the API key value
+func (k *apiKeys) authenticate(value string) (*identity, error) {
+	if k == nil {
+		return nil, ErrAPIKeysDisabled
+	}
+	hash := sha256.Sum256([]byte(value))
+	id, ok := k.keys[hex.EncodeToString(hash[:])]
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+	return id, nil
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immugw/pkg/api"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func apiKeyHash(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+type loginServiceClientMock struct {
+	schema.ImmuServiceClient
+	logins int
+}
+
+func (m *loginServiceClientMock) Login(ctx context.Context, in *schema.LoginRequest, opts ...grpc.CallOption) (*schema.LoginResponse, error) {
+	if string(in.Password) != "secret" {
+		return nil, status.Error(codes.PermissionDenied, "invalid user name or password")
+	}
+	m.logins++
+	return &schema.LoginResponse{Token: string(in.User) + "-token"}, nil
+}
+
+func (m *loginServiceClientMock) UseDatabase(ctx context.Context, in *schema.Database, opts ...grpc.CallOption) (*schema.UseDatabaseReply, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	return &schema.UseDatabaseReply{Token: strings.TrimPrefix(md.Get("authorization")[0], "Bearer ") + "-" + in.DatabaseName}, nil
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	keys, err := loadAPIKeys("", nil)
+	require.NoError(t, err)
+	require.Nil(t, keys)
+
+	_, err = loadAPIKeys(filepath.Join(t.TempDir(), "missing.json"), nil)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	file := filepath.Join(t.TempDir(), "api_keys.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"keys":[{"name":"ci"`), 0600))
+	_, err = loadAPIKeys(file, nil)
+	require.ErrorIs(t, err, ErrInvalidAPIKeys)
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"keys":[{"name":"ci","hash":"`+strings.ToUpper(apiKeyHash("key1"))+`","username":"ci","password":"enc:c2VjcmV0"}]}`), 0600))
+	keys, err = loadAPIKeys(file, nil)
+	require.NoError(t, err)
+	require.Equal(t, "secret", keys.keys[apiKeyHash("key1")].password)
+
+	for _, k := range [][]APIKey{
+		{{Hash: apiKeyHash("key1"), Username: "ci"}},
+		{{Name: "ci", Hash: "abc", Username: "ci"}},
+		{{Name: "ci", Hash: apiKeyHash("key1")}},
+		{{Name: "ci", Hash: apiKeyHash("key1"), Username: "ci", Password: "enc:%"}},
+		{{Name: "ci", Hash: apiKeyHash("key1"), Username: "ci"}, {Name: "ci", Hash: apiKeyHash("key2"), Username: "ci"}},
+		{{Name: "ci", Hash: apiKeyHash("key1"), Username: "ci"}, {Name: "ci2", Hash: apiKeyHash("key1"), Username: "ci"}},
+	} {
+		_, err := newAPIKeys(k, nil)
+		require.ErrorIs(t, err, ErrInvalidAPIKeys)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	client := &loginServiceClientMock{}
+	keys, err := newAPIKeys([]APIKey{
+		{Name: "ci", Hash: apiKeyHash("key1"), Username: "ci", Password: "secret", Databases: []string{"db1"}, Routes: []string{"VerifiedGet", "ServerInfo"}},
+		{Name: "admin", Hash: apiKeyHash("key2"), Username: "admin", Password: "secret"},
+		{Name: "broken", Hash: apiKeyHash("key3"), Username: "broken", Password: "wrong"},
+		{Name: "tenant", Hash: apiKeyHash("key5"), Username: "tenant", Password: "secret", Databases: []string{"db1"}},
+	}, client)
+	require.NoError(t, err)
+
+	var authorization string
+	expired := false
+	mux := runtime.NewServeMux(runtime.WithProtoErrorHandler(routeErrorHandler(api.DefaultGWErrorHandler)))
+	h := func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		authorization = req.Header.Get("Authorization")
+		if expired {
+			_, outbound := runtime.MarshalerForRequest(mux, req)
+			runtime.HTTPError(req.Context(), mux, outbound, w, req, status.Error(codes.Unauthenticated, "token has expired"))
+			return
+		}
+		w.Write([]byte("{}"))
+	}
+	handleRoute(mux, "VerifiedGet", http.MethodPost, api.Pattern_ImmuService_VerifiedGet_0(), h)
+	handleRoute(mux, "ServerInfo", http.MethodGet, api.Pattern_ImmuService_ServerInfo_0, h)
+	handleRoute(mux, "Login", http.MethodPost, api.Pattern_ImmuService_Login_0, h)
+	handleRoute(mux, "DeleteDatabase", http.MethodPost, api.Pattern_ImmuService_DeleteDatabase_0, h)
+	requests := newRequestMetrics(prometheus.NewRegistry())
+
+	serveBody := func(keys *apiKeys, method string, url string, authorization string, body string) int {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", authorization)
+		rr := httptest.NewRecorder()
+		var handler http.Handler = mux
+		if keys != nil {
+			handler = keys.handler(handler)
+		}
+		requests.handler(handler).ServeHTTP(rr, req)
+		return rr.Code
+	}
+	serve := func(keys *apiKeys, method string, url string, authorization string) int {
+		return serveBody(keys, method, url, authorization, "{}")
+	}
+
+	require.Equal(t, http.StatusOK, serve(keys, http.MethodPost, "/db/db1/verified/get", "ApiKey key1"))
+	require.Equal(t, "Bearer ci-token-db1", authorization)
+	require.Equal(t, http.StatusOK, serve(keys, http.MethodPost, "/db/db1/verified/get", "apikey key1"))
+	require.Equal(t, 1, client.logins)
+
+	// routes without database run on the default database of the identity
+	require.Equal(t, http.StatusOK, serve(keys, http.MethodGet, "/serverinfo", "ApiKey key1"))
+	require.Equal(t, "Bearer ci-token", authorization)
+
+	authorization = ""
+	require.Equal(t, http.StatusUnauthorized, serve(keys, http.MethodPost, "/db/db1/verified/get", "ApiKey key4"))
+	require.Equal(t, http.StatusForbidden, serve(keys, http.MethodPost, "/db/db2/verified/get", "ApiKey key1"))
+	require.Equal(t, http.StatusForbidden, serve(keys, http.MethodPost, "/login", "ApiKey key2"))
+	require.Equal(t, http.StatusForbidden, serve(keys, http.MethodPost, "/db/db2/verified/get", "ApiKey key3"))
+	require.Equal(t, http.StatusUnauthorized, serve(nil, http.MethodPost, "/db/db1/verified/get", "ApiKey key1"))
+	require.Empty(t, authorization)
+
+	require.Equal(t, http.StatusOK, serve(keys, http.MethodPost, "/db/db2/verified/get", "ApiKey key2"))
+	require.Equal(t, "Bearer admin-token-db2", authorization)
+
+	// the admin routes are authorized on the database of their body too
+	authorization = ""
+	require.Equal(t, http.StatusForbidden, serveBody(keys, http.MethodPost, "/db/db1/delete", "ApiKey key5", `{"database":"db2"}`))
+	require.Equal(t, http.StatusBadRequest, serveBody(keys, http.MethodPost, "/db/db1/delete", "ApiKey key5", `{"database":`))
+	require.Empty(t, authorization)
+	require.Equal(t, http.StatusOK, serveBody(keys, http.MethodPost, "/db/db1/delete", "ApiKey key5", `{"database":"db1"}`))
+	require.Equal(t, "Bearer tenant-token-db1", authorization)
+	require.Equal(t, http.StatusOK, serveBody(keys, http.MethodPost, "/db/db1/delete", "ApiKey key2", `{"database":"db2"}`))
+
+	// other authorizations are forwarded as they are
+	require.Equal(t, http.StatusOK, serve(nil, http.MethodPost, "/db/db1/verified/get", "Bearer token"))
+	require.Equal(t, "Bearer token", authorization)
+
+	// the identity logs in again once its token is rejected
+	logins := client.logins
+	expired = true
+	require.Equal(t, http.StatusUnauthorized, serve(keys, http.MethodPost, "/db/db1/verified/get", "ApiKey key1"))
+	expired = false
+	require.Equal(t, http.StatusOK, serve(keys, http.MethodPost, "/db/db1/verified/get", "ApiKey key1"))
+	require.Equal(t, logins+1, client.logins)
+}
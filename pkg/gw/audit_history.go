@@ -0,0 +1,383 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codenotary/immudb/embedded/logger"
+	"github.com/codenotary/immudb/pkg/api/schema"
+)
+
+// audit results as stored in the audit history
+const (
+	AuditResultOK        = "ok"
+	AuditResultTampered  = "tampered"
+	AuditResultError     = "error"
+	AuditResultUnchecked = "unchecked"
+)
+
+// auditRecordVersion is the version of the AuditRecord format. Records are
+// never rewritten, readers must keep accepting older versions.
+const auditRecordVersion = 1
+
+const (
+	auditHistoryFilePrefix   = "audit-"
+	auditHistoryFileSuffix   = ".jsonl"
+	auditHistoryDefaultLimit = 100
+	auditHistoryMaxLimit     = 1000
+)
+
+// AuditRecord is a single audit of a database as stored in the audit history
+type AuditRecord struct {
+	Version        int       `json:"version"`
+	RunAt          time.Time `json:"runAt"`
+	DurationMs     int64     `json:"durationMs"`
+	ServerID       string    `json:"serverId"`
+	ServerAddress  string    `json:"serverAddress"`
+	Database       string    `json:"database"`
+	Result         string    `json:"result"`
+	Error          string    `json:"error,omitempty"`
+	PreviousTxID   uint64    `json:"previousTxId"`
+	PreviousTxHash string    `json:"previousTxHash"`
+	CurrentTxID    uint64    `json:"currentTxId"`
+	CurrentTxHash  string    `json:"currentTxHash"`
+}
+
+var auditRecordCSVHeader = []string{
+	"version", "runAt", "durationMs", "serverId", "serverAddress", "database", "result", "error",
+	"previousTxId", "previousTxHash", "currentTxId", "currentTxHash",
+}
+
+func (r *AuditRecord) csv() []string {
+	return []string{
+		strconv.Itoa(r.Version),
+		r.RunAt.Format(time.RFC3339Nano),
+		strconv.FormatInt(r.DurationMs, 10),
+		r.ServerID,
+		r.ServerAddress,
+		r.Database,
+		r.Result,
+		r.Error,
+		strconv.FormatUint(r.PreviousTxID, 10),
+		r.PreviousTxHash,
+		strconv.FormatUint(r.CurrentTxID, 10),
+		r.CurrentTxHash,
+	}
+}
+
+func newAuditRecord(
+	serverID string,
+	serverAddress string,
+	database string,
+	runAt time.Time,
+	duration time.Duration,
+	checked bool,
+	withError bool,
+	result bool,
+	errMsg string,
+	prevState *schema.ImmutableState,
+	currState *schema.ImmutableState,
+) *AuditRecord {
+	r := &AuditRecord{
+		Version:        auditRecordVersion,
+		RunAt:          runAt.UTC(),
+		DurationMs:     duration.Milliseconds(),
+		ServerID:       serverID,
+		ServerAddress:  serverAddress,
+		Database:       database,
+		Error:          errMsg,
+		PreviousTxID:   prevState.GetTxId(),
+		PreviousTxHash: hex.EncodeToString(prevState.GetTxHash()),
+		CurrentTxID:    currState.GetTxId(),
+		CurrentTxHash:  hex.EncodeToString(currState.GetTxHash()),
+	}
+	switch {
+	case withError:
+		r.Result = AuditResultError
+	case checked && result:
+		r.Result = AuditResultOK
+	case checked:
+		r.Result = AuditResultTampered
+	default:
+		r.Result = AuditResultUnchecked
+	}
+	return r
+}
+
+// auditHistoryQuery filters the audit history
+type auditHistoryQuery struct {
+	from     time.Time
+	to       time.Time
+	database string
+	result   string
+	offset   int
+	limit    int
+}
+
+func (q *auditHistoryQuery) matches(r *AuditRecord) bool {
+	return (q.from.IsZero() || !r.RunAt.Before(q.from)) &&
+		(q.to.IsZero() || r.RunAt.Before(q.to)) &&
+		(q.database == "" || r.Database == q.database) &&
+		(q.result == "" || r.Result == q.result)
+}
+
+// auditHistory is an append only store of audit records. Records are stored
+// as JSON lines in one file per month, so that the history is independent from
+// the gateway logs and old files can be archived without affecting new runs.
+type auditHistory struct {
+	dir    string
+	logger logger.Logger
+	mu     sync.RWMutex
+}
+
+func newAuditHistory(dir string, log logger.Logger) (*auditHistory, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &auditHistory{dir: dir, logger: log}, nil
+}
+
+func (h *auditHistory) fileName(t time.Time) string {
+	return filepath.Join(h.dir, auditHistoryFilePrefix+t.UTC().Format("2006-01")+auditHistoryFileSuffix)
+}
+
+// Append stores the record, errors are logged
+func (h *auditHistory) Append(r *AuditRecord) {
+	if err := h.append(r); err != nil {
+		h.logger.Errorf("unable to store audit record of database %s: %v", r.Database, err)
+	}
+}
+
+func (h *auditHistory) append(r *AuditRecord) error {
+	bs, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.OpenFile(h.fileName(r.RunAt), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(bs, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Query returns the records matching q in chronological order and the
+// offset of the next page, -1 when there are no more records
+func (h *auditHistory) Query(q *auditHistoryQuery) ([]*AuditRecord, int, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	files, err := h.files(q.from, q.to)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	records := []*AuditRecord{}
+	matched := 0
+	for _, fn := range files {
+		f, err := os.Open(fn)
+		if err != nil {
+			return nil, -1, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			var r AuditRecord
+			if err := json.Unmarshal(line, &r); err != nil {
+				// a truncated last line, e.g. after a crash, must not hide the rest of the history
+				h.logger.Warningf("skipping malformed audit record in %s: %v", fn, err)
+				continue
+			}
+			if !q.matches(&r) {
+				continue
+			}
+			matched++
+			if matched <= q.offset {
+				continue
+			}
+			if len(records) == q.limit {
+				f.Close()
+				return records, q.offset + q.limit, nil
+			}
+			records = append(records, &r)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, -1, err
+		}
+	}
+	return records, -1, nil
+}
+
+// files returns the history files that may hold records between from and to
+func (h *auditHistory) files(from, to time.Time) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(h.dir, auditHistoryFilePrefix+"*"+auditHistoryFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var selected []string
+	for _, fn := range files {
+		month, err := time.Parse("2006-01", strings.TrimSuffix(strings.TrimPrefix(filepath.Base(fn), auditHistoryFilePrefix), auditHistoryFileSuffix))
+		if err != nil {
+			continue
+		}
+		if !from.IsZero() && !month.AddDate(0, 1, 0).After(from) {
+			continue
+		}
+		if !to.IsZero() && !month.Before(to) {
+			continue
+		}
+		selected = append(selected, fn)
+	}
+	return selected, nil
+}
+
+// auditHistoryPage is the JSON response of the audit history endpoint
+type auditHistoryPage struct {
+	Records    []*AuditRecord `json:"records"`
+	NextOffset *int           `json:"nextOffset,omitempty"`
+}
+
+// auditHistoryHandler pages through the audit history. It accepts the from
+// and to (RFC 3339), database, result, offset, limit and format (json or
+// csv) query parameters.
+func auditHistoryHandler(h *auditHistory) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q, format, err := parseAuditHistoryQuery(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		records, next, err := h.Query(q)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("internal error: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			if next >= 0 {
+				w.Header().Set("X-Next-Offset", strconv.Itoa(next))
+			}
+			cw := csv.NewWriter(w)
+			cw.Write(auditRecordCSVHeader)
+			for _, r := range records {
+				cw.Write(r.csv())
+			}
+			cw.Flush()
+			return
+		}
+
+		page := auditHistoryPage{Records: records}
+		if next >= 0 {
+			page.NextOffset = &next
+		}
+		bs, err := json.Marshal(page)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("internal error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bs)
+	}
+}
+
+func parseAuditHistoryQuery(req *http.Request) (*auditHistoryQuery, string, error) {
+	values := req.URL.Query()
+	q := &auditHistoryQuery{
+		database: values.Get("database"),
+		result:   values.Get("result"),
+		limit:    auditHistoryDefaultLimit,
+	}
+
+	var err error
+	if v := values.Get("from"); v != "" {
+		if q.from, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, "", fmt.Errorf("invalid from: %v", err)
+		}
+	}
+	if v := values.Get("to"); v != "" {
+		if q.to, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, "", fmt.Errorf("invalid to: %v", err)
+		}
+	}
+	switch q.result {
+	case "", AuditResultOK, AuditResultTampered, AuditResultError, AuditResultUnchecked:
+	default:
+		return nil, "", fmt.Errorf("invalid result %q, allowed values are %s, %s, %s and %s",
+			q.result, AuditResultOK, AuditResultTampered, AuditResultError, AuditResultUnchecked)
+	}
+	if v := values.Get("offset"); v != "" {
+		if q.offset, err = strconv.Atoi(v); err != nil || q.offset < 0 {
+			return nil, "", fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		if q.limit, err = strconv.Atoi(v); err != nil || q.limit < 1 || q.limit > auditHistoryMaxLimit {
+			return nil, "", fmt.Errorf("invalid limit %q, must be between 1 and %d", v, auditHistoryMaxLimit)
+		}
+	}
+
+	format := values.Get("format")
+	switch format {
+	case "":
+		format = "json"
+	case "json", "csv":
+	default:
+		return nil, "", fmt.Errorf("invalid format %q, allowed values are json and csv", format)
+	}
+	return q, format, nil
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb/embedded/logger"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAuditHistory(t *testing.T) (*auditHistory, time.Time) {
+	h, err := newAuditHistory(t.TempDir(), logger.NewSimpleLogger("audit_history_test", os.Stdout))
+	require.NoError(t, err)
+
+	base := time.Date(2022, 1, 31, 23, 0, 0, 0, time.UTC)
+	prev := &schema.ImmutableState{TxId: 1, TxHash: []byte{1}}
+	curr := &schema.ImmutableState{TxId: 2, TxHash: []byte{2}}
+
+	h.Append(newAuditRecord("server1", "127.0.0.1:3322", "db1", base, time.Second, true, false, true, "", prev, curr))
+	h.Append(newAuditRecord("server1", "127.0.0.1:3322", "db2", base.Add(time.Minute), time.Second, true, false, false, "", prev, curr))
+	h.Append(newAuditRecord("server1", "127.0.0.1:3322", "db1", base.Add(2*time.Hour), time.Second, false, true, false, "error getting current state", nil, nil))
+	h.Append(newAuditRecord("server1", "127.0.0.1:3322", "db2", base.Add(3*time.Hour), time.Second, false, false, true, "", nil, curr))
+
+	return h, base
+}
+
+func TestAuditHistory(t *testing.T) {
+	h, base := newTestAuditHistory(t)
+
+	// records of different months are stored in different files
+	files, err := filepath.Glob(filepath.Join(h.dir, "*"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	records, next, err := h.Query(&auditHistoryQuery{limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, -1, next)
+	require.Len(t, records, 4)
+	require.Equal(t, AuditResultOK, records[0].Result)
+	require.Equal(t, AuditResultTampered, records[1].Result)
+	require.Equal(t, AuditResultError, records[2].Result)
+	require.Equal(t, "error getting current state", records[2].Error)
+	require.Equal(t, AuditResultUnchecked, records[3].Result)
+	require.Equal(t, auditRecordVersion, records[0].Version)
+	require.Equal(t, int64(1000), records[0].DurationMs)
+	require.Equal(t, uint64(1), records[0].PreviousTxID)
+	require.Equal(t, "01", records[0].PreviousTxHash)
+	require.Equal(t, uint64(2), records[0].CurrentTxID)
+	require.Equal(t, "02", records[0].CurrentTxHash)
+
+	records, _, err = h.Query(&auditHistoryQuery{database: "db1", limit: 10})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	records, _, err = h.Query(&auditHistoryQuery{result: AuditResultTampered, limit: 10})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, "db2", records[0].Database)
+
+	records, _, err = h.Query(&auditHistoryQuery{from: base.Add(time.Hour), limit: 10})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	records, _, err = h.Query(&auditHistoryQuery{to: base.Add(time.Hour), limit: 10})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	records, next, err = h.Query(&auditHistoryQuery{limit: 3})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Equal(t, 3, next)
+
+	records, next, err = h.Query(&auditHistoryQuery{offset: 3, limit: 3})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, -1, next)
+	require.Equal(t, AuditResultUnchecked, records[0].Result)
+}
+
+func TestAuditHistorySkipsMalformedRecords(t *testing.T) {
+	h, base := newTestAuditHistory(t)
+
+	f, err := os.OpenFile(h.fileName(base), os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"version":1,"runAt":"2022-01`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	records, _, err := h.Query(&auditHistoryQuery{limit: 10})
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+}
+
+func TestAuditHistoryHandler(t *testing.T) {
+	h, _ := newTestAuditHistory(t)
+	handler := http.HandlerFunc(auditHistoryHandler(h))
+
+	serve := func(method, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(http.MethodGet, "/audit/history?database=db1&limit=1")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var page auditHistoryPage
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+	require.Len(t, page.Records, 1)
+	require.Equal(t, "db1", page.Records[0].Database)
+	require.NotNil(t, page.NextOffset)
+	require.Equal(t, 1, *page.NextOffset)
+
+	rr = serve(http.MethodGet, "/audit/history?from=2022-02-01T00:00:00Z&format=csv")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "text/csv", rr.Header().Get("Content-Type"))
+	rows, err := csv.NewReader(rr.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	require.Equal(t, auditRecordCSVHeader, rows[0])
+	require.Equal(t, "db1", rows[1][5])
+	require.Equal(t, AuditResultError, rows[1][6])
+	require.Equal(t, "error getting current state", rows[1][7])
+
+	for _, url := range []string{
+		"/audit/history?from=yesterday",
+		"/audit/history?to=tomorrow",
+		"/audit/history?result=unknown",
+		"/audit/history?offset=-1",
+		"/audit/history?limit=0",
+		"/audit/history?limit=1001",
+		"/audit/history?format=xml",
+	} {
+		require.Equal(t, http.StatusBadRequest, serve(http.MethodGet, url).Code, url)
+	}
+
+	require.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "/audit/history").Code)
+}
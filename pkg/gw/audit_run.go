@@ -0,0 +1,82 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/codenotary/immugw/pkg/json"
+)
+
+// auditTrigger runs an audit on demand
+type auditTrigger interface {
+	Trigger(db string) []*LastAuditResult
+}
+
+// auditRunHandler runs an audit of the database given in the database query
+// parameter and returns its LastAuditResult, or of all the audited databases
+// and returns the list of their results. The databases not audited are not
+// found. Requests must carry the configured
+// token as a bearer token.
+func auditRunHandler(trigger auditTrigger, token string, json json.JSON) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !validBearerToken(req, token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		database := req.URL.Query().Get("database")
+		results := trigger.Trigger(database)
+
+		var res interface{} = results
+		if database != "" {
+			if len(results) == 0 {
+				http.Error(w, fmt.Sprintf("database %s is not audited", database), http.StatusNotFound)
+				return
+			}
+			res = results[0]
+		}
+
+		bs, err := json.Marshal(res)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("internal error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bs)
+	}
+}
+
+// validBearerToken checks in constant time that req carries token as bearer token
+func validBearerToken(req *http.Request, token string) bool {
+	auth := req.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if token == "" || len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(token)) == 1
+}
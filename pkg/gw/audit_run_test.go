@@ -0,0 +1,82 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	immugwjson "github.com/codenotary/immugw/pkg/json"
+	"github.com/stretchr/testify/require"
+)
+
+type testAuditTrigger struct {
+	databases []string
+}
+
+func (tr *testAuditTrigger) Trigger(db string) []*LastAuditResult {
+	tr.databases = append(tr.databases, db)
+	switch db {
+	case "":
+		return []*LastAuditResult{{Database: "defaultdb"}, {Database: "db1"}}
+	case "missingdb":
+		return nil
+	}
+	return []*LastAuditResult{{Database: db, HasRunConsistencyCheck: true, ConsistencyCheckResult: true}}
+}
+
+func TestAuditRunHandler(t *testing.T) {
+	trigger := &testAuditTrigger{}
+	handler := http.HandlerFunc(auditRunHandler(trigger, "secret", immugwjson.DefaultJSON()))
+
+	serve := func(method, url, authorization string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, nil)
+		require.NoError(t, err)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(http.MethodPost, "/audit/run?database=db1", "Bearer secret")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var result LastAuditResult
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	require.Equal(t, "db1", result.Database)
+	require.True(t, result.ConsistencyCheckResult)
+
+	rr = serve(http.MethodPost, "/audit/run", "bearer secret")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var results []*LastAuditResult
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &results))
+	require.Len(t, results, 2)
+
+	require.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/audit/run?database=missingdb", "Bearer secret").Code)
+
+	for _, authorization := range []string{"", "Bearer", "Bearer wrong", "Basic secret", "secret"} {
+		rr = serve(http.MethodPost, "/audit/run", authorization)
+		require.Equal(t, http.StatusUnauthorized, rr.Code, authorization)
+		require.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+	}
+	require.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodGet, "/audit/run", "Bearer secret").Code)
+
+	require.Equal(t, []string{"db1", "", "missingdb"}, trigger.databases)
+}
@@ -0,0 +1,479 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codenotary/immudb/embedded/logger"
+	"github.com/codenotary/immudb/embedded/store"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immudb/pkg/auth"
+	"github.com/codenotary/immudb/pkg/client/cache"
+	"github.com/codenotary/immudb/pkg/client/state"
+	"github.com/codenotary/immudb/pkg/signer"
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc/metadata"
+)
+
+// auditResultFunc receives the outcome of the audit of a single database.
+// A state whose signature is not valid is reported with an error and a
+// failed result.
+type auditResultFunc func(
+	serverID string,
+	serverAddress string,
+	database string,
+	checked bool,
+	withError bool,
+	result bool,
+	prevState *schema.ImmutableState,
+	currState *schema.ImmutableState,
+)
+
+// auditor periodically checks that the current state of every audited
+// database is consistent with the one seen by the previous audit
+type auditor struct {
+	index               uint64
+	serverAddress       string
+	username            []byte
+	password            []byte
+	databases           []string
+	serverSigningPubKey *ecdsa.PublicKey
+	serviceClient       schema.ImmuServiceClient
+	uuidProvider        state.UUIDProvider
+	dir                 string
+	updateResult        auditResultFunc
+	recordRun           func(*AuditRecord)
+	logger              logger.Logger
+
+	mu        sync.Mutex
+	histories map[string]cache.HistoryCache
+
+	triggerMu sync.Mutex
+	triggers  map[string]*auditCall
+
+	intervalc chan time.Duration
+}
+
+// auditCall is an on-demand audit in progress, shared by the concurrent
+// triggers of the same databases
+type auditCall struct {
+	done    chan struct{}
+	results []*LastAuditResult
+}
+
+var serverIDRegExp = regexp.MustCompile(`[^a-zA-Z0-9\-_]+`)
+
+// newAuditor returns an auditor for the given databases, all the databases
+// found on the server are audited when none is given. The states of each
+// database are cached in their own folder under dir.
+func newAuditor(
+	serverAddress string,
+	username string,
+	passwordBase64 string,
+	databases []string,
+	serverSigningPubKey *ecdsa.PublicKey,
+	serviceClient schema.ImmuServiceClient,
+	dir string,
+	updateResult auditResultFunc,
+	recordRun func(*AuditRecord),
+	log logger.Logger,
+) (*auditor, error) {
+	password, err := auth.DecodeBase64Password(passwordBase64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auditor{
+		serverAddress:       serverAddress,
+		username:            []byte(username),
+		password:            []byte(password),
+		databases:           databases,
+		serverSigningPubKey: serverSigningPubKey,
+		serviceClient:       serviceClient,
+		uuidProvider:        state.NewUUIDProvider(serviceClient),
+		dir:                 dir,
+		updateResult:        updateResult,
+		recordRun:           recordRun,
+		logger:              log,
+		histories:           make(map[string]cache.HistoryCache),
+		triggers:            make(map[string]*auditCall),
+		intervalc:           make(chan time.Duration, 1),
+	}, nil
+}
+
+// Run audits all the databases every interval until stopc is closed
+func (a *auditor) Run(interval time.Duration, stopc <-chan struct{}, donec chan<- struct{}) {
+	defer func() { donec <- struct{}{} }()
+	a.logger.Infof("starting auditor with a %s interval ...", interval)
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	audit := true
+	for {
+		if audit {
+			a.audit()
+		}
+
+		select {
+		case <-stopc:
+			a.logger.Infof("auditor stopped")
+			return
+		case <-tick.C:
+			audit = true
+		case interval = <-a.intervalc:
+			a.logger.Infof("audit interval changed to %s", interval)
+			tick.Reset(interval)
+			audit = false
+		}
+	}
+}
+
+// setInterval changes the interval of a running auditor, the next audit
+// runs after the new interval
+func (a *auditor) setInterval(interval time.Duration) {
+	// a change not yet picked up by Run is replaced
+	select {
+	case <-a.intervalc:
+	default:
+	}
+	a.intervalc <- interval
+}
+
+// setCredentials changes the credentials and the databases of the next
+// audits, password being decoded already
+func (a *auditor) setCredentials(username string, password string, databases []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.username = []byte(username)
+	a.password = []byte(password)
+	a.databases = databases
+}
+
+// Trigger runs an audit of db right away, or of all the audited databases
+// when db is empty, and returns its results, none if db is not audited. Triggers of the same databases
+// received while an audit is in progress share its results.
+func (a *auditor) Trigger(db string) []*LastAuditResult {
+	a.triggerMu.Lock()
+	if call, ok := a.triggers[db]; ok {
+		a.triggerMu.Unlock()
+		<-call.done
+		return call.results
+	}
+	call := &auditCall{done: make(chan struct{})}
+	a.triggers[db] = call
+	a.triggerMu.Unlock()
+
+	if db == "" {
+		call.results = a.audit()
+	} else {
+		call.results = a.audit(db)
+	}
+
+	a.triggerMu.Lock()
+	delete(a.triggers, db)
+	a.triggerMu.Unlock()
+	close(call.done)
+
+	return call.results
+}
+
+// audit runs a single audit of the given databases, or of all the audited
+// databases when none is given, and returns the result of each of them
+func (a *auditor) audit(databases ...string) []*LastAuditResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	start := time.Now()
+	a.index++
+	a.logger.Infof("audit #%d started @ %s", a.index, start)
+
+	ctx := context.Background()
+	serverID := a.serverID(ctx)
+
+	// failures not related to a specific database are reported without one
+	fail := func(format string, args ...interface{}) []*LastAuditResult {
+		errMsg := fmt.Sprintf(format, args...)
+		a.logger.Errorf("%s", errMsg)
+		a.updateResult(serverID, a.serverAddress, "", false, true, false, nil, nil)
+		a.record(serverID, "", start, false, true, false, errMsg, nil, nil)
+		return []*LastAuditResult{newLastAuditResult(serverID, a.serverAddress, "", false, true, false, nil, nil)}
+	}
+
+	loginResponse, err := a.serviceClient.Login(ctx, &schema.LoginRequest{
+		User:     a.username,
+		Password: a.password,
+	})
+	if err != nil {
+		return fail("error logging in with user %s: %v", a.username, err)
+	}
+	ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", loginResponse.Token))
+	defer a.serviceClient.Logout(ctx, &empty.Empty{})
+
+	audited, err := a.auditedDatabases(ctx)
+	if err != nil {
+		return fail("error getting the list of databases: %v", err)
+	}
+	if len(databases) == 0 {
+		databases = audited
+	}
+	// only the audited databases are audited on demand
+	for _, db := range databases {
+		if !containsString(audited, db) {
+			a.logger.Warningf("audit #%d canceled: database %s is not audited", a.index, db)
+			return []*LastAuditResult{}
+		}
+	}
+	if len(databases) == 0 {
+		a.logger.Warningf("audit #%d canceled: no databases to audit", a.index)
+		return []*LastAuditResult{}
+	}
+
+	results := make([]*LastAuditResult, 0, len(databases))
+	for _, db := range databases {
+		results = append(results, a.auditDatabase(ctx, serverID, db))
+	}
+
+	a.logger.Infof("audit #%d finished in %s @ %s",
+		a.index, time.Since(start), time.Now().Format(time.RFC3339Nano))
+	return results
+}
+
+// auditedDatabases returns the configured databases, or all the loaded
+// databases on the server when none has been configured
+func (a *auditor) auditedDatabases(ctx context.Context) ([]string, error) {
+	if len(a.databases) > 0 {
+		return a.databases, nil
+	}
+
+	res, err := a.serviceClient.DatabaseListV2(ctx, &schema.DatabaseListRequestV2{})
+	if err != nil {
+		return nil, err
+	}
+
+	var databases []string
+	for _, db := range res.GetDatabases() {
+		if !db.GetLoaded() {
+			a.logger.Debugf("audit #%d - skipping database %s: not loaded", a.index, db.GetName())
+			continue
+		}
+		databases = append(databases, db.GetName())
+	}
+	return databases, nil
+}
+
+// containsString reports whether s is one of values
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// auditDatabase checks that the current state of db is consistent with the
+// one cached by the previous audit and caches it when it is
+func (a *auditor) auditDatabase(ctx context.Context, serverID string, db string) (res *LastAuditResult) {
+	start := time.Now()
+	checked := false
+	withError := false
+	verified := true
+	errMsg := ""
+	var prevState, currState *schema.ImmutableState
+
+	defer func() {
+		a.updateResult(serverID, a.serverAddress, db, checked, withError, verified, prevState, currState)
+		a.record(serverID, db, start, checked, withError, verified, errMsg, prevState, currState)
+		res = newLastAuditResult(serverID, a.serverAddress, db, checked, withError, verified, prevState, currState)
+	}()
+
+	fail := func(format string, args ...interface{}) {
+		errMsg = fmt.Sprintf(format, args...)
+		a.logger.Errorf("%s", errMsg)
+		withError = true
+	}
+
+	resp, err := a.serviceClient.UseDatabase(ctx, &schema.Database{DatabaseName: db})
+	if err != nil {
+		fail("error selecting database %s: %v", db, err)
+		return
+	}
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", resp.Token))
+
+	a.logger.Infof("audit #%d - auditing database %s", a.index, db)
+
+	currState, err = a.serviceClient.CurrentState(ctx, &empty.Empty{})
+	if err != nil {
+		fail("error getting current state of database %s: %v", db, err)
+		return
+	}
+
+	if err := a.verifyStateSignature(serverID, currState); err != nil {
+		verified = false
+		fail("audit #%d of database %s aborted: %v", a.index, db, err)
+		return
+	}
+
+	history := a.history(db)
+	prevState, err = history.Get(serverID, db)
+	if err != nil {
+		fail("error reading the previous state of database %s: %v", db, err)
+		return
+	}
+
+	if prevState == nil {
+		if currState.TxId == 0 {
+			a.logger.Warningf("audit #%d of database %s canceled: database is empty on server %s @ %s",
+				a.index, db, serverID, a.serverAddress)
+			return
+		}
+	} else {
+		if currState.TxId == 0 {
+			fail("audit #%d of database %s aborted: database is empty on server %s @ %s, but locally a previous state exists with hash %x at id %d",
+				a.index, db, serverID, a.serverAddress, prevState.TxHash, prevState.TxId)
+			return
+		}
+
+		vtx, err := a.serviceClient.VerifiableTxById(ctx, &schema.VerifiableTxRequest{
+			Tx:           currState.TxId,
+			ProveSinceTx: prevState.TxId,
+		})
+		if err != nil {
+			fail("error fetching consistency proof for previous state %d of database %s: %v", prevState.TxId, db, err)
+			return
+		}
+
+		dualProof := schema.DualProofFromProto(vtx.DualProof)
+		err = schema.FillMissingLinearAdvanceProof(ctx, dualProof, prevState.TxId, currState.TxId, a.serviceClient)
+		if err != nil {
+			fail("error fetching consistency proof for previous state %d of database %s: %v", prevState.TxId, db, err)
+			return
+		}
+
+		verified = store.VerifyDualProof(
+			dualProof,
+			prevState.TxId,
+			currState.TxId,
+			schema.DigestFromProto(prevState.TxHash),
+			schema.DigestFromProto(currState.TxHash),
+		)
+		checked = true
+
+		a.logger.Infof("audit #%d result:\n db: %s, consistent: %t\n previous state: %x at tx: %d\n current state: %x at tx: %d",
+			a.index, db, verified, prevState.TxHash, prevState.TxId, currState.TxHash, currState.TxId)
+	}
+
+	if !verified {
+		a.logger.Warningf("audit #%d detected possible tampering of database %s remote state (at id %d) "+
+			"so it will not overwrite the previous local state (at id %d)", a.index, db, currState.TxId, prevState.TxId)
+		return
+	}
+
+	if prevState == nil || currState.TxId != prevState.TxId {
+		if err := history.Set(serverID, db, currState); err != nil {
+			fail("error saving the current state of database %s: %v", db, err)
+		}
+	}
+	return
+}
+
+// record appends the outcome of the audit of db to the audit history, if any
+func (a *auditor) record(
+	serverID string,
+	db string,
+	start time.Time,
+	checked bool,
+	withError bool,
+	result bool,
+	errMsg string,
+	prevState *schema.ImmutableState,
+	currState *schema.ImmutableState,
+) {
+	if a.recordRun == nil {
+		return
+	}
+	a.recordRun(newAuditRecord(
+		serverID, a.serverAddress, db, start, time.Since(start), checked, withError, result, errMsg, prevState, currState))
+}
+
+// history returns the states cache of db
+func (a *auditor) history(db string) cache.HistoryCache {
+	h, ok := a.histories[db]
+	if !ok {
+		h = cache.NewHistoryFileCache(filepath.Join(a.dir, db))
+		a.histories[db] = h
+	}
+	return h
+}
+
+// serverID returns the immudb server UUID, or a slug of the server address
+// when the server does not provide one
+func (a *auditor) serverID(ctx context.Context) string {
+	serverID, err := a.uuidProvider.CurrentUUID(ctx)
+	if err != nil {
+		if err != state.ErrNoServerUuid {
+			a.logger.Errorf("error getting server UUID: %v", err)
+		} else {
+			a.logger.Warningf(err.Error())
+		}
+	}
+
+	if serverID == "" {
+		serverID = strings.ReplaceAll(strings.ReplaceAll(a.serverAddress, ".", "-"), ":", "_")
+		serverID = serverIDRegExp.ReplaceAllString(serverID, "")
+	}
+	return serverID
+}
+
+// verifyStateSignature checks the state signature against the configured
+// public key. Without a configured key a signed state is only checked against
+// the key embedded in the state itself.
+func (a *auditor) verifyStateSignature(serverID string, serverState *schema.ImmutableState) error {
+	if serverState.GetSignature() == nil {
+		if a.serverSigningPubKey != nil {
+			return fmt.Errorf("a server signing public key has been specified for the auditor, but the state %x at TX %d received from server %s @ %s is not signed",
+				serverState.GetTxHash(), serverState.GetTxId(), serverID, a.serverAddress)
+		}
+		return nil
+	}
+
+	pk := a.serverSigningPubKey
+	if pk == nil {
+		a.logger.Warningf("server signature will be verified using untrusted public key (embedded in the server state payload) " +
+			"- for better security please configure a public key for the auditor")
+		var err error
+		if pk, err = signer.UnmarshalKey(serverState.GetSignature().GetPublicKey()); err != nil {
+			return fmt.Errorf("failed to verify signature for state %x at TX %d received from server %s @ %s: %w",
+				serverState.GetTxHash(), serverState.GetTxId(), serverID, a.serverAddress, err)
+		}
+	}
+
+	if err := serverState.CheckSignature(pk); err != nil {
+		return fmt.Errorf("failed to verify signature for state %x at TX %d received from server %s @ %s: %w",
+			serverState.GetTxHash(), serverState.GetTxId(), serverID, a.serverAddress, err)
+	}
+	return nil
+}
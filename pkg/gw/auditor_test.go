@@ -0,0 +1,242 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb/embedded/logger"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immudb/pkg/auth"
+	immuclient "github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/server"
+	"github.com/codenotary/immudb/pkg/server/servertest"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+type testAuditResult struct {
+	checked   bool
+	withError bool
+	result    bool
+	prevState *schema.ImmutableState
+	currState *schema.ImmutableState
+}
+
+func TestAuditor(t *testing.T) {
+	options := server.DefaultOptions().WithAuth(true).WithDir(t.TempDir())
+	bs := servertest.NewBufconnServer(options)
+
+	bs.Start()
+	defer bs.Stop()
+
+	cliOpts := immuclient.DefaultOptions().
+		WithDir(t.TempDir()).
+		WithDialOptions([]grpc.DialOption{grpc.WithContextDialer(bs.Dialer), grpc.WithInsecure()})
+
+	cli, err := immuclient.NewImmuClient(cliOpts)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = cli.Login(ctx, []byte("immudb"), []byte("immudb"))
+	require.NoError(t, err)
+
+	_, err = cli.CreateDatabaseV2(ctx, "db1", nil)
+	require.NoError(t, err)
+
+	auditorPassword := "Auditor1!"
+	require.NoError(t, cli.CreateUser(ctx, []byte("immugwauditor"), []byte(auditorPassword), auth.PermissionR, "defaultdb"))
+	require.NoError(t, cli.ChangePermission(ctx, schema.PermissionAction_GRANT, "immugwauditor", "db1", auth.PermissionR))
+
+	for _, db := range []string{"defaultdb", "db1"} {
+		_, err = cli.UseDatabase(ctx, &schema.Database{DatabaseName: db})
+		require.NoError(t, err)
+		_, err = cli.Set(ctx, []byte("auditorKey"), []byte(db))
+		require.NoError(t, err)
+	}
+
+	results := make(map[string]testAuditResult)
+	updateResult := func(
+		serverID string,
+		serverAddress string,
+		database string,
+		checked bool,
+		withError bool,
+		result bool,
+		prevState *schema.ImmutableState,
+		currState *schema.ImmutableState,
+	) {
+		require.NotEmpty(t, serverID)
+		require.Equal(t, "bufconn", serverAddress)
+		results[database] = testAuditResult{checked, withError, result, prevState, currState}
+	}
+
+	var records []*AuditRecord
+	recordRun := func(r *AuditRecord) {
+		records = append(records, r)
+	}
+
+	l := logger.NewSimpleLogger("auditor_test", os.Stdout)
+	dir := t.TempDir()
+
+	a, err := newAuditor("bufconn", "immugwauditor", auditorPassword, nil, nil, cli.GetServiceClient(), dir, updateResult, recordRun, l)
+	require.NoError(t, err)
+
+	// the first audit has no previous state to check the consistency with
+	a.audit()
+	require.Len(t, results, 2)
+	for _, db := range []string{"defaultdb", "db1"} {
+		require.False(t, results[db].checked, db)
+		require.False(t, results[db].withError, db)
+		require.Nil(t, results[db].prevState, db)
+		require.NotNil(t, results[db].currState, db)
+	}
+	require.DirExists(t, dir+"/defaultdb")
+	require.DirExists(t, dir+"/db1")
+
+	_, err = cli.UseDatabase(ctx, &schema.Database{DatabaseName: "db1"})
+	require.NoError(t, err)
+	_, err = cli.Set(ctx, []byte("auditorKey"), []byte("db1 v2"))
+	require.NoError(t, err)
+
+	lastResults := a.audit()
+	require.Len(t, lastResults, 2)
+	for _, res := range lastResults {
+		require.True(t, res.HasRunConsistencyCheck, res.Database)
+		require.True(t, res.ConsistencyCheckResult, res.Database)
+		require.False(t, res.HasError, res.Database)
+	}
+	require.Len(t, results, 2)
+	for _, db := range []string{"defaultdb", "db1"} {
+		require.True(t, results[db].checked, db)
+		require.False(t, results[db].withError, db)
+		require.True(t, results[db].result, db)
+	}
+	require.Less(t, results["db1"].prevState.TxId, results["db1"].currState.TxId)
+
+	require.Len(t, records, 4)
+	require.Equal(t, AuditResultUnchecked, records[0].Result)
+	require.Equal(t, AuditResultOK, records[3].Result)
+
+	// a state unrelated to the one of the server is reported as tampered
+	serverID := a.serverID(ctx)
+	tampered := results["db1"].prevState
+	tampered.TxHash = make([]byte, len(tampered.TxHash))
+	require.NoError(t, a.history("db1").Set(serverID, "db1", tampered))
+
+	results = make(map[string]testAuditResult)
+	a.databases = []string{"db1"}
+	a.audit()
+	require.Len(t, results, 1)
+	require.True(t, results["db1"].checked)
+	require.False(t, results["db1"].result)
+
+	// unknown databases are reported with an error
+	results = make(map[string]testAuditResult)
+	a.databases = []string{"missingdb"}
+	lastResults = a.audit()
+	require.Len(t, lastResults, 1)
+	require.True(t, lastResults[0].HasError)
+	require.True(t, results["missingdb"].withError)
+	require.Equal(t, AuditResultError, records[len(records)-1].Result)
+	require.Contains(t, records[len(records)-1].Error, "error selecting database missingdb")
+
+	// on-demand audits are limited to the audited databases
+	recorded := len(records)
+	require.Empty(t, a.Trigger("defaultdb"))
+	a.databases = nil
+	require.Empty(t, a.Trigger("missingdb"))
+	require.Len(t, records, recorded)
+
+	// and are reported and recorded like the scheduled ones
+	results = make(map[string]testAuditResult)
+	lastResults = a.Trigger("defaultdb")
+	require.Len(t, lastResults, 1)
+	require.Equal(t, "defaultdb", lastResults[0].Database)
+	require.True(t, lastResults[0].ConsistencyCheckResult)
+	require.True(t, results["defaultdb"].result)
+	require.Len(t, records, recorded+1)
+	require.Equal(t, "defaultdb", records[recorded].Database)
+
+	a, err = newAuditor("bufconn", "immugwauditor", "wrongpassword", nil, nil, cli.GetServiceClient(), dir, updateResult, nil, l)
+	require.NoError(t, err)
+	results = make(map[string]testAuditResult)
+	lastResults = a.audit()
+	require.Len(t, lastResults, 1)
+	require.Equal(t, "", lastResults[0].Database)
+	require.True(t, lastResults[0].HasError)
+	require.True(t, results[""].withError)
+}
+
+func TestAuditorTriggerCoalescing(t *testing.T) {
+	a := &auditor{triggers: make(map[string]*auditCall)}
+
+	// a trigger received while an audit of the same database is running
+	// waits for it and gets its results
+	call := &auditCall{done: make(chan struct{})}
+	a.triggers["db1"] = call
+
+	triggered := make(chan []*LastAuditResult)
+	go func() { triggered <- a.Trigger("db1") }()
+
+	call.results = []*LastAuditResult{{Database: "db1"}}
+	close(call.done)
+
+	results := <-triggered
+	require.Len(t, results, 1)
+	require.Same(t, call.results[0], results[0])
+}
+
+func TestAuditorRun(t *testing.T) {
+	options := server.DefaultOptions().WithAuth(true).WithDir(t.TempDir())
+	bs := servertest.NewBufconnServer(options)
+
+	bs.Start()
+	defer bs.Stop()
+
+	cliOpts := immuclient.DefaultOptions().
+		WithDir(t.TempDir()).
+		WithDialOptions([]grpc.DialOption{grpc.WithContextDialer(bs.Dialer), grpc.WithInsecure()})
+
+	cli, err := immuclient.NewImmuClient(cliOpts)
+	require.NoError(t, err)
+
+	audited := make(chan string, 16)
+	updateResult := func(_ string, _ string, database string, _ bool, _ bool, _ bool, _ *schema.ImmutableState, _ *schema.ImmutableState) {
+		select {
+		case audited <- database:
+		default:
+		}
+	}
+
+	a, err := newAuditor("bufconn", "immudb", "immudb", nil, nil, cli.GetServiceClient(), t.TempDir(), updateResult, nil, logger.NewSimpleLogger("auditor_test", os.Stdout))
+	require.NoError(t, err)
+
+	stopc := make(chan struct{})
+	donec := make(chan struct{}, 1)
+	go a.Run(time.Hour, stopc, donec)
+
+	require.Equal(t, "defaultdb", <-audited)
+
+	// the next audit follows the new interval
+	a.setInterval(10 * time.Millisecond)
+	require.Equal(t, "defaultdb", <-audited)
+	close(stopc)
+	<-donec
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/cors"
+)
+
+// CORSRoute is the CORS policy of the REST routes under Prefix, whose path
+// segments can be shell patterns, e.g. /db/*/delete. The lists and the max
+// age not set are the ones of the default policy, an empty list of allowed
+// origins disables CORS for the routes.
+type CORSRoute struct {
+	Prefix           string        `mapstructure:"prefix"`
+	AllowedOrigins   []string      `mapstructure:"allowed-origins"`
+	AllowedMethods   []string      `mapstructure:"allowed-methods"`
+	AllowedHeaders   []string      `mapstructure:"allowed-headers"`
+	ExposedHeaders   []string      `mapstructure:"exposed-headers"`
+	AllowCredentials *bool         `mapstructure:"allow-credentials"`
+	MaxAge           time.Duration `mapstructure:"max-age"`
+}
+
+type corsRoute struct {
+	prefix []string
+	cors   *cors.Cors
+}
+
+// corsPolicy is the CORS policy of the REST routes, the one of the first
+// route whose prefix matches the request path or else the default one
+type corsPolicy struct {
+	routes []corsRoute
+	def    *cors.Cors
+}
+
+// newCORSPolicy returns the CORS policy configured by the options
+func newCORSPolicy(o Options) (*corsPolicy, error) {
+	def := CORSRoute{
+		AllowedOrigins:   o.CORSAllowedOrigins,
+		AllowedMethods:   o.CORSAllowedMethods,
+		AllowedHeaders:   o.CORSAllowedHeaders,
+		ExposedHeaders:   o.CORSExposedHeaders,
+		AllowCredentials: &o.CORSAllowCredentials,
+		MaxAge:           o.CORSMaxAge,
+	}
+	c, err := def.cors()
+	if err != nil {
+		return nil, err
+	}
+	p := &corsPolicy{def: c}
+
+	for _, r := range o.CORSRoutes {
+		if !strings.HasPrefix(r.Prefix, "/") {
+			return nil, fmt.Errorf("%w: route prefix %q must start with /", ErrInvalidCORS, r.Prefix)
+		}
+		prefix := pathSegments(r.Prefix)
+		for _, pattern := range prefix {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%w: invalid route prefix %s", ErrInvalidCORS, r.Prefix)
+			}
+		}
+		if r.AllowedOrigins == nil {
+			r.AllowedOrigins = def.AllowedOrigins
+		}
+		if r.AllowedMethods == nil {
+			r.AllowedMethods = def.AllowedMethods
+		}
+		if r.AllowedHeaders == nil {
+			r.AllowedHeaders = def.AllowedHeaders
+		}
+		if r.ExposedHeaders == nil {
+			r.ExposedHeaders = def.ExposedHeaders
+		}
+		if r.AllowCredentials == nil {
+			r.AllowCredentials = def.AllowCredentials
+		}
+		if r.MaxAge == 0 {
+			r.MaxAge = def.MaxAge
+		}
+		c, err := r.cors()
+		if err != nil {
+			return nil, fmt.Errorf("%w (route prefix %s)", err, r.Prefix)
+		}
+		p.routes = append(p.routes, corsRoute{prefix: prefix, cors: c})
+	}
+	return p, nil
+}
+
+func (r CORSRoute) cors() (*cors.Cors, error) {
+	credentials := r.AllowCredentials != nil && *r.AllowCredentials
+	for _, origin := range r.AllowedOrigins {
+		if origin == "*" && credentials {
+			return nil, fmt.Errorf("%w: credentials cannot be allowed for every origin", ErrInvalidCORS)
+		}
+		if strings.Count(origin, "*") > 1 {
+			return nil, fmt.Errorf("%w: origin %s has more than one wildcard", ErrInvalidCORS, origin)
+		}
+	}
+	if r.MaxAge < 0 {
+		return nil, fmt.Errorf("%w: negative max age", ErrInvalidCORS)
+	}
+	o := cors.Options{
+		AllowedOrigins:   r.AllowedOrigins,
+		AllowedMethods:   r.AllowedMethods,
+		AllowedHeaders:   r.AllowedHeaders,
+		ExposedHeaders:   r.ExposedHeaders,
+		AllowCredentials: credentials,
+		MaxAge:           int(r.MaxAge / time.Second),
+	}
+	// an empty list of origins would allow all of them
+	if r.AllowedOrigins != nil && len(r.AllowedOrigins) == 0 {
+		o.AllowOriginFunc = func(string) bool { return false }
+	}
+	return cors.New(o), nil
+}
+
+// forPath returns the CORS policy of the request path p
+func (p *corsPolicy) forPath(urlPath string) *cors.Cors {
+	segments := pathSegments(urlPath)
+	for _, r := range p.routes {
+		if matchPathPrefix(r.prefix, segments) {
+			return r.cors
+		}
+	}
+	return p.def
+}
+
+func pathSegments(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// matchPathPrefix reports whether the first path segments match the prefix
+// patterns
+func matchPathPrefix(prefix []string, segments []string) bool {
+	if len(prefix) > len(segments) {
+		return false
+	}
+	for i, pattern := range prefix {
+		if ok, _ := path.Match(pattern, segments[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// corsHandler applies the current CORS policy, replaced on configuration
+// reloads
+type corsHandler struct {
+	mu     sync.RWMutex
+	policy *corsPolicy
+}
+
+// load replaces the CORS policy with the one configured by the options. The
+// current policy is kept when the options are not valid.
+func (c *corsHandler) load(o Options) error {
+	p, err := newCORSPolicy(o)
+	if err != nil {
+		return err
+	}
+	c.set(p)
+	return nil
+}
+
+// set replaces the CORS policy with p
+func (c *corsHandler) set(p *corsPolicy) {
+	c.mu.Lock()
+	c.policy = p
+	c.mu.Unlock()
+}
+
+// handler handles the CORS requests, preflight ones included, before h
+func (c *corsHandler) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.mu.RLock()
+		p := c.policy
+		c.mu.RUnlock()
+		p.forPath(req.URL.Path).ServeHTTP(w, req, h.ServeHTTP)
+	})
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb/embedded/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func corsRequest(t *testing.T, h http.Handler, method string, target string, origin string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Origin", origin)
+	if method == http.MethodOptions {
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestNewCORSPolicy(t *testing.T) {
+	allow := true
+	for _, o := range []Options{
+		DefaultOptions().WithCORSAllowCredentials(true),
+		DefaultOptions().WithCORSAllowedOrigins([]string{"https://*.*.example.com"}),
+		DefaultOptions().WithCORSMaxAge(-time.Second),
+		DefaultOptions().WithCORSRoutes([]CORSRoute{{Prefix: "db"}}),
+		DefaultOptions().WithCORSRoutes([]CORSRoute{{Prefix: "/db/[/delete"}}),
+		DefaultOptions().WithCORSRoutes([]CORSRoute{{Prefix: "/db", AllowCredentials: &allow}}),
+	} {
+		_, err := newCORSPolicy(o)
+		require.ErrorIs(t, err, ErrInvalidCORS)
+	}
+
+	p, err := newCORSPolicy(DefaultOptions().
+		WithCORSAllowedOrigins([]string{"https://*.example.com"}).
+		WithCORSRoutes([]CORSRoute{{Prefix: "/db/*/delete", AllowedOrigins: []string{"https://admin.example.com"}}}))
+	require.NoError(t, err)
+	require.Len(t, p.routes, 1)
+	require.Equal(t, []string{"db", "*", "delete"}, p.routes[0].prefix)
+	require.Equal(t, p.def, p.forPath("/db/delete"))
+	require.Equal(t, p.routes[0].cors, p.forPath("/db/db1/delete/"))
+}
+
+func TestMatchPathPrefix(t *testing.T) {
+	require.True(t, matchPathPrefix(nil, pathSegments("/login")))
+	require.True(t, matchPathPrefix(pathSegments("/user"), pathSegments("/user/list")))
+	require.True(t, matchPathPrefix(pathSegments("/db/*"), pathSegments("/db/db1/set")))
+	require.False(t, matchPathPrefix(pathSegments("/user"), pathSegments("/users")))
+	require.False(t, matchPathPrefix(pathSegments("/db/*/set"), pathSegments("/db/db1")))
+}
+
+func TestCORSHandler(t *testing.T) {
+	allow := true
+	o := DefaultOptions().
+		WithCORSAllowedOrigins([]string{"https://*.example.com"}).
+		WithCORSExposedHeaders([]string{RequestIDHeader}).
+		WithCORSRoutes([]CORSRoute{
+			{
+				Prefix:           "/user",
+				AllowedOrigins:   []string{"https://admin.example.com"},
+				AllowCredentials: &allow,
+				MaxAge:           10 * time.Minute,
+			},
+			{
+				Prefix:         "/db/*/delete",
+				AllowedOrigins: []string{},
+			},
+		})
+
+	c := &corsHandler{}
+	require.NoError(t, c.load(o))
+	h := c.handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := corsRequest(t, h, http.MethodGet, "/db/db1/get/key1", "https://app.example.com")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, RequestIDHeader, w.Header().Get("Access-Control-Expose-Headers"))
+
+	w = corsRequest(t, h, http.MethodGet, "/db/db1/get/key1", "https://example.org")
+	require.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = corsRequest(t, h, http.MethodOptions, "/db/db1/set", "https://app.example.com")
+	require.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, http.MethodPost, w.Header().Get("Access-Control-Allow-Methods"))
+	require.Empty(t, w.Header().Get("Access-Control-Max-Age"))
+
+	// the user routes are only available to the admin console, with credentials
+	w = corsRequest(t, h, http.MethodOptions, "/user/list", "https://app.example.com")
+	require.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = corsRequest(t, h, http.MethodOptions, "/user/list", "https://admin.example.com")
+	require.Equal(t, "https://admin.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	require.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+
+	// the deletions are not available to the browsers
+	w = corsRequest(t, h, http.MethodOptions, "/db/db1/delete", "https://app.example.com")
+	require.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	// the policy is replaced on reloads, an invalid one is not applied
+	require.ErrorIs(t, c.load(o.WithCORSAllowCredentials(true).WithCORSAllowedOrigins([]string{"*"})), ErrInvalidCORS)
+	w = corsRequest(t, h, http.MethodGet, "/db/db1/get/key1", "https://example.org")
+	require.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	require.NoError(t, c.load(o.WithCORSAllowedOrigins([]string{"https://example.org"})))
+	w = corsRequest(t, h, http.MethodGet, "/db/db1/get/key1", "https://example.org")
+	require.Equal(t, "https://example.org", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestImmuGwServer_ReloadCORS(t *testing.T) {
+	gw := &ImmuGwServer{
+		Options: DefaultOptions(),
+		Logger:  logger.NewSimpleLogger("test", os.Stdout),
+		cors:    &corsHandler{},
+	}
+	require.NoError(t, gw.cors.load(gw.Options))
+	def := gw.cors.policy.def
+
+	next := gw.Options.WithCORSAllowedOrigins([]string{"https://app.example.com"})
+	gw.WithOptionsLoader(func() (Options, error) { return next, nil })
+	require.NoError(t, gw.Reload())
+	require.Equal(t, []string{"https://app.example.com"}, gw.Options.CORSAllowedOrigins)
+	require.NotEqual(t, def, gw.cors.policy.def)
+
+	gw.WithOptionsLoader(func() (Options, error) { return next.WithCORSMaxAge(-time.Second), nil })
+	require.ErrorIs(t, gw.Reload(), ErrInvalidCORS)
+	require.Equal(t, time.Duration(0), gw.Options.CORSMaxAge)
+}
@@ -45,13 +45,13 @@ var _ = utilities.NewDoubleArray
 var _ = descriptor.ForMessage
 var _ = metadata.Join
 
-// getClientForDb returns a client for the given database
-func getClientForDb(pathParams map[string]string, gwclient immugwclient.Client) (schema.ImmuServiceClient, error) {
+// getClientForDb returns the client of the user of the request for the given database
+func getClientForDb(req *http.Request, pathParams map[string]string, gwclient immugwclient.Client) (schema.ImmuServiceClient, error) {
 	databasename, ok := pathParams["databaseName"]
 	if !ok {
 		return nil, status.Errorf(codes.InvalidArgument, "missing parameter %s", "databaseName")
 	}
-	cli, err := gwclient.For(databasename)
+	cli, err := clientFor(gwclient, req, databasename)
 	if err != nil {
 		return nil, err
 	}
@@ -840,7 +840,7 @@ func request_ImmuService_DescribeTable_0(ctx context.Context, marshaler runtime.
 // "immugwclient.Client" to call the correct interceptors.
 func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux, gwclient immugwclient.Client, defaultClient schema.ImmuServiceClient) error {
 
-	mux.Handle("GET", api.Pattern_ImmuService_ListUsers_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "ListUsers", "GET", api.Pattern_ImmuService_ListUsers_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -861,7 +861,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_CreateUser_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "CreateUser", "POST", api.Pattern_ImmuService_CreateUser_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -882,7 +882,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_ChangePassword_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "ChangePassword", "POST", api.Pattern_ImmuService_ChangePassword_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -903,7 +903,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_ChangePermission_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "ChangePermission", "POST", api.Pattern_ImmuService_ChangePermission_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -924,7 +924,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_SetActiveUser_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "SetActiveUser", "POST", api.Pattern_ImmuService_SetActiveUser_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -945,7 +945,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_Login_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "Login", "POST", api.Pattern_ImmuService_Login_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -966,7 +966,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_Logout_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "Logout", "POST", api.Pattern_ImmuService_Logout_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -982,12 +982,14 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
 			return
 		}
+		// the clients of the user are dropped with its token
+		gwclient.Logout(requestUser(req))
 
 		forward_ImmuService_Logout_0(ctx, mux, outboundMarshaler, w, req, resp, mux.GetForwardResponseOptions()...)
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_Set_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "Set", "POST", api.Pattern_ImmuService_Set_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -997,7 +999,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1014,7 +1016,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("GET", api.Pattern_ImmuService_Get_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "Get", "GET", api.Pattern_ImmuService_Get_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1024,7 +1026,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1041,7 +1043,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_Delete_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "Delete", "POST", api.Pattern_ImmuService_Delete_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1051,7 +1053,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1068,7 +1070,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_GetAll_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "GetAll", "POST", api.Pattern_ImmuService_GetAll_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1078,7 +1080,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1095,7 +1097,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_ExecAll_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "ExecAll", "POST", api.Pattern_ImmuService_ExecAll_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1105,7 +1107,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1122,7 +1124,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_Scan_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "Scan", "POST", api.Pattern_ImmuService_Scan_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1132,7 +1134,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1149,7 +1151,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("GET", api.Pattern_ImmuService_Count_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "Count", "GET", api.Pattern_ImmuService_Count_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1159,7 +1161,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1176,7 +1178,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("GET", api.Pattern_ImmuService_CountAll_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "CountAll", "GET", api.Pattern_ImmuService_CountAll_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1186,7 +1188,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1203,7 +1205,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("GET", api.Pattern_ImmuService_TxById_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "TxById", "GET", api.Pattern_ImmuService_TxById_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1213,7 +1215,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1230,7 +1232,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_TxScan_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "TxScan", "POST", api.Pattern_ImmuService_TxScan_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1240,7 +1242,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1257,7 +1259,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_History_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "History", "POST", api.Pattern_ImmuService_History_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1267,7 +1269,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1284,7 +1286,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("GET", api.Pattern_ImmuService_ServerInfo_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "ServerInfo", "GET", api.Pattern_ImmuService_ServerInfo_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1305,7 +1307,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("GET", api.Pattern_ImmuService_Health_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "Health", "GET", api.Pattern_ImmuService_Health_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1315,7 +1317,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1332,7 +1334,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("GET", api.Pattern_ImmuService_DatabaseHealth_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "DatabaseHealth", "GET", api.Pattern_ImmuService_DatabaseHealth_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1342,7 +1344,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1359,7 +1361,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("GET", api.Pattern_ImmuService_CurrentState_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "CurrentState", "GET", api.Pattern_ImmuService_CurrentState_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1369,7 +1371,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1386,7 +1388,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_SetReference_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "SetReference", "POST", api.Pattern_ImmuService_SetReference_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1396,7 +1398,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1413,7 +1415,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_ZAdd_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "ZAdd", "POST", api.Pattern_ImmuService_ZAdd_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1423,7 +1425,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1440,7 +1442,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_ZScan_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "ZScan", "POST", api.Pattern_ImmuService_ZScan_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1450,7 +1452,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1467,7 +1469,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_CreateDatabase_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "CreateDatabase", "POST", api.Pattern_ImmuService_CreateDatabase_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1477,7 +1479,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1494,7 +1496,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_CreateDatabaseWith_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "CreateDatabaseWith", "POST", api.Pattern_ImmuService_CreateDatabaseWith_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1504,7 +1506,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1521,7 +1523,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_CreateDatabaseV2_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "CreateDatabaseV2", "POST", api.Pattern_ImmuService_CreateDatabaseV2_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1531,7 +1533,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1548,7 +1550,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_LoadDatabase_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "LoadDatabase", "POST", api.Pattern_ImmuService_LoadDatabase_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1558,7 +1560,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1575,7 +1577,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_UnloadDatabase_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "UnloadDatabase", "POST", api.Pattern_ImmuService_UnloadDatabase_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1585,7 +1587,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1602,7 +1604,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_DeleteDatabase_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "DeleteDatabase", "POST", api.Pattern_ImmuService_DeleteDatabase_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1612,7 +1614,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1629,7 +1631,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_DatabaseList_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "DatabaseList", "POST", api.Pattern_ImmuService_DatabaseList_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1639,7 +1641,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1656,7 +1658,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_DatabaseListV2_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "DatabaseListV2", "POST", api.Pattern_ImmuService_DatabaseListV2_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1666,7 +1668,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1683,7 +1685,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_UpdateDatabase_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "UpdateDatabase", "POST", api.Pattern_ImmuService_UpdateDatabase_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1693,7 +1695,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1710,7 +1712,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_UpdateDatabaseV2_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "UpdateDatabaseV2", "POST", api.Pattern_ImmuService_UpdateDatabaseV2_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1720,7 +1722,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1737,7 +1739,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_GetDatabaseSettings_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "GetDatabaseSettings", "POST", api.Pattern_ImmuService_GetDatabaseSettings_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1747,7 +1749,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1764,7 +1766,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_GetDatabaseSettingsV2_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "GetDatabaseSettingsV2", "POST", api.Pattern_ImmuService_GetDatabaseSettingsV2_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1774,7 +1776,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1791,7 +1793,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("GET", api.Pattern_ImmuService_FlushIndex_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "FlushIndex", "GET", api.Pattern_ImmuService_FlushIndex_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1801,7 +1803,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1818,7 +1820,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("GET", api.Pattern_ImmuService_CompactIndex_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "CompactIndex", "GET", api.Pattern_ImmuService_CompactIndex_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1828,7 +1830,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1845,7 +1847,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_SQLExec_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "SQLExec", "POST", api.Pattern_ImmuService_SQLExec_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1855,7 +1857,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1872,7 +1874,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_SQLQuery_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "SQLQuery", "POST", api.Pattern_ImmuService_SQLQuery_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1882,7 +1884,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1899,7 +1901,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("GET", api.Pattern_ImmuService_ListTables_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "ListTables", "GET", api.Pattern_ImmuService_ListTables_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1909,7 +1911,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -1926,7 +1928,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 
 	})
 
-	mux.Handle("POST", api.Pattern_ImmuService_DescribeTable_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	handleRoute(mux, "DescribeTable", "POST", api.Pattern_ImmuService_DescribeTable_0, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
@@ -1936,7 +1938,7 @@ func RegisterImmuServiceHandlerClient(ctx context.Context, mux *runtime.ServeMux
 			return
 		}
 
-		client, err := getClientForDb(pathParams, gwclient)
+		client, err := getClientForDb(req, pathParams, gwclient)
 		if err != nil {
 			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -18,40 +18,287 @@ package gw
 
 import (
 	"errors"
+	"net/http"
 	"strings"
 
+	"github.com/codenotary/immudb/embedded"
+	"github.com/codenotary/immudb/embedded/store"
+	immuerrors "github.com/codenotary/immudb/pkg/client/errors"
+	"github.com/codenotary/immudb/pkg/database"
 	"github.com/codenotary/immudb/pkg/server"
+	"github.com/codenotary/immudb/pkg/signer"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 // sdk errors
 var (
-	ErrKeyNotFound   = status.Error(codes.Unknown, "key not found")
-	ErrCorruptedData = status.Error(codes.Aborted, "data is corrupted") // codes.Aborted is translated in StatusConflict 409 http error
+	ErrKeyNotFound           = status.Error(codes.Unknown, "key not found")
+	ErrCorruptedData         = status.Error(codes.Aborted, "data is corrupted")                    // codes.Aborted is translated in StatusConflict 409 http error
+	ErrInvalidStateSignature = status.Error(codes.DataLoss, "state signature verification failed") // codes.DataLoss is translated in StatusInternalServerError 500 http error
 )
 
-// wrap server errors which are not constants in immudb
+// wrap server errors which are not constants in immudb. The errors of the
+// immudb server which are not gRPC errors reach the gateway as gRPC errors of
+// the Unknown code with their message.
 var (
-	ErrIllegalArgument   = errors.New("illegal arguments: empty key")
-	ErrKeyNotFoundTBTree = errors.New("tbtree: key not found")
+	ErrIllegalArgument         = status.Error(codes.Unknown, "illegal arguments: empty key")
+	ErrKeyNotFoundTBTree       = status.Error(codes.Unknown, store.ErrKeyNotFound.Error())
+	ErrServerCorruptedData     = status.Error(codes.Unknown, store.ErrCorruptedData.Error())
+	ErrServerDatabaseNotExists = status.Error(codes.Unknown, database.ErrDatabaseNotExists.Error())
+	ErrServerAlreadyClosed     = status.Error(codes.Unknown, store.ErrAlreadyClosed.Error())
+	ErrNoStateSignature        = errors.New("no signature provided")
+	ErrStateSignature          = errors.New("unable to verify signature")
 )
 
+// audit configuration errors
 var (
-	StatusErrKeyNotFound   = status.Error(codes.NotFound, "")
-	StatusDatabaseNotFound = status.Error(codes.NotFound, "")
+	ErrInvalidAuditSignature      = errors.New("invalid audit signature mode, allowed values are ignore and validate")
+	ErrInvalidAuditInterval       = errors.New("invalid audit interval, it must be positive")
+	ErrAuditSigningPubKeyRequired = errors.New("audit signature mode validate requires a server signing public key")
+	ErrNotificationSecretRequired = errors.New("audit notifications require a secret to sign them with")
+	ErrInvalidNotificationRetry   = errors.New("invalid audit notification retry interval, it must be positive")
 )
 
+// REST listener TLS configuration errors
+var (
+	ErrTLSKeyPairRequired   = errors.New("tls requires both a certificate and a private key")
+	ErrTLSCertificateNeeded = errors.New("tls client certificate verification requires a tls certificate and a private key")
+	ErrInvalidTLSMinVersion = errors.New("invalid tls minimum version, allowed values are 1.0, 1.1, 1.2 and 1.3")
+	ErrInvalidTLSClientCAs  = errors.New("no valid certificate found in the tls client CAs file")
+)
+
+// tracing configuration errors
+var (
+	ErrInvalidTracingExporter    = errors.New("invalid tracing exporter, allowed values are otlp, stdout and file")
+	ErrTracingFileRequired       = errors.New("the file tracing exporter requires a tracing file")
+	ErrInvalidTracingSampleRatio = errors.New("invalid tracing sample ratio, it must be between 0 and 1")
+)
+
+// API key errors
+var (
+	ErrInvalidAPIKeys  = errors.New("invalid API keys")
+	ErrAPIKeysDisabled = status.Error(codes.Unauthenticated, "API keys are not enabled")
+	ErrInvalidAPIKey   = status.Error(codes.Unauthenticated, "invalid API key")
+)
+
+// JWT authentication errors
+var (
+	ErrJWTIssuerRequired  = errors.New("JWT authentication requires an issuer")
+	ErrJWTMappingRequired = errors.New("JWT authentication requires a claims mapping file")
+	ErrInvalidJWKS        = errors.New("invalid JWKS")
+	ErrInvalidJWTMapping  = errors.New("invalid JWT claims mapping")
+	ErrInvalidJWT         = status.Error(codes.Unauthenticated, "invalid token")
+	ErrJWTExpired         = status.Error(codes.Unauthenticated, "token has expired")
+	ErrJWTNotMapped       = status.Error(codes.PermissionDenied, "token not mapped to an immudb user")
+)
+
+// route policy errors
+var (
+	ErrInvalidPolicy = errors.New("invalid route policy")
+	ErrPolicyDenied  = status.Error(codes.PermissionDenied, "route denied by policy")
+)
+
+// rate limit errors
+var (
+	ErrInvalidRateLimits = errors.New("invalid rate limits")
+	ErrRateLimited       = status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	ErrTooManyInFlight   = status.Error(codes.ResourceExhausted, "too many requests in flight")
+)
+
+// request body errors
+var (
+	ErrInvalidMaxBodySize = errors.New("invalid maximum body size, it cannot be negative")
+	ErrBodyTooLarge       = status.Error(codes.ResourceExhausted, "request body too large")
+	ErrTrailingData       = errors.New("unexpected data after the request body")
+	ErrLengthRequired     = status.Error(codes.InvalidArgument, "content length required")
+	ErrUnsupportedType    = status.Error(codes.InvalidArgument, "content type must be application/octet-stream")
+)
+
+// identity errors
+var (
+	ErrRouteDenied    = status.Error(codes.PermissionDenied, "route not allowed for the identity")
+	ErrDatabaseDenied = status.Error(codes.PermissionDenied, "database not allowed for the identity")
+)
+
+// configuration errors
+var (
+	ErrInvalidLogLevel       = errors.New("invalid log level, allowed values are debug, info, warn and error")
+	ErrReloadNotSupported    = errors.New("configuration reload is not supported")
+	ErrSettingsNotReloadable = errors.New("settings changed but not applied, a restart is required")
+	ErrUnknownHealthCheck    = errors.New("unknown health check")
+	ErrInvalidCORS           = errors.New("invalid CORS configuration")
+)
+
+var (
+	StatusErrKeyNotFound   = status.Error(codes.NotFound, "key not found")
+	StatusDatabaseNotFound = status.Error(codes.NotFound, "database does not exist")
+	ErrDatabaseNotLoaded   = status.Error(codes.FailedPrecondition, "database is not loaded")
+)
+
+// ErrorCode is the stable machine readable code of the REST error responses
+type ErrorCode string
+
+// codes of the immudb errors
+const (
+	CodeKeyNotFound           ErrorCode = "KEY_NOT_FOUND"
+	CodeDataCorrupted         ErrorCode = "DATA_CORRUPTED"
+	CodeInvalidStateSignature ErrorCode = "INVALID_STATE_SIGNATURE"
+	CodeIllegalArguments      ErrorCode = "ILLEGAL_ARGUMENTS"
+	CodeDatabaseNotFound      ErrorCode = "DATABASE_NOT_FOUND"
+	CodeDatabaseNotLoaded     ErrorCode = "DATABASE_NOT_LOADED"
+)
+
+// codes of the gateway errors
+const (
+	CodeBodyTooLarge    ErrorCode = "BODY_TOO_LARGE"
+	CodeLengthRequired  ErrorCode = "LENGTH_REQUIRED"
+	CodeUnsupportedType ErrorCode = "UNSUPPORTED_MEDIA_TYPE"
+	CodeAPIKeysDisabled ErrorCode = "API_KEYS_DISABLED"
+	CodeInvalidAPIKey   ErrorCode = "INVALID_API_KEY"
+	CodeInvalidToken    ErrorCode = "INVALID_TOKEN"
+	CodeTokenExpired    ErrorCode = "TOKEN_EXPIRED"
+	CodeTokenNotMapped  ErrorCode = "TOKEN_NOT_MAPPED"
+	CodePolicyDenied    ErrorCode = "POLICY_DENIED"
+	CodeRouteDenied     ErrorCode = "ROUTE_DENIED"
+	CodeDatabaseDenied  ErrorCode = "DATABASE_DENIED"
+	CodeRateLimited     ErrorCode = "RATE_LIMITED"
+	CodeTooManyInFlight ErrorCode = "TOO_MANY_IN_FLIGHT"
+)
+
+// grpcErrorCodes are the codes of the errors without a mapping, the names of
+// their gRPC code
+var grpcErrorCodes = map[codes.Code]ErrorCode{
+	codes.Canceled:           "CANCELLED",
+	codes.Unknown:            "UNKNOWN",
+	codes.InvalidArgument:    "INVALID_ARGUMENT",
+	codes.DeadlineExceeded:   "DEADLINE_EXCEEDED",
+	codes.NotFound:           "NOT_FOUND",
+	codes.AlreadyExists:      "ALREADY_EXISTS",
+	codes.PermissionDenied:   "PERMISSION_DENIED",
+	codes.ResourceExhausted:  "RESOURCE_EXHAUSTED",
+	codes.FailedPrecondition: "FAILED_PRECONDITION",
+	codes.Aborted:            "ABORTED",
+	codes.OutOfRange:         "OUT_OF_RANGE",
+	codes.Unimplemented:      "UNIMPLEMENTED",
+	codes.Internal:           "INTERNAL",
+	codes.Unavailable:        "UNAVAILABLE",
+	codes.DataLoss:           "DATA_LOSS",
+	codes.Unauthenticated:    "UNAUTHENTICATED",
+}
+
+// errorMapping maps the errors matching it to the gRPC error err and to the
+// error code of the REST responses
+type errorMapping struct {
+	// errs are matched with errors.Is, the errors of the immudb server by
+	// the gRPC errors they reach the gateway as
+	errs []error
+	// immudbCode matches the immudb errors with the code, if not empty
+	immudbCode immuerrors.Code
+	// match matches the errors which have neither a value nor a code to be
+	// matched with, if not nil
+	match func(err error) bool
+
+	err  error
+	code ErrorCode
+	// httpStatus is the HTTP status of the responses, the one of the gRPC
+	// code of err if 0
+	httpStatus int
+}
+
+// errorMappings are evaluated in order, the first matching one applies
+var errorMappings = []errorMapping{
+	{
+		errs: []error{ErrKeyNotFound, embedded.ErrKeyNotFound, ErrKeyNotFoundTBTree},
+		err:  StatusErrKeyNotFound,
+		code: CodeKeyNotFound,
+	},
+	{
+		errs: []error{store.ErrCorruptedData, ErrServerCorruptedData},
+		err:  ErrCorruptedData,
+		code: CodeDataCorrupted,
+	},
+	{
+		errs:  []error{signer.ErrKeyCannotBeVerified},
+		match: stateSignatureFailure,
+		err:   ErrInvalidStateSignature,
+		code:  CodeInvalidStateSignature,
+	},
+	{
+		errs: []error{ErrIllegalArgument, store.ErrIllegalArguments},
+		err:  server.ErrIllegalArguments,
+		code: CodeIllegalArguments,
+	},
+	{
+		errs:       []error{database.ErrDatabaseNotExists, ErrServerDatabaseNotExists},
+		immudbCode: immuerrors.CodInvalidDatabaseName,
+		err:        StatusDatabaseNotFound,
+		code:       CodeDatabaseNotFound,
+	},
+	{
+		errs: []error{store.ErrAlreadyClosed, ErrServerAlreadyClosed},
+		err:  ErrDatabaseNotLoaded,
+		code: CodeDatabaseNotLoaded,
+	},
+	{err: ErrBodyTooLarge, code: CodeBodyTooLarge, httpStatus: http.StatusRequestEntityTooLarge},
+	{err: ErrLengthRequired, code: CodeLengthRequired, httpStatus: http.StatusLengthRequired},
+	{err: ErrUnsupportedType, code: CodeUnsupportedType, httpStatus: http.StatusUnsupportedMediaType},
+	{err: ErrAPIKeysDisabled, code: CodeAPIKeysDisabled},
+	{err: ErrInvalidAPIKey, code: CodeInvalidAPIKey},
+	{err: ErrInvalidJWT, code: CodeInvalidToken},
+	{err: ErrJWTExpired, code: CodeTokenExpired},
+	{err: ErrJWTNotMapped, code: CodeTokenNotMapped},
+	{err: ErrPolicyDenied, code: CodePolicyDenied},
+	{err: ErrRouteDenied, code: CodeRouteDenied},
+	{err: ErrDatabaseDenied, code: CodeDatabaseDenied},
+	{err: ErrRateLimited, code: CodeRateLimited},
+	{err: ErrTooManyInFlight, code: CodeTooManyInFlight},
+}
+
+// matches reports whether err matches m
+func (m *errorMapping) matches(err error) bool {
+	if errors.Is(err, m.err) {
+		return true
+	}
+	for _, e := range m.errs {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	if m.immudbCode != "" && immuerrors.FromError(err).Code() == m.immudbCode {
+		return true
+	}
+	return m.match != nil && m.match(err)
+}
+
+// stateSignatureFailure reports whether err is a failed check of the
+// signature of a state by the immudb client. It is the only error matched by
+// its message: the check creates the error of a missing signature on the fly,
+// and the signature verifier interceptor of the client formats the error of
+// the check into the message of an InvalidArgument gRPC error.
+func stateSignatureFailure(err error) bool {
+	msg := status.Convert(err).Message()
+	if strings.HasSuffix(msg, ErrNoStateSignature.Error()) {
+		return true
+	}
+	return status.Code(err) == codes.InvalidArgument && strings.HasPrefix(msg, ErrStateSignature.Error()+": ")
+}
+
+// lookupError returns the mapping of err, nil if there is none
+func lookupError(err error) *errorMapping {
+	for i := range errorMappings {
+		if errorMappings[i].matches(err) {
+			return &errorMappings[i]
+		}
+	}
+	return nil
+}
+
+// mapSdkError returns the gRPC error err is mapped to, err itself if it is
+// not mapped
 func mapSdkError(err error) error {
-	switch {
-	case errors.Is(err, ErrKeyNotFound):
-		return StatusErrKeyNotFound
-	case strings.HasPrefix(err.Error(), "data is corrupted"):
-		return ErrCorruptedData
-	case strings.HasSuffix(err.Error(), ErrIllegalArgument.Error()):
-		return server.ErrIllegalArguments
-	case strings.HasSuffix(err.Error(), ErrKeyNotFoundTBTree.Error()):
-		return StatusErrKeyNotFound
+	if m := lookupError(err); m != nil {
+		return m.err
 	}
 	return err
 }
@@ -17,6 +17,12 @@ package gw
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"log"
@@ -38,6 +44,7 @@ import (
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -72,6 +79,8 @@ func TestGw(t *testing.T) {
 	testHistoryHandler(t, mux, client, opts)
 	testVerifiedSetReferenceHandler(t, mux, client, opts)
 	testVerifiedZaddHandler(t, mux, client, opts)
+	testVerifiedScanHandler(t, mux, client, opts)
+	testVerifiedHistoryHandler(t, mux, client, opts)
 }
 
 func TestAuthGw(t *testing.T) {
@@ -124,6 +133,107 @@ func TestAuthGw(t *testing.T) {
 	testUseDatabaseHandler(t, ctx, mux, client, opts)
 }
 
+func TestSignedGw(t *testing.T) {
+	dir := t.TempDir()
+	signingKey, pubKey := writeTestSigningKeys(t, dir, "signing")
+	_, otherPubKey := writeTestSigningKeys(t, dir, "other")
+
+	options := server.DefaultOptions().WithAuth(false).WithDir(t.TempDir()).WithSigningKey(signingKey)
+	bs := servertest.NewBufconnServer(options)
+
+	bs.Start()
+	defer bs.Stop()
+
+	mux := runtime.NewServeMux(runtime.WithProtoErrorHandler(api.DefaultGWErrorHandler))
+	dialOptions := []grpc.DialOption{grpc.WithContextDialer(bs.Dialer), grpc.WithInsecure()}
+
+	validKey := base64.StdEncoding.EncodeToString([]byte("signedKey1"))
+	validValue := base64.StdEncoding.EncodeToString([]byte("signedValue1"))
+	setPayload := fmt.Sprintf(`{"setRequest": {"KVs": [{"key": "%s", "value": "%s"}]}}`, validKey, validValue)
+	getPayload := fmt.Sprintf(`{"keyRequest": {"key": "%s"}}`, validKey)
+
+	for _, tc := range []struct {
+		name     string
+		pubKey   string
+		testFunc func(*testing.T, string, int, map[string]interface{})
+	}{
+		{
+			"Expected server signing key",
+			pubKey,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusOK, status)
+			},
+		},
+		{
+			"Unexpected server signing key",
+			otherPubKey,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusInternalServerError, status)
+				expected := map[string]interface{}{"code": float64(codes.DataLoss), "message": "state signature verification failed"}
+				requireResponseFieldsEqual(t, testCase, expected, body)
+			},
+		},
+	} {
+		opts := client.DefaultOptions().
+			WithDialOptions(dialOptions).
+			WithAuth(false).
+			WithDir(t.TempDir()).
+			WithServerSigningPubKey(tc.pubKey)
+		client := immugwclient.New(opts)
+		_, err := client.Add("defaultdb")
+		require.NoError(t, err)
+
+		rt := newDefaultRuntime()
+		defaultJSON := json.DefaultJSON()
+		ssh := NewVerifiedSetHandler(mux, client, rt, defaultJSON)
+		sgh := NewVerifiedGetHandler(mux, client, rt, defaultJSON)
+
+		err = testHandler(
+			t,
+			fmt.Sprintf("SignedGw - VerifiedSet - Test case: %s", tc.name),
+			http.MethodPost,
+			"/db/defaultdb/verified/set",
+			setPayload,
+			func(res http.ResponseWriter, req *http.Request) {
+				ssh.VerifiedSet(res, req, defaultTestParams)
+			},
+			tc.testFunc,
+		)
+		require.NoError(t, err)
+
+		err = testHandler(
+			t,
+			fmt.Sprintf("SignedGw - VerifiedGet - Test case: %s", tc.name),
+			http.MethodPost,
+			"/db/defaultdb/verified/get",
+			getPayload,
+			func(res http.ResponseWriter, req *http.Request) {
+				sgh.VerifiedGet(res, req, defaultTestParams)
+			},
+			tc.testFunc,
+		)
+		require.NoError(t, err)
+	}
+}
+
+// writeTestSigningKeys writes a new ECDSA key pair in PEM format to dir and
+// returns the private and public key paths
+func writeTestSigningKeys(t *testing.T, dir string, name string) (string, string) {
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	privateKeyBytes, err := x509.MarshalECPrivateKey(pk)
+	require.NoError(t, err)
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&pk.PublicKey)
+	require.NoError(t, err)
+
+	privateKeyPath := filepath.Join(dir, name+".key.pem")
+	publicKeyPath := filepath.Join(dir, name+".pub.pem")
+	require.NoError(t, os.WriteFile(privateKeyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateKeyBytes}), 0600))
+	require.NoError(t, os.WriteFile(publicKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes}), 0600))
+	return privateKeyPath, publicKeyPath
+}
+
 func testHandler(
 	t *testing.T,
 	name string,
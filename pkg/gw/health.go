@@ -0,0 +1,194 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	immugwclient "github.com/codenotary/immugw/pkg/client"
+	"github.com/codenotary/immugw/pkg/json"
+	"github.com/golang/protobuf/ptypes/empty"
+)
+
+// health checks of the /livez and /readyz endpoints
+const (
+	HealthCheckImmudb    = "immudb"
+	HealthCheckClients   = "clients"
+	HealthCheckStateDirs = "state-dirs"
+	HealthCheckAudit     = "audit"
+)
+
+const (
+	healthStatusOK     = "ok"
+	healthStatusFailed = "failed"
+	healthCheckTimeout = 5 * time.Second
+)
+
+// healthCheck is a named check, the check passes when it returns no error
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// healthCheckResult is the outcome of a single check
+type healthCheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthReport is the JSON response of the /livez and /readyz endpoints
+type healthReport struct {
+	Status string              `json:"status"`
+	Checks []healthCheckResult `json:"checks"`
+}
+
+// healthHandler runs the checks and answers 200 when all of them pass, 503
+// otherwise
+func healthHandler(checks []healthCheck, json json.JSON) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), healthCheckTimeout)
+		defer cancel()
+
+		report := healthReport{Status: healthStatusOK, Checks: []healthCheckResult{}}
+		for _, c := range checks {
+			res := healthCheckResult{Name: c.name, Status: healthStatusOK}
+			if err := c.check(ctx); err != nil {
+				res.Status = healthStatusFailed
+				res.Error = err.Error()
+				report.Status = healthStatusFailed
+			}
+			report.Checks = append(report.Checks, res)
+		}
+
+		bs, err := json.Marshal(report)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("internal error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != healthStatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(bs)
+	}
+}
+
+// healthChecks returns the checks with the given names
+func (s *ImmuGwServer) healthChecks(names []string, client immugwclient.Client) ([]healthCheck, error) {
+	checks := make([]healthCheck, 0, len(names))
+	for _, name := range names {
+		var check func(ctx context.Context) error
+		switch name {
+		case HealthCheckImmudb:
+			check = func(ctx context.Context) error { return checkImmudb(ctx, client) }
+		case HealthCheckClients:
+			check = func(ctx context.Context) error { return checkClients(client) }
+		case HealthCheckStateDirs:
+			check = func(ctx context.Context) error { return checkStateDirs(s.stateDirs(client)) }
+		case HealthCheckAudit:
+			check = func(ctx context.Context) error { return s.checkAudit() }
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownHealthCheck, name)
+		}
+		checks = append(checks, healthCheck{name: name, check: check})
+	}
+	return checks, nil
+}
+
+// checkImmudb checks that immudb answers to health requests
+func checkImmudb(ctx context.Context, client immugwclient.Client) error {
+	ic, err := client.For("defaultdb")
+	if err != nil {
+		return err
+	}
+	if !ic.IsConnected() {
+		return fmt.Errorf("not connected to immudb")
+	}
+	res, err := ic.GetServiceClient().Health(ctx, &empty.Empty{})
+	if err != nil {
+		return fmt.Errorf("immudb is unreachable: %w", err)
+	}
+	if !res.GetStatus() {
+		return fmt.Errorf("immudb is not healthy")
+	}
+	return nil
+}
+
+// checkClients checks that the client of every database is connected
+func checkClients(client immugwclient.Client) error {
+	var disconnected []string
+	for _, db := range client.Databases() {
+		ic, err := client.For(db)
+		if err != nil || !ic.IsConnected() {
+			disconnected = append(disconnected, db)
+		}
+	}
+	if len(disconnected) > 0 {
+		return fmt.Errorf("clients not connected: %s", strings.Join(disconnected, ", "))
+	}
+	return nil
+}
+
+// stateDirs returns the folders the gateway writes its state to
+func (s *ImmuGwServer) stateDirs(client immugwclient.Client) []string {
+	dirs := []string{s.CliOptions.Dir}
+	for _, db := range client.Databases() {
+		if ic, err := client.For(db); err == nil {
+			dirs = append(dirs, ic.GetOptions().Dir)
+		}
+	}
+	if s.Options.Audit {
+		dirs = append(dirs, filepath.Join(s.Options.Dir, "audit_history"))
+	}
+	return dirs
+}
+
+// checkStateDirs checks that a file can be created in every folder
+func checkStateDirs(dirs []string) error {
+	var failed []string
+	for _, dir := range dirs {
+		f, err := os.CreateTemp(dir, ".immugw-readyz-*")
+		if err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		f.Close()
+		os.Remove(f.Name())
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("state folders not writable: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// checkAudit fails when the last audit of a database detected tampering
+func (s *ImmuGwServer) checkAudit() error {
+	if !s.Options.Audit {
+		return nil
+	}
+	if tampered := s.MetricServer.mc.lastAuditResultPerDatabase.tampered(); len(tampered) > 0 {
+		return fmt.Errorf("last audit detected tampering of databases: %s", strings.Join(tampered, ", "))
+	}
+	return nil
+}
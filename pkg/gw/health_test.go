@@ -0,0 +1,114 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codenotary/immudb/embedded/logger"
+	"github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/client/clienttest"
+	immugwclient "github.com/codenotary/immugw/pkg/client"
+	immugwjson "github.com/codenotary/immugw/pkg/json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthHandler(t *testing.T) {
+	serve := func(checks []healthCheck) (*httptest.ResponseRecorder, healthReport) {
+		req, err := http.NewRequest(http.MethodGet, "/readyz", nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(healthHandler(checks, immugwjson.DefaultJSON())).ServeHTTP(rr, req)
+
+		var report healthReport
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		return rr, report
+	}
+
+	ok := healthCheck{name: "ok", check: func(ctx context.Context) error { return nil }}
+	failed := healthCheck{name: "failed", check: func(ctx context.Context) error { return errors.New("some error") }}
+
+	rr, report := serve(nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	require.Equal(t, healthReport{Status: "ok", Checks: []healthCheckResult{}}, report)
+
+	rr, report = serve([]healthCheck{ok})
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, healthReport{Status: "ok", Checks: []healthCheckResult{{Name: "ok", Status: "ok"}}}, report)
+
+	rr, report = serve([]healthCheck{ok, failed})
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	require.Equal(t, healthReport{
+		Status: "failed",
+		Checks: []healthCheckResult{
+			{Name: "ok", Status: "ok"},
+			{Name: "failed", Status: "failed", Error: "some error"},
+		},
+	}, report)
+}
+
+func TestImmuGwServer_HealthChecks(t *testing.T) {
+	dir := t.TempDir()
+	connected := true
+	cli := &clienttest.ImmuClientMock{
+		IsConnectedF: func() bool { return connected },
+		GetOptionsF:  func() *client.Options { return client.DefaultOptions().WithDir(dir) },
+	}
+	gwClient := immugwclient.NewMockClient(cli, client.DefaultOptions())
+
+	s := &ImmuGwServer{
+		Options:      DefaultOptions().WithDir(dir),
+		CliOptions:   *client.DefaultOptions().WithDir(dir),
+		Logger:       logger.NewSimpleLogger("test", os.Stdout),
+		MetricServer: newMetricsServer("", logger.NewSimpleLogger("test", os.Stdout), func() float64 { return 0 }),
+	}
+
+	_, err := s.healthChecks([]string{HealthCheckClients, "unknown"}, gwClient)
+	require.ErrorIs(t, err, ErrUnknownHealthCheck)
+
+	checks, err := s.healthChecks([]string{HealthCheckClients, HealthCheckStateDirs, HealthCheckAudit}, gwClient)
+	require.NoError(t, err)
+	require.Len(t, checks, 3)
+	for _, c := range checks {
+		require.NoError(t, c.check(context.Background()), c.name)
+	}
+
+	// clients
+	connected = false
+	require.EqualError(t, checks[0].check(context.Background()), "clients not connected: defaultdb")
+
+	// state folders
+	s.CliOptions.Dir = filepath.Join(dir, "missing")
+	require.Error(t, checks[1].check(context.Background()))
+
+	// audit
+	s.MetricServer.mc.UpdateAuditResult("server1", "127.0.0.1", "db1", true, false, false, nil, nil)
+	require.NoError(t, checks[2].check(context.Background()))
+
+	s.Options.Audit = true
+	require.EqualError(t, checks[2].check(context.Background()), "last audit detected tampering of databases: db1")
+
+	s.MetricServer.mc.UpdateAuditResult("server1", "127.0.0.1", "db1", true, false, true, nil, nil)
+	require.NoError(t, checks[2].check(context.Background()))
+}
@@ -64,7 +64,7 @@ func (h *historyHandler) History(w http.ResponseWriter, req *http.Request, pathP
 		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, status.Errorf(codes.InvalidArgument, "missing parameter %s", "databaseName"))
 		return
 	}
-	client, err := h.client.For(databasename)
+	client, err := clientFor(h.client, req, databasename)
 	if err != nil {
 		h.runtime.HTTPError(rctx, h.mux, outboundMarshaler, w, req, err)
 		return
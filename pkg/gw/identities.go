@@ -0,0 +1,240 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immudb/pkg/auth"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// identityTokenTTL is how long the immudb token of an identity is reused
+// before logging in again
+const identityTokenTTL = 10 * time.Minute
+
+// identityDeniedRoutes would hand the immudb token of the identity to the
+// client, they are not available to the requests run under an identity
+var identityDeniedRoutes = map[string]bool{
+	"Login":       true,
+	"Logout":      true,
+	"UseDatabase": true,
+}
+
+// identity is an immudb user the gateway runs the requests authenticated by
+// the gateway under, with the databases and routes the requests are allowed
+// to access, all if nil
+type identity struct {
+	// apiKey and subject are the API key or the token subject the request
+	// was authenticated with
+	apiKey  string
+	subject string
+
+	username  string
+	password  string
+	databases map[string]bool
+	routes    map[string]bool
+	// roles are matched by the route policies
+	roles []string
+
+	sessions *identitySessions
+}
+
+// newIdentity returns the identity of username, whose password can be base64
+// encoded with the 'enc:' prefix
+func newIdentity(username string, password string, databases []string, routes []string, sessions *identitySessions) (*identity, error) {
+	password, err := auth.DecodeBase64Password(password)
+	if err != nil {
+		return nil, err
+	}
+	return &identity{
+		username:  username,
+		password:  password,
+		databases: stringSet(databases),
+		routes:    stringSet(routes),
+		sessions:  sessions,
+	}, nil
+}
+
+func stringSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// authorize checks that id is allowed to access the route name on database
+func (id *identity) authorize(name string, database string) error {
+	if identityDeniedRoutes[name] || id.routes != nil && !id.routes[name] {
+		return ErrRouteDenied
+	}
+	if database != "" && id.databases != nil && !id.databases[database] {
+		return ErrDatabaseDenied
+	}
+	return nil
+}
+
+type identityKey struct{}
+
+// withIdentity returns a copy of req run under id
+func withIdentity(req *http.Request, id *identity) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), identityKey{}, id))
+}
+
+// identityFromContext returns the identity the request is run under, if any
+func identityFromContext(ctx context.Context) *identity {
+	id, _ := ctx.Value(identityKey{}).(*identity)
+	return id
+}
+
+// requestIdentity returns the identity req is run under: the one of its API
+// key, or the one its bearer token was mapped to
+func requestIdentity(req *http.Request) (*identity, error) {
+	if key, ok := apiKeyFromRequest(req); ok {
+		return apiKeysFromContext(req.Context()).authenticate(key)
+	}
+	return identityFromContext(req.Context()), nil
+}
+
+// verifiedCallerIdentities returns the names the caller of req, run under id
+// if not nil, is known by as verified by the gateway: the immudb user of id,
+// the API key name, the JWT subject and the client certificate subject. The
+// user of an immudb token is only verified by immudb, later.
+func verifiedCallerIdentities(req *http.Request, id *identity) []string {
+	var names []string
+	if id != nil {
+		names = append(names, id.username)
+		if id.apiKey != "" {
+			names = append(names, id.apiKey)
+		}
+		if id.subject != "" {
+			names = append(names, id.subject)
+		}
+	}
+	if subject, ok := ClientCertSubjectFromContext(req.Context()); ok {
+		names = append(names, subject)
+	}
+	return names
+}
+
+// serve serves req under the immudb identity id if it is allowed to access
+// the route name on database: the authorization of req is replaced by the
+// immudb token of the identity for database, or for the default database of
+// the identity if empty
+func (id *identity) serve(mux *runtime.ServeMux, name string, database string, h runtime.HandlerFunc, w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	route := requestRouteFromContext(req.Context())
+	if route != nil {
+		route.User = id.username
+		route.APIKey = id.apiKey
+		route.Subject = id.subject
+	}
+
+	err := id.authorize(name, database)
+	var token string
+	if err == nil {
+		token, err = id.sessions.token(req.Context(), id, database)
+	}
+	if err != nil {
+		_, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
+		runtime.HTTPError(req.Context(), mux, outboundMarshaler, w, req, err)
+		return
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	h(w, req, pathParams)
+
+	// the token may have expired or been revoked, the identity logs in again
+	// on the next request
+	if route != nil && route.errored && route.code == codes.Unauthenticated {
+		id.sessions.forget(id, database)
+	}
+}
+
+type identityToken struct {
+	username string
+	database string
+}
+
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// identitySessions logs the identities in to immudb and keeps their tokens
+type identitySessions struct {
+	client schema.ImmuServiceClient
+
+	mu     sync.Mutex
+	tokens map[identityToken]cachedToken
+}
+
+func newIdentitySessions(client schema.ImmuServiceClient) *identitySessions {
+	return &identitySessions{
+		client: client,
+		tokens: make(map[identityToken]cachedToken),
+	}
+}
+
+// token returns the immudb token of id for database, logging in when there
+// is no valid one
+func (s *identitySessions) token(ctx context.Context, id *identity, database string) (string, error) {
+	tk := identityToken{username: id.username, database: database}
+
+	s.mu.Lock()
+	t, ok := s.tokens[tk]
+	s.mu.Unlock()
+	if ok && time.Now().Before(t.expires) {
+		return t.token, nil
+	}
+
+	resp, err := s.client.Login(ctx, &schema.LoginRequest{User: []byte(id.username), Password: []byte(id.password)})
+	if err != nil {
+		return "", err
+	}
+	token := resp.GetToken()
+	if database != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+		reply, err := s.client.UseDatabase(ctx, &schema.Database{DatabaseName: database})
+		if err != nil {
+			return "", err
+		}
+		token = reply.GetToken()
+	}
+
+	s.mu.Lock()
+	s.tokens[tk] = cachedToken{token: token, expires: time.Now().Add(identityTokenTTL)}
+	s.mu.Unlock()
+	return token, nil
+}
+
+// forget drops the immudb token of id for database
+func (s *identitySessions) forget(id *identity, database string) {
+	s.mu.Lock()
+	delete(s.tokens, identityToken{username: id.username, database: database})
+	s.mu.Unlock()
+}
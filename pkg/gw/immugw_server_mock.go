@@ -27,12 +27,14 @@ import (
 
 // ImmuGwServerMock ...
 type ImmuGwServerMock struct {
-	StartF          func() error
-	StopF           func() error
-	WithClientF     func(schema.ImmuServiceClient) ImmuGw
-	WithLoggerF     func(logger.Logger) ImmuGw
-	WithOptionsF    func(Options) ImmuGw
-	WithCliOptionsF func(client.Options) ImmuGw
+	StartF             func() error
+	StopF              func() error
+	WithClientF        func(schema.ImmuServiceClient) ImmuGw
+	WithLoggerF        func(logger.Logger) ImmuGw
+	WithOptionsF       func(Options) ImmuGw
+	WithCliOptionsF    func(client.Options) ImmuGw
+	WithOptionsLoaderF func(OptionsLoader) ImmuGw
+	ReloadF            func() error
 }
 
 // Start ...
@@ -82,3 +84,19 @@ func (igm *ImmuGwServerMock) WithCliOptions(options client.Options) ImmuGw {
 	}
 	return igm
 }
+
+// WithOptionsLoader ...
+func (igm *ImmuGwServerMock) WithOptionsLoader(loader OptionsLoader) ImmuGw {
+	if igm.WithOptionsLoaderF != nil {
+		return igm.WithOptionsLoaderF(loader)
+	}
+	return igm
+}
+
+// Reload ...
+func (igm *ImmuGwServerMock) Reload() error {
+	if igm.ReloadF != nil {
+		return igm.ReloadF()
+	}
+	return nil
+}
@@ -69,4 +69,20 @@ func TestImmuGwServerMock(t *testing.T) {
 	}
 	igsm.WithOptions(defaultOpts)
 	require.True(t, withOptionsCalled)
+
+	withOptionsLoaderCalled := false
+	require.Equal(t, igsm, igsm.WithOptionsLoader(nil))
+	igsm.WithOptionsLoaderF = func(OptionsLoader) ImmuGw {
+		withOptionsLoaderCalled = true
+		return igsm
+	}
+	igsm.WithOptionsLoader(nil)
+	require.True(t, withOptionsLoaderCalled)
+
+	reloadErr := errors.New("some reload error")
+	require.Nil(t, igsm.Reload())
+	igsm.ReloadF = func() error {
+		return reloadErr
+	}
+	require.Equal(t, reloadErr, igsm.Reload())
 }
@@ -0,0 +1,366 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+)
+
+const (
+	// jwtLeeway is the clock skew tolerated when validating the time claims
+	jwtLeeway = time.Minute
+	// jwksRefreshInterval is the minimum interval between two reloads of the
+	// JWKS, which is reloaded when a token is signed with an unknown key
+	jwksRefreshInterval = time.Minute
+	jwksFetchTimeout    = 10 * time.Second
+	maxJWKSSize         = 1 << 20
+)
+
+// jwtAlgorithms are the signature algorithms accepted for the tokens, the
+// symmetric ones are not as the JWKS is public
+var jwtAlgorithms = map[string]bool{
+	string(jose.RS256): true,
+	string(jose.RS384): true,
+	string(jose.RS512): true,
+	string(jose.PS256): true,
+	string(jose.PS384): true,
+	string(jose.PS512): true,
+	string(jose.ES256): true,
+	string(jose.ES384): true,
+	string(jose.ES512): true,
+	string(jose.EdDSA): true,
+}
+
+// JWTMapping is the file mapping the claims of the tokens to immudb
+// identities
+type JWTMapping struct {
+	// SubjectClaim is the claim identifying the caller in the logs, sub if
+	// empty
+	SubjectClaim string `json:"subjectClaim,omitempty"`
+	// Rules are evaluated in order, the first matching one maps the token
+	Rules []JWTMappingRule `json:"rules"`
+}
+
+// JWTMappingRule maps the tokens whose claim has one of the values to the
+// immudb identity of the rule
+type JWTMappingRule struct {
+	// Claim is the name of the claim, nested claims are separated by dots,
+	// e.g. realm_access.roles
+	Claim string `json:"claim"`
+	// Values the claim, a string or an array of strings, must have one of,
+	// the rule matches any token carrying the claim if empty
+	Values []string `json:"values,omitempty"`
+	// Username and Password are the immudb credentials of the identity, the
+	// password can be base64 encoded with the 'enc:' prefix
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Databases and Routes the identity is allowed to access, all if empty
+	Databases []string `json:"databases,omitempty"`
+	Routes    []string `json:"routes,omitempty"`
+	// Roles of the identity, matched by the route policies
+	Roles []string `json:"roles,omitempty"`
+}
+
+type jwtRule struct {
+	claim    []string
+	values   map[string]bool
+	identity *identity
+}
+
+// jwtAuth authenticates the requests carrying a JWT bearer token, running
+// them under the immudb identity the claims of the token are mapped to
+type jwtAuth struct {
+	issuer       string
+	audience     string
+	keys         *jwks
+	subjectClaim []string
+	rules        []jwtRule
+}
+
+// newJWTAuth returns the JWT authentication configured by the options, the
+// identities log in to immudb with client. It is nil when no JWKS is set.
+func newJWTAuth(o Options, client schema.ImmuServiceClient) (*jwtAuth, error) {
+	if o.JWTJWKS == "" {
+		return nil, nil
+	}
+	if o.JWTIssuer == "" {
+		return nil, ErrJWTIssuerRequired
+	}
+	if o.JWTMappingFile == "" {
+		return nil, ErrJWTMappingRequired
+	}
+	bs, err := os.ReadFile(o.JWTMappingFile)
+	if err != nil {
+		return nil, err
+	}
+	var mapping JWTMapping
+	if err := json.Unmarshal(bs, &mapping); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJWTMapping, err)
+	}
+	a, err := newJWTAuthWithMapping(o.JWTIssuer, o.JWTAudience, mapping, client)
+	if err != nil {
+		return nil, err
+	}
+	a.keys = &jwks{location: o.JWTJWKS, client: &http.Client{Timeout: jwksFetchTimeout}}
+	if err := a.keys.load(context.Background()); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func newJWTAuthWithMapping(issuer string, audience string, mapping JWTMapping, client schema.ImmuServiceClient) (*jwtAuth, error) {
+	a := &jwtAuth{
+		issuer:       issuer,
+		audience:     audience,
+		subjectClaim: []string{"sub"},
+	}
+	if mapping.SubjectClaim != "" {
+		a.subjectClaim = strings.Split(mapping.SubjectClaim, ".")
+	}
+	if len(mapping.Rules) == 0 {
+		return nil, fmt.Errorf("%w: no rules", ErrInvalidJWTMapping)
+	}
+	sessions := newIdentitySessions(client)
+	for i, r := range mapping.Rules {
+		if r.Claim == "" {
+			return nil, fmt.Errorf("%w: rule %d has no claim", ErrInvalidJWTMapping, i)
+		}
+		if r.Username == "" {
+			return nil, fmt.Errorf("%w: rule %d has no username", ErrInvalidJWTMapping, i)
+		}
+		id, err := newIdentity(r.Username, r.Password, r.Databases, r.Routes, sessions)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rule %d: %v", ErrInvalidJWTMapping, i, err)
+		}
+		id.roles = r.Roles
+		a.rules = append(a.rules, jwtRule{
+			claim:    strings.Split(r.Claim, "."),
+			values:   stringSet(r.Values),
+			identity: id,
+		})
+	}
+	return a, nil
+}
+
+// handler rejects the requests carrying an invalid or unmapped JWT before
+// they reach h, and runs the others under the identity of their token. The
+// immudb tokens are forwarded as they are.
+func (a *jwtAuth) handler(mux *runtime.ServeMux, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, ok := jwtFromRequest(req)
+		if !ok {
+			h.ServeHTTP(w, req)
+			return
+		}
+		id, err := a.authenticate(req.Context(), token)
+		if err != nil {
+			_, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
+			runtime.HTTPError(req.Context(), mux, outboundMarshaler, w, req, err)
+			return
+		}
+		h.ServeHTTP(w, withIdentity(req, id))
+	})
+}
+
+// jwtFromRequest returns the bearer token of req if it is not an immudb
+// token
+func jwtFromRequest(req *http.Request) (string, bool) {
+	parts := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", false
+	}
+	token := strings.TrimSpace(parts[1])
+	if token == "" || strings.HasPrefix(token, "v2.public.") {
+		return "", false
+	}
+	return token, true
+}
+
+// authenticate verifies token and returns the identity it is mapped to
+func (a *jwtAuth) authenticate(ctx context.Context, token string) (*identity, error) {
+	tok, err := jwt.ParseSigned(token)
+	if err != nil || len(tok.Headers) != 1 || !jwtAlgorithms[tok.Headers[0].Algorithm] {
+		return nil, ErrInvalidJWT
+	}
+
+	var claims jwt.Claims
+	var all map[string]interface{}
+	verified := false
+	for _, key := range a.keys.get(ctx, tok.Headers[0].KeyID) {
+		if err := tok.Claims(key.Key, &claims, &all); err == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified || claims.Expiry == nil {
+		return nil, ErrInvalidJWT
+	}
+	expected := jwt.Expected{Issuer: a.issuer, Time: time.Now()}
+	if a.audience != "" {
+		expected.Audience = jwt.Audience{a.audience}
+	}
+	if err := claims.ValidateWithLeeway(expected, jwtLeeway); err != nil {
+		if errors.Is(err, jwt.ErrExpired) {
+			return nil, ErrJWTExpired
+		}
+		return nil, ErrInvalidJWT
+	}
+
+	for _, r := range a.rules {
+		if r.matches(all) {
+			id := *r.identity
+			id.subject, _ = claimValue(all, a.subjectClaim).(string)
+			return &id, nil
+		}
+	}
+	return nil, ErrJWTNotMapped
+}
+
+// matches reports whether the claims carry the claim of r with one of its
+// values
+func (r jwtRule) matches(claims map[string]interface{}) bool {
+	switch v := claimValue(claims, r.claim).(type) {
+	case nil:
+		return false
+	case string:
+		return r.values == nil || r.values[v]
+	case []interface{}:
+		if r.values == nil {
+			return true
+		}
+		for _, e := range v {
+			if s, ok := e.(string); ok && r.values[s] {
+				return true
+			}
+		}
+		return false
+	default:
+		return r.values == nil
+	}
+}
+
+// claimValue returns the value of the nested claim path, nil if missing
+func claimValue(claims map[string]interface{}, path []string) interface{} {
+	var v interface{} = claims
+	for _, name := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
+
+// jwks is the key set the tokens are verified with, read from a file or
+// fetched from an http(s) URL
+type jwks struct {
+	location string
+	client   *http.Client
+
+	mu     sync.Mutex
+	set    jose.JSONWebKeySet
+	loaded time.Time
+}
+
+// get returns the signing keys with id kid, all the signing keys if kid is
+// empty. The key set is reloaded when kid is unknown, at most once per
+// refresh interval.
+func (k *jwks) get(ctx context.Context, kid string) []jose.JSONWebKey {
+	k.mu.Lock()
+	keys := k.signingKeys(kid)
+	stale := time.Since(k.loaded) >= jwksRefreshInterval
+	k.mu.Unlock()
+	if len(keys) > 0 || !stale {
+		return keys
+	}
+	// the previous keys are kept when the reload fails
+	k.load(ctx)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.signingKeys(kid)
+}
+
+func (k *jwks) signingKeys(kid string) []jose.JSONWebKey {
+	var keys []jose.JSONWebKey
+	for _, key := range k.set.Keys {
+		if (kid == "" || key.KeyID == kid) && key.IsPublic() && (key.Use == "" || key.Use == "sig") {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// load reads the key set
+func (k *jwks) load(ctx context.Context) error {
+	k.mu.Lock()
+	k.loaded = time.Now()
+	k.mu.Unlock()
+
+	bs, err := k.read(ctx)
+	if err != nil {
+		return err
+	}
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal(bs, &set); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJWKS, err)
+	}
+	for _, key := range set.Keys {
+		if !key.IsPublic() {
+			return fmt.Errorf("%w: key %s is not a public key", ErrInvalidJWKS, key.KeyID)
+		}
+	}
+
+	k.mu.Lock()
+	k.set = set
+	k.mu.Unlock()
+	return nil
+}
+
+func (k *jwks) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(k.location, "http://") && !strings.HasPrefix(k.location, "https://") {
+		return os.ReadFile(k.location)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s returned %s", ErrInvalidJWKS, k.location, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
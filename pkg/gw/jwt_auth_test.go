@@ -0,0 +1,249 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immugw/pkg/api"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+type jwtTestKey struct {
+	kid string
+	alg jose.SignatureAlgorithm
+	key interface{}
+}
+
+func newJWTTestKeys(t *testing.T) (jwtTestKey, jwtTestKey) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return jwtTestKey{kid: "rsa", alg: jose.RS256, key: rsaKey}, jwtTestKey{kid: "ec", alg: jose.ES256, key: ecKey}
+}
+
+func (k jwtTestKey) public() jose.JSONWebKey {
+	key := jose.JSONWebKey{Key: k.key, KeyID: k.kid, Algorithm: string(k.alg), Use: "sig"}
+	return key.Public()
+}
+
+func (k jwtTestKey) sign(t *testing.T, claims ...interface{}) string {
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: k.alg, Key: jose.JSONWebKey{Key: k.key, KeyID: k.kid}}, nil)
+	require.NoError(t, err)
+	b := jwt.Signed(sig)
+	for _, c := range claims {
+		b = b.Claims(c)
+	}
+	token, err := b.CompactSerialize()
+	require.NoError(t, err)
+	return token
+}
+
+func writeJWKS(t *testing.T, file string, keys ...jose.JSONWebKey) {
+	bs, err := json.Marshal(jose.JSONWebKeySet{Keys: keys})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(file, bs, 0600))
+}
+
+func TestNewJWTAuth(t *testing.T) {
+	rsaKey, ecKey := newJWTTestKeys(t)
+	dir := t.TempDir()
+	jwksFile := filepath.Join(dir, "jwks.json")
+	writeJWKS(t, jwksFile, rsaKey.public(), ecKey.public())
+	mappingFile := filepath.Join(dir, "mapping.json")
+	require.NoError(t, os.WriteFile(mappingFile, []byte(`{"rules":[{"claim":"groups","values":["admins"],"username":"immudb","password":"enc:c2VjcmV0"}]}`), 0600))
+
+	a, err := newJWTAuth(DefaultOptions(), nil)
+	require.NoError(t, err)
+	require.Nil(t, a)
+
+	opts := DefaultOptions().WithJWTJWKS(jwksFile).WithJWTIssuer("https://idp").WithJWTMappingFile(mappingFile)
+	_, err = newJWTAuth(opts.WithJWTIssuer(""), nil)
+	require.ErrorIs(t, err, ErrJWTIssuerRequired)
+	_, err = newJWTAuth(opts.WithJWTMappingFile(""), nil)
+	require.ErrorIs(t, err, ErrJWTMappingRequired)
+	_, err = newJWTAuth(opts.WithJWTMappingFile(filepath.Join(dir, "missing.json")), nil)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = newJWTAuth(opts.WithJWTJWKS(filepath.Join(dir, "missing.json")), nil)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	a, err = newJWTAuth(opts, nil)
+	require.NoError(t, err)
+	require.Len(t, a.keys.set.Keys, 2)
+	require.Equal(t, "secret", a.rules[0].identity.password)
+
+	// private keys are refused
+	privateFile := filepath.Join(dir, "private.json")
+	writeJWKS(t, privateFile, jose.JSONWebKey{Key: rsaKey.key, KeyID: rsaKey.kid})
+	_, err = newJWTAuth(opts.WithJWTJWKS(privateFile), nil)
+	require.ErrorIs(t, err, ErrInvalidJWKS)
+
+	invalidFile := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalidFile, []byte(`{"rules":`), 0600))
+	_, err = newJWTAuth(opts.WithJWTJWKS(invalidFile), nil)
+	require.ErrorIs(t, err, ErrInvalidJWKS)
+	_, err = newJWTAuth(opts.WithJWTMappingFile(invalidFile), nil)
+	require.ErrorIs(t, err, ErrInvalidJWTMapping)
+
+	for _, m := range []JWTMapping{
+		{},
+		{Rules: []JWTMappingRule{{Username: "immudb"}}},
+		{Rules: []JWTMappingRule{{Claim: "groups"}}},
+		{Rules: []JWTMappingRule{{Claim: "groups", Username: "immudb", Password: "enc:%"}}},
+	} {
+		_, err := newJWTAuthWithMapping("https://idp", "", m, nil)
+		require.ErrorIs(t, err, ErrInvalidJWTMapping)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/jwks" {
+			http.NotFound(w, req)
+			return
+		}
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{ecKey.public()}})
+	}))
+	defer ts.Close()
+	a, err = newJWTAuth(opts.WithJWTJWKS(ts.URL+"/jwks"), nil)
+	require.NoError(t, err)
+	require.Len(t, a.keys.set.Keys, 1)
+	_, err = newJWTAuth(opts.WithJWTJWKS(ts.URL+"/missing"), nil)
+	require.ErrorIs(t, err, ErrInvalidJWKS)
+}
+
+func TestJWTAuth(t *testing.T) {
+	rsaKey, ecKey := newJWTTestKeys(t)
+	rotatedKey, _ := newJWTTestKeys(t)
+	rotatedKey.kid = "rotated"
+
+	var fetches int32
+	keys := []jose.JSONWebKey{rsaKey.public(), ecKey.public()}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: keys})
+	}))
+	defer ts.Close()
+
+	client := &loginServiceClientMock{}
+	a, err := newJWTAuthWithMapping("https://idp", "immugw", JWTMapping{
+		SubjectClaim: "email",
+		Rules: []JWTMappingRule{
+			{Claim: "groups", Values: []string{"admins"}, Username: "admin", Password: "secret"},
+			{Claim: "realm_access.roles", Values: []string{"auditor"}, Username: "auditor", Password: "secret", Databases: []string{"db1"}, Routes: []string{"VerifiedGet"}},
+		},
+	}, client)
+	require.NoError(t, err)
+	a.keys = &jwks{location: ts.URL, client: ts.Client()}
+	require.NoError(t, a.keys.load(context.Background()))
+
+	var authorization, subject string
+	mux := runtime.NewServeMux(runtime.WithProtoErrorHandler(routeErrorHandler(api.DefaultGWErrorHandler)))
+	h := func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		authorization = req.Header.Get("Authorization")
+		subject = requestRouteFromContext(req.Context()).Subject
+		w.Write([]byte("{}"))
+	}
+	handleRoute(mux, "VerifiedGet", http.MethodPost, api.Pattern_ImmuService_VerifiedGet_0(), h)
+	handleRoute(mux, "VerifiedSet", http.MethodPost, api.Pattern_ImmuService_VerifiedSet_0(), h)
+	requests := newRequestMetrics(prometheus.NewRegistry())
+	handler := requests.handler(a.handler(mux, mux))
+
+	serve := func(url string, token string) int {
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader("{}"))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	now := time.Now()
+	valid := jwt.Claims{
+		Issuer:   "https://idp",
+		Subject:  "user-1",
+		Audience: jwt.Audience{"immugw", "other"},
+		Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+		IssuedAt: jwt.NewNumericDate(now),
+	}
+	admin := map[string]interface{}{"groups": []string{"users", "admins"}, "email": "admin@example.com"}
+	auditor := map[string]interface{}{"realm_access": map[string]interface{}{"roles": []string{"auditor"}}}
+
+	require.Equal(t, http.StatusOK, serve("/db/db1/verified/get", rsaKey.sign(t, valid, admin)))
+	require.Equal(t, "Bearer admin-token-db1", authorization)
+	require.Equal(t, "admin@example.com", subject)
+	require.Equal(t, http.StatusOK, serve("/db/db1/verified/get", ecKey.sign(t, valid, auditor)))
+	require.Equal(t, "Bearer auditor-token-db1", authorization)
+	require.Empty(t, subject)
+	require.Equal(t, 2, client.logins)
+
+	authorization = ""
+	expired := valid
+	expired.Expiry = jwt.NewNumericDate(now.Add(-time.Hour))
+	noExpiry := valid
+	noExpiry.Expiry = nil
+	otherIssuer := valid
+	otherIssuer.Issuer = "https://other"
+	otherAudience := valid
+	otherAudience.Audience = jwt.Audience{"other"}
+	hmac := jwtTestKey{kid: "rsa", alg: jose.HS256, key: []byte("0123456789abcdef0123456789abcdef")}
+	for _, token := range []string{
+		"not-a-token",
+		rsaKey.sign(t, expired, admin),
+		rsaKey.sign(t, noExpiry, admin),
+		rsaKey.sign(t, otherIssuer, admin),
+		rsaKey.sign(t, otherAudience, admin),
+		hmac.sign(t, valid, admin),
+		rotatedKey.sign(t, valid, admin),
+	} {
+		require.Equal(t, http.StatusUnauthorized, serve("/db/db1/verified/get", token))
+	}
+	require.Empty(t, authorization)
+	require.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// tokens mapped to no identity, or to an identity not allowed to access
+	// the route, are forbidden
+	require.Equal(t, http.StatusForbidden, serve("/db/db1/verified/get", rsaKey.sign(t, valid, map[string]interface{}{"groups": "users"})))
+	require.Equal(t, http.StatusForbidden, serve("/db/db2/verified/get", ecKey.sign(t, valid, auditor)))
+	require.Equal(t, http.StatusForbidden, serve("/db/db1/verified/set", ecKey.sign(t, valid, auditor)))
+
+	// immudb tokens are forwarded as they are
+	require.Equal(t, http.StatusOK, serve("/db/db1/verified/get", "v2.public.payload"))
+	require.Equal(t, "Bearer v2.public.payload", authorization)
+
+	// the key set is reloaded once stale when a token is signed with an
+	// unknown key
+	keys = append(keys, rotatedKey.public())
+	a.keys.loaded = time.Time{}
+	require.Equal(t, http.StatusOK, serve("/db/db1/verified/get", rotatedKey.sign(t, valid, admin)))
+	require.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+}
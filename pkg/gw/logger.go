@@ -0,0 +1,119 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/codenotary/immudb/embedded/logger"
+)
+
+var logLevels = map[string]logger.LogLevel{
+	"debug": logger.LogDebug,
+	"info":  logger.LogInfo,
+	"warn":  logger.LogWarn,
+	"error": logger.LogError,
+}
+
+// NewLogger returns the logger configured by LogLevel and Logfile. Logs are
+// written to stderr when no log file is set, and the level is read from the
+// LOG_LEVEL environment variable when no log level is set.
+func NewLogger(o Options) (logger.Logger, error) {
+	level := logger.LogLevelFromEnvironment()
+	if o.LogLevel != "" {
+		l, ok := logLevels[strings.ToLower(o.LogLevel)]
+		if !ok {
+			return nil, ErrInvalidLogLevel
+		}
+		level = l
+	}
+
+	if o.Logfile == "" {
+		return logger.NewSimpleLoggerWithLevel("immugw", os.Stderr, level), nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(o.Logfile), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(o.Logfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileLogger{Logger: logger.NewSimpleLoggerWithLevel("immugw", f, level), f: f}, nil
+}
+
+// fileLogger is a logger writing to a file, which is closed with the logger
+type fileLogger struct {
+	logger.Logger
+	f *os.File
+}
+
+func (l *fileLogger) Close() error {
+	return l.f.Close()
+}
+
+// reloadableLogger is a logger whose underlying logger can be replaced at
+// runtime, e.g. to change the log file or level on a configuration reload
+type reloadableLogger struct {
+	mu sync.RWMutex
+	l  logger.Logger
+}
+
+func newReloadableLogger(l logger.Logger) *reloadableLogger {
+	if rl, ok := l.(*reloadableLogger); ok {
+		return rl
+	}
+	return &reloadableLogger{l: l}
+}
+
+// swap replaces the underlying logger and closes the previous one
+func (rl *reloadableLogger) swap(l logger.Logger) error {
+	rl.mu.Lock()
+	prev := rl.l
+	rl.l = l
+	rl.mu.Unlock()
+	return prev.Close()
+}
+
+func (rl *reloadableLogger) current() logger.Logger {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return rl.l
+}
+
+func (rl *reloadableLogger) Errorf(f string, v ...interface{}) {
+	rl.current().Errorf(f, v...)
+}
+
+func (rl *reloadableLogger) Warningf(f string, v ...interface{}) {
+	rl.current().Warningf(f, v...)
+}
+
+func (rl *reloadableLogger) Infof(f string, v ...interface{}) {
+	rl.current().Infof(f, v...)
+}
+
+func (rl *reloadableLogger) Debugf(f string, v ...interface{}) {
+	rl.current().Debugf(f, v...)
+}
+
+func (rl *reloadableLogger) Close() error {
+	return rl.current().Close()
+}
@@ -20,6 +20,7 @@ import (
 	"expvar"
 	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
@@ -29,6 +30,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
 	"github.com/codenotary/immudb/embedded/logger"
+	immugwclient "github.com/codenotary/immugw/pkg/client"
 	"github.com/codenotary/immugw/pkg/json"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -37,6 +39,7 @@ import (
 type LastAuditResult struct {
 	ServerID               string
 	ServerAddress          string
+	Database               string
 	HasRunConsistencyCheck bool
 	HasError               bool
 	ConsistencyCheckResult bool
@@ -50,7 +53,8 @@ type LastAuditResult struct {
 
 // MetricsCollection the gateway metrics collection
 type MetricsCollection struct {
-	lastAuditResult *LastAuditResult
+	lastAuditResult            *LastAuditResult
+	lastAuditResultPerDatabase *lastAuditResults
 
 	AuditResultPerServer   *prometheus.GaugeVec
 	AuditPrevRootPerServer *prometheus.GaugeVec
@@ -58,6 +62,64 @@ type MetricsCollection struct {
 	AuditRunAtPerServer    *prometheus.GaugeVec
 
 	UptimeCounter prometheus.CounterFunc
+
+	requests      *requestMetrics
+	verifications *verifications
+	limits        *limitMetrics
+}
+
+// labelDatabases labels the request metrics of the databases client has not
+// been added for as otherDatabase
+func (mc *MetricsCollection) labelDatabases(client immugwclient.Client) {
+	labels := newDatabaseLabels(client)
+	mc.requests.databases = labels
+	mc.limits.databases = labels
+}
+
+// lastAuditResults holds the latest audit result of each database
+type lastAuditResults struct {
+	sync.Mutex
+	results map[string]*LastAuditResult
+}
+
+func newLastAuditResults() *lastAuditResults {
+	return &lastAuditResults{results: make(map[string]*LastAuditResult)}
+}
+
+// tampered returns the databases whose latest audit detected tampering
+func (r *lastAuditResults) tampered() []string {
+	r.Lock()
+	defer r.Unlock()
+
+	var dbs []string
+	for db, res := range r.results {
+		res.RLock()
+		if res.HasRunConsistencyCheck && !res.HasError && !res.ConsistencyCheckResult {
+			dbs = append(dbs, db)
+		}
+		res.RUnlock()
+	}
+	sort.Strings(dbs)
+	return dbs
+}
+
+// get returns the latest audit result of database, nil if it has never been audited
+func (r *lastAuditResults) get(database string) *LastAuditResult {
+	r.Lock()
+	defer r.Unlock()
+	return r.results[database]
+}
+
+// getOrCreate returns the latest audit result of database, creating it if missing
+func (r *lastAuditResults) getOrCreate(database string) *LastAuditResult {
+	r.Lock()
+	defer r.Unlock()
+	res, ok := r.results[database]
+	if !ok {
+		res = &LastAuditResult{}
+		r.results[database] = res
+	}
+	return res
 }
 
 var metricsNamespace = "immugw"
@@ -74,24 +136,17 @@ func (mc MetricsCollection) WithUptimeCounter(reg *prometheus.Registry, f func()
 	)
 }
 
-// UpdateAuditResult updates the metrics related to audit result
-func (mc MetricsCollection) UpdateAuditResult(
+// newLastAuditResult returns the result of the audit of a database
+func newLastAuditResult(
 	serverID string,
 	serverAddress string,
+	database string,
 	checked bool,
 	withError bool,
 	result bool,
 	prevRoot *schema.ImmutableState,
 	currRoot *schema.ImmutableState,
-) {
-	var r float64
-	if checked && result {
-		r = 1
-	} else if !checked && !withError {
-		r = -1
-	} else if withError {
-		r = -2
-	}
+) *LastAuditResult {
 	prevRootIndex := -1.
 	currRootIndex := -1.
 	if withError {
@@ -109,27 +164,72 @@ func (mc MetricsCollection) UpdateAuditResult(
 		currRoot = &schema.ImmutableState{}
 	}
 
+	return &LastAuditResult{
+		ServerID:               serverID,
+		ServerAddress:          serverAddress,
+		Database:               database,
+		HasRunConsistencyCheck: checked,
+		HasError:               withError,
+		ConsistencyCheckResult: checked && !withError && result,
+		PreviousRootIndex:      prevRootIndex,
+		PreviousRoot:           fmt.Sprintf("%x", prevRoot.TxHash),
+		CurrentRootIndex:       currRootIndex,
+		CurrentRoot:            fmt.Sprintf("%x", currRoot.TxHash),
+		RunAt:                  time.Now(),
+	}
+}
+
+// set copies the fields of res into r
+func (r *LastAuditResult) set(res *LastAuditResult) {
+	r.Lock()
+	defer r.Unlock()
+	r.ServerID = res.ServerID
+	r.ServerAddress = res.ServerAddress
+	r.Database = res.Database
+	r.HasRunConsistencyCheck = res.HasRunConsistencyCheck
+	r.HasError = res.HasError
+	r.ConsistencyCheckResult = res.ConsistencyCheckResult
+	r.PreviousRootIndex = res.PreviousRootIndex
+	r.PreviousRoot = res.PreviousRoot
+	r.CurrentRootIndex = res.CurrentRootIndex
+	r.CurrentRoot = res.CurrentRoot
+	r.RunAt = res.RunAt
+}
+
+// UpdateAuditResult updates the metrics related to audit result
+func (mc MetricsCollection) UpdateAuditResult(
+	serverID string,
+	serverAddress string,
+	database string,
+	checked bool,
+	withError bool,
+	result bool,
+	prevRoot *schema.ImmutableState,
+	currRoot *schema.ImmutableState,
+) {
+	var r float64
+	if checked && result {
+		r = 1
+	} else if !checked && !withError {
+		r = -1
+	} else if withError {
+		r = -2
+	}
+	res := newLastAuditResult(serverID, serverAddress, database, checked, withError, result, prevRoot, currRoot)
+
 	mc.AuditResultPerServer.
-		WithLabelValues(serverID, serverAddress).Set(r)
+		WithLabelValues(serverID, serverAddress, database).Set(r)
 	mc.AuditPrevRootPerServer.
-		WithLabelValues(serverID, serverAddress).Set(prevRootIndex)
+		WithLabelValues(serverID, serverAddress, database).Set(res.PreviousRootIndex)
 	mc.AuditCurrRootPerServer.
-		WithLabelValues(serverID, serverAddress).Set(currRootIndex)
+		WithLabelValues(serverID, serverAddress, database).Set(res.CurrentRootIndex)
 	mc.AuditRunAtPerServer.
-		WithLabelValues(serverID, serverAddress).SetToCurrentTime()
-
-	mc.lastAuditResult.Lock()
-	defer mc.lastAuditResult.Unlock()
-	mc.lastAuditResult.ServerID = serverID
-	mc.lastAuditResult.ServerAddress = serverAddress
-	mc.lastAuditResult.HasRunConsistencyCheck = checked
-	mc.lastAuditResult.HasError = withError
-	mc.lastAuditResult.ConsistencyCheckResult = checked && !withError && result
-	mc.lastAuditResult.PreviousRootIndex = prevRootIndex
-	mc.lastAuditResult.PreviousRoot = fmt.Sprintf("%x", prevRoot.TxHash)
-	mc.lastAuditResult.CurrentRootIndex = currRootIndex
-	mc.lastAuditResult.CurrentRoot = fmt.Sprintf("%x", currRoot.TxHash)
-	mc.lastAuditResult.RunAt = time.Now()
+		WithLabelValues(serverID, serverAddress, database).SetToCurrentTime()
+
+	mc.lastAuditResult.set(res)
+	if mc.lastAuditResultPerDatabase != nil && database != "" {
+		mc.lastAuditResultPerDatabase.getOrCreate(database).set(res)
+	}
 }
 
 func newAuditGaugeVec(reg *prometheus.Registry, name string, help string) *prometheus.GaugeVec {
@@ -139,7 +239,7 @@ func newAuditGaugeVec(reg *prometheus.Registry, name string, help string) *prome
 			Name:      name,
 			Help:      help,
 		},
-		[]string{"server_id", "server_address"},
+		[]string{"server_id", "server_address", "database"},
 	)
 }
 
@@ -164,6 +264,7 @@ type metricServer struct {
 	uptimeCounter func() float64
 	mc            *MetricsCollection
 	srv           *http.Server
+	mux           *http.ServeMux
 }
 
 func newMetricsServer(
@@ -175,7 +276,8 @@ func newMetricsServer(
 
 	// Metrics gateway metrics collection
 	mcoll := &MetricsCollection{
-		lastAuditResult: &LastAuditResult{},
+		lastAuditResult:            &LastAuditResult{},
+		lastAuditResultPerDatabase: newLastAuditResults(),
 		AuditResultPerServer: newAuditGaugeVec(
 			reg,
 			"audit_result_per_server",
@@ -198,6 +300,9 @@ func newMetricsServer(
 		),
 	}
 	mcoll.WithUptimeCounter(reg, uptimeCounter)
+	mcoll.requests = newRequestMetrics(reg)
+	mcoll.verifications = newVerifications(reg, verificationEventsSize)
+	mcoll.limits = newLimitMetrics(reg)
 
 	// expvar package adds a handler in to the default HTTP server (which has to be started explicitly),
 	// and serves up the metrics at the /debug/vars endpoint.
@@ -206,19 +311,42 @@ func newMetricsServer(
 	ms := metricServer{
 		mc:  mcoll,
 		srv: &http.Server{Addr: addr, Handler: mux},
+		mux: mux,
 		l:   log,
 	}
 
-	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/metrics", promhttp.HandlerFor(
+		prometheus.Gatherers{prometheus.DefaultGatherer, reg},
+		promhttp.HandlerOpts{},
+	))
 	mux.Handle("/debug/vars", expvar.Handler())
 	mux.HandleFunc("/lastaudit", ms.lastAuditHandler(json.DefaultJSON()))
+	mux.HandleFunc("/verifications/recent", recentVerificationsHandler(mcoll.verifications, json.DefaultJSON()))
 
 	return &ms
 }
 
+// lastAuditHandler returns the latest audit result, or the latest one of the
+// database given in the database query parameter
 func (m metricServer) lastAuditHandler(json json.JSON) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
-		bs, err := json.Marshal(m.mc.lastAuditResult)
+		lastAuditResult := m.mc.lastAuditResult
+		if database := req.URL.Query().Get("database"); database != "" {
+			lastAuditResult = nil
+			if m.mc.lastAuditResultPerDatabase != nil {
+				lastAuditResult = m.mc.lastAuditResultPerDatabase.get(database)
+			}
+			if lastAuditResult == nil {
+				http.Error(w, fmt.Sprintf("no audit result for database %s", database), http.StatusNotFound)
+				return
+			}
+		}
+
+		if lastAuditResult != nil {
+			lastAuditResult.RLock()
+			defer lastAuditResult.RUnlock()
+		}
+		bs, err := json.Marshal(lastAuditResult)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("internal error: %v", err), http.StatusInternalServerError)
 		}
@@ -226,3 +354,19 @@ func (m metricServer) lastAuditHandler(json json.JSON) func(http.ResponseWriter,
 		w.Write(bs)
 	}
 }
+
+// handleAuditHistory serves the audit history at /audit/history
+func (m metricServer) handleAuditHistory(h *auditHistory) {
+	m.mux.HandleFunc("/audit/history", auditHistoryHandler(h))
+}
+
+// handleAuditRun runs audits on demand at /audit/run
+func (m metricServer) handleAuditRun(trigger auditTrigger, token string) {
+	m.mux.HandleFunc("/audit/run", auditRunHandler(trigger, token, json.DefaultJSON()))
+}
+
+// handleHealth serves the liveness and readiness checks at /livez and /readyz
+func (m metricServer) handleHealth(liveness []healthCheck, readiness []healthCheck) {
+	m.mux.HandleFunc("/livez", healthHandler(liveness, json.DefaultJSON()))
+	m.mux.HandleFunc("/readyz", healthHandler(readiness, json.DefaultJSON()))
+}
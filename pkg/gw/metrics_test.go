@@ -22,6 +22,7 @@ import (
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	"github.com/codenotary/immudb/embedded/logger"
 	"github.com/codenotary/immudb/pkg/api/schema"
@@ -92,7 +93,8 @@ func TestUpdateAuditResult(t *testing.T) {
 
 	ms := metricServer{
 		mc: &MetricsCollection{
-			lastAuditResult: &LastAuditResult{},
+			lastAuditResult:            &LastAuditResult{},
+			lastAuditResultPerDatabase: newLastAuditResults(),
 			AuditResultPerServer: newAuditGaugeVec(
 				reg,
 				"audit_result_per_server",
@@ -120,6 +122,7 @@ func TestUpdateAuditResult(t *testing.T) {
 	ms.mc.UpdateAuditResult(
 		"server1",
 		"127.0.0.1",
+		"defaultdb",
 		true,
 		false,
 		true,
@@ -130,15 +133,55 @@ func TestUpdateAuditResult(t *testing.T) {
 	require.Equal(t, 2., ms.mc.lastAuditResult.CurrentRootIndex)
 	require.Equal(t, "server1", ms.mc.lastAuditResult.ServerID)
 	require.Equal(t, "127.0.0.1", ms.mc.lastAuditResult.ServerAddress)
+	require.Equal(t, "defaultdb", ms.mc.lastAuditResult.Database)
 	require.True(t, ms.mc.lastAuditResult.HasRunConsistencyCheck)
 	require.False(t, ms.mc.lastAuditResult.HasError)
 	require.True(t, ms.mc.lastAuditResult.ConsistencyCheckResult)
 
-	ms.mc.UpdateAuditResult("server1", "127.0.0.1", false, false, true, nil, nil)
+	ms.mc.UpdateAuditResult("server1", "127.0.0.1", "db1", false, false, true, nil, nil)
 	require.Equal(t, -1., ms.mc.lastAuditResult.PreviousRootIndex)
 	require.Equal(t, -1., ms.mc.lastAuditResult.CurrentRootIndex)
+	require.Equal(t, "db1", ms.mc.lastAuditResult.Database)
 
-	ms.mc.UpdateAuditResult("server1", "127.0.0.1", false, true, false, nil, nil)
+	ms.mc.UpdateAuditResult("server1", "127.0.0.1", "db2", false, true, false, nil, nil)
 	require.Equal(t, -2., ms.mc.lastAuditResult.PreviousRootIndex)
 	require.Equal(t, -2., ms.mc.lastAuditResult.CurrentRootIndex)
+
+	defaultdbResult := ms.mc.lastAuditResultPerDatabase.get("defaultdb")
+	require.NotNil(t, defaultdbResult)
+	require.Equal(t, 2., defaultdbResult.CurrentRootIndex)
+	require.True(t, defaultdbResult.ConsistencyCheckResult)
+	require.True(t, ms.mc.lastAuditResultPerDatabase.get("db2").HasError)
+	require.Nil(t, ms.mc.lastAuditResultPerDatabase.get("db3"))
+
+	require.Equal(t, 1., testutil.ToFloat64(ms.mc.AuditResultPerServer.WithLabelValues("server1", "127.0.0.1", "defaultdb")))
+	require.Equal(t, -1., testutil.ToFloat64(ms.mc.AuditResultPerServer.WithLabelValues("server1", "127.0.0.1", "db1")))
+	require.Equal(t, -2., testutil.ToFloat64(ms.mc.AuditResultPerServer.WithLabelValues("server1", "127.0.0.1", "db2")))
+}
+
+func TestLastAuditHandlerPerDatabase(t *testing.T) {
+	ms := metricServer{
+		mc: &MetricsCollection{
+			lastAuditResult:            &LastAuditResult{},
+			lastAuditResultPerDatabase: newLastAuditResults(),
+		},
+	}
+	ms.mc.lastAuditResultPerDatabase.getOrCreate("db1").CurrentRootIndex = 7
+
+	handler := http.HandlerFunc(ms.lastAuditHandler(json.DefaultJSON()))
+
+	req, err := http.NewRequest("GET", "/lastaudit?database=db1", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var actual LastAuditResult
+	require.NoError(t, json.DefaultJSON().Unmarshal(rr.Body.Bytes(), &actual))
+	require.Equal(t, 7., actual.CurrentRootIndex)
+
+	req, err = http.NewRequest("GET", "/lastaudit?database=db2", nil)
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
 }
@@ -0,0 +1,379 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/codenotary/immudb/embedded/logger"
+	"github.com/codenotary/immudb/pkg/api/schema"
+)
+
+// NotificationSignatureHeader holds the hex encoded HMAC-SHA256 of the
+// notification body, computed with the configured notification secret
+const NotificationSignatureHeader = "X-Immugw-Signature"
+
+const (
+	notificationRequestTimeout = 10 * time.Second
+	notificationMaxRetryDelay  = time.Hour
+	notificationFailedDir      = "failed"
+)
+
+// AuditNotification is the payload posted to the webhooks when the auditor
+// detects a tampered database
+type AuditNotification struct {
+	ServerID      string    `json:"serverId"`
+	ServerAddress string    `json:"serverAddress"`
+	Database      string    `json:"database"`
+	Timestamp     time.Time `json:"timestamp"`
+	Tampered      bool      `json:"tampered"`
+	// Failure is the kind of the failed check, consistency or signature
+	Failure       string             `json:"failure"`
+	PreviousState *NotificationState `json:"previousState"`
+	CurrentState  *NotificationState `json:"currentState"`
+}
+
+// NotificationState is a database state as reported in an AuditNotification
+type NotificationState struct {
+	TxID      uint64 `json:"txId"`
+	TxHash    string `json:"txHash"`
+	Signature string `json:"signature,omitempty"`
+	PublicKey string `json:"publicKey,omitempty"`
+}
+
+func newNotificationState(state *schema.ImmutableState) *NotificationState {
+	if state == nil {
+		return nil
+	}
+	return &NotificationState{
+		TxID:      state.GetTxId(),
+		TxHash:    hex.EncodeToString(state.GetTxHash()),
+		Signature: base64.StdEncoding.EncodeToString(state.GetSignature().GetSignature()),
+		PublicKey: base64.StdEncoding.EncodeToString(state.GetSignature().GetPublicKey()),
+	}
+}
+
+// queuedNotification is a notification waiting to be delivered to a webhook,
+// stored in its own file of the queue folder
+type queuedNotification struct {
+	URL         string          `json:"url"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+	LastError   string          `json:"lastError,omitempty"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+// notifier delivers audit notifications to the configured webhooks. Every
+// notification is queued on disk before being delivered so that it survives
+// restarts, and is retried with an exponential backoff until it is
+// delivered or maxAttempts is reached. Undeliverable notifications are moved
+// to the failed subfolder of the queue.
+type notifier struct {
+	dir           string
+	urls          []string
+	secret        []byte
+	maxAttempts   int
+	retryInterval time.Duration
+	client        *http.Client
+	logger        logger.Logger
+
+	mu     sync.Mutex
+	seq    uint64
+	wakeup chan struct{}
+	// alerted holds the kind of the failure last notified for each database,
+	// until an audit finds it consistent again
+	alerted map[string]string
+}
+
+func newNotifier(
+	dir string,
+	urls []string,
+	secret string,
+	maxAttempts int,
+	retryInterval time.Duration,
+	log logger.Logger,
+) (*notifier, error) {
+	if secret == "" {
+		return nil, ErrNotificationSecretRequired
+	}
+	if retryInterval <= 0 {
+		return nil, ErrInvalidNotificationRetry
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	if err := os.MkdirAll(filepath.Join(dir, notificationFailedDir), 0700); err != nil {
+		return nil, err
+	}
+	return &notifier{
+		dir:           dir,
+		urls:          urls,
+		secret:        []byte(secret),
+		maxAttempts:   maxAttempts,
+		retryInterval: retryInterval,
+		client:        &http.Client{Timeout: notificationRequestTimeout},
+		logger:        log,
+		wakeup:        make(chan struct{}, 1),
+		alerted:       make(map[string]string),
+	}, nil
+}
+
+// UpdateAuditResult queues a notification when the audit of a database
+// detected tampering: an inconsistent state, or a state whose signature is
+// not valid, reported as a failed result with an error. A database is only
+// notified again once it has been found consistent, or for another failure.
+func (n *notifier) UpdateAuditResult(
+	serverID string,
+	serverAddress string,
+	database string,
+	checked bool,
+	withError bool,
+	result bool,
+	prevState *schema.ImmutableState,
+	currState *schema.ImmutableState,
+) {
+	var failure string
+	switch {
+	case checked && !result:
+		failure = VerificationConsistency
+	case withError && !result && currState != nil:
+		failure = VerificationSignature
+	}
+
+	key := serverID + "/" + database
+	n.mu.Lock()
+	alerted := n.alerted[key]
+	if failure == "" && checked {
+		delete(n.alerted, key)
+	}
+	n.mu.Unlock()
+	if failure == "" || failure == alerted {
+		return
+	}
+
+	err := n.Notify(&AuditNotification{
+		ServerID:      serverID,
+		ServerAddress: serverAddress,
+		Database:      database,
+		Timestamp:     time.Now().UTC(),
+		Tampered:      true,
+		Failure:       failure,
+		PreviousState: newNotificationState(prevState),
+		CurrentState:  newNotificationState(currState),
+	})
+	if err != nil {
+		n.logger.Errorf("unable to queue audit notification for database %s: %v", database, err)
+		return
+	}
+	n.mu.Lock()
+	n.alerted[key] = failure
+	n.mu.Unlock()
+}
+
+// Notify queues the notification for every webhook
+func (n *notifier) Notify(notification *AuditNotification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, url := range n.urls {
+		n.seq++
+		name := fmt.Sprintf("%020d-%06d.json", time.Now().UnixNano(), n.seq)
+		qn := &queuedNotification{URL: url, NextAttempt: time.Now(), Payload: payload}
+		if err := n.write(filepath.Join(n.dir, name), qn); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case n.wakeup <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers the queued notifications until stopc is closed
+func (n *notifier) Run(stopc <-chan struct{}, donec chan<- struct{}) {
+	defer func() { donec <- struct{}{} }()
+
+	tick := time.NewTicker(n.retryInterval)
+	defer tick.Stop()
+
+	for {
+		n.deliverPending(stopc)
+
+		select {
+		case <-stopc:
+			return
+		case <-n.wakeup:
+		case <-tick.C:
+		}
+	}
+}
+
+// deliverPending tries to deliver all the queued notifications that are due
+func (n *notifier) deliverPending(stopc <-chan struct{}) {
+	files, err := filepath.Glob(filepath.Join(n.dir, "*.json"))
+	if err != nil {
+		n.logger.Errorf("unable to list queued audit notifications: %v", err)
+		return
+	}
+	sort.Strings(files)
+
+	for _, f := range files {
+		select {
+		case <-stopc:
+			return
+		default:
+		}
+
+		qn, err := n.read(f)
+		if err != nil {
+			n.logger.Errorf("unable to read queued audit notification %s: %v", f, err)
+			continue
+		}
+		if time.Now().Before(qn.NextAttempt) {
+			continue
+		}
+
+		err = n.deliver(qn)
+		if err == nil {
+			if err := os.Remove(f); err != nil {
+				n.logger.Errorf("unable to remove delivered audit notification %s: %v", f, err)
+			}
+			continue
+		}
+
+		qn.Attempts++
+		qn.LastError = err.Error()
+		if qn.Attempts >= n.maxAttempts {
+			n.logger.Errorf("giving up delivering audit notification to %s after %d attempts: %v", qn.URL, qn.Attempts, err)
+			if err := n.write(f, qn); err != nil {
+				n.logger.Errorf("unable to update undeliverable audit notification %s: %v", f, err)
+			} else if err := os.Rename(f, filepath.Join(n.dir, notificationFailedDir, filepath.Base(f))); err != nil {
+				n.logger.Errorf("unable to move undeliverable audit notification %s: %v", f, err)
+			}
+			continue
+		}
+
+		n.logger.Warningf("unable to deliver audit notification to %s (attempt %d of %d): %v", qn.URL, qn.Attempts, n.maxAttempts, err)
+		qn.NextAttempt = time.Now().Add(n.retryDelay(qn.Attempts))
+		if err := n.write(f, qn); err != nil {
+			n.logger.Errorf("unable to update queued audit notification %s: %v", f, err)
+		}
+	}
+}
+
+// retryDelay returns the delay before the next delivery attempt, doubling
+// the retry interval at every failed attempt
+func (n *notifier) retryDelay(attempts int) time.Duration {
+	delay := n.retryInterval
+	for i := 1; i < attempts && delay < notificationMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > notificationMaxRetryDelay {
+		delay = notificationMaxRetryDelay
+	}
+	return delay
+}
+
+// deliver posts the notification payload to its webhook
+func (n *notifier) deliver(qn *queuedNotification) error {
+	req, err := http.NewRequest(http.MethodPost, qn.URL, bytes.NewReader(qn.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(NotificationSignatureHeader, "sha256="+n.sign(qn.Payload))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of payload
+func (n *notifier) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, n.secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (n *notifier) read(path string) (*queuedNotification, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var qn queuedNotification
+	if err := json.Unmarshal(bs, &qn); err != nil {
+		return nil, err
+	}
+	return &qn, nil
+}
+
+// write atomically replaces the notification file at path
+func (n *notifier) write(path string, qn *queuedNotification) error {
+	bs, err := json.Marshal(qn)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, bs, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// chainAuditResults returns an auditResultFunc calling all the given ones
+func chainAuditResults(fs ...auditResultFunc) auditResultFunc {
+	return func(
+		serverID string,
+		serverAddress string,
+		database string,
+		checked bool,
+		withError bool,
+		result bool,
+		prevState *schema.ImmutableState,
+		currState *schema.ImmutableState,
+	) {
+		for _, f := range fs {
+			f(serverID, serverAddress, database, checked, withError, result, prevState, currState)
+		}
+	}
+}
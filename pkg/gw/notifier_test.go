@@ -0,0 +1,254 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb/embedded/logger"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/stretchr/testify/require"
+)
+
+// testWebhook is a local stand-in for a webhook receiving audit notifications
+type testWebhook struct {
+	mu            sync.Mutex
+	failures      int
+	notifications []AuditNotification
+	signatures    []string
+	bodies        [][]byte
+}
+
+func (wh *testWebhook) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if wh.failures > 0 {
+		wh.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	var n AuditNotification
+	if err := json.Unmarshal(body, &n); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	wh.notifications = append(wh.notifications, n)
+	wh.signatures = append(wh.signatures, req.Header.Get(NotificationSignatureHeader))
+	wh.bodies = append(wh.bodies, body)
+}
+
+func (wh *testWebhook) received() int {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	return len(wh.notifications)
+}
+
+func queuedNotifications(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	return files
+}
+
+func TestNotifier(t *testing.T) {
+	wh := &testWebhook{failures: 1}
+	srv := httptest.NewServer(wh)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	l := logger.NewSimpleLogger("notifier_test", os.Stdout)
+
+	n, err := newNotifier(dir, []string{srv.URL}, "secret", 3, time.Millisecond, l)
+	require.NoError(t, err)
+
+	prevState := &schema.ImmutableState{TxId: 1, TxHash: []byte{1}}
+	currState := &schema.ImmutableState{TxId: 2, TxHash: []byte{2}}
+
+	// consistent, unchecked and failed audits are not notified
+	n.UpdateAuditResult("server1", "127.0.0.1:3322", "db1", true, false, true, prevState, currState)
+	n.UpdateAuditResult("server1", "127.0.0.1:3322", "db1", false, false, true, nil, currState)
+	n.UpdateAuditResult("server1", "127.0.0.1:3322", "db1", false, true, false, nil, nil)
+	require.Empty(t, queuedNotifications(t, dir))
+
+	n.UpdateAuditResult("server1", "127.0.0.1:3322", "db1", true, false, false, prevState, currState)
+	require.Len(t, queuedNotifications(t, dir), 1)
+
+	// the first attempt fails, the second one is delayed by the retry interval
+	n.deliverPending(nil)
+	require.Equal(t, 0, wh.received())
+	require.Len(t, queuedNotifications(t, dir), 1)
+
+	time.Sleep(5 * time.Millisecond)
+	n.deliverPending(nil)
+	require.Equal(t, 1, wh.received())
+	require.Empty(t, queuedNotifications(t, dir))
+
+	notification := wh.notifications[0]
+	require.Equal(t, "server1", notification.ServerID)
+	require.Equal(t, "127.0.0.1:3322", notification.ServerAddress)
+	require.Equal(t, "db1", notification.Database)
+	require.True(t, notification.Tampered)
+	require.Equal(t, VerificationConsistency, notification.Failure)
+	require.False(t, notification.Timestamp.IsZero())
+	require.Equal(t, uint64(1), notification.PreviousState.TxID)
+	require.Equal(t, "01", notification.PreviousState.TxHash)
+	require.Equal(t, uint64(2), notification.CurrentState.TxID)
+	require.Equal(t, "02", notification.CurrentState.TxHash)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(wh.bodies[0])
+	require.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), wh.signatures[0])
+}
+
+func TestNotifierAlerts(t *testing.T) {
+	dir := t.TempDir()
+	n, err := newNotifier(dir, []string{"http://localhost"}, "secret", 3, time.Hour, logger.NewSimpleLogger("notifier_test", os.Stdout))
+	require.NoError(t, err)
+
+	prevState := &schema.ImmutableState{TxId: 1, TxHash: []byte{1}}
+	currState := &schema.ImmutableState{TxId: 2, TxHash: []byte{2}}
+
+	// a database staying tampered is notified once
+	n.UpdateAuditResult("server1", "127.0.0.1:3322", "db1", true, false, false, prevState, currState)
+	n.UpdateAuditResult("server1", "127.0.0.1:3322", "db1", true, false, false, prevState, &schema.ImmutableState{TxId: 3, TxHash: []byte{3}})
+	require.Len(t, queuedNotifications(t, dir), 1)
+
+	// so is a state whose signature is not valid
+	n.UpdateAuditResult("server1", "127.0.0.1:3322", "db2", false, true, false, nil, currState)
+	n.UpdateAuditResult("server1", "127.0.0.1:3322", "db2", false, true, false, nil, currState)
+	require.Len(t, queuedNotifications(t, dir), 2)
+
+	qn, err := n.read(queuedNotifications(t, dir)[1])
+	require.NoError(t, err)
+	var notification AuditNotification
+	require.NoError(t, json.Unmarshal(qn.Payload, &notification))
+	require.Equal(t, "db2", notification.Database)
+	require.Equal(t, VerificationSignature, notification.Failure)
+	require.Nil(t, notification.PreviousState)
+
+	// another failure of the database is notified
+	n.UpdateAuditResult("server1", "127.0.0.1:3322", "db2", true, false, false, prevState, currState)
+	require.Len(t, queuedNotifications(t, dir), 3)
+
+	// the failed audits keep the database alerted, a consistent one does not
+	n.UpdateAuditResult("server1", "127.0.0.1:3322", "db1", false, true, false, nil, nil)
+	n.UpdateAuditResult("server1", "127.0.0.1:3322", "db1", true, false, false, prevState, currState)
+	require.Len(t, queuedNotifications(t, dir), 3)
+
+	n.UpdateAuditResult("server1", "127.0.0.1:3322", "db1", true, false, true, prevState, currState)
+	n.UpdateAuditResult("server1", "127.0.0.1:3322", "db1", true, false, false, prevState, currState)
+	require.Len(t, queuedNotifications(t, dir), 4)
+}
+
+func TestNotifierQueueSurvivesRestarts(t *testing.T) {
+	wh := &testWebhook{}
+	srv := httptest.NewServer(wh)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	l := logger.NewSimpleLogger("notifier_test", os.Stdout)
+
+	n, err := newNotifier(dir, []string{srv.URL, srv.URL + "/other"}, "secret", 3, time.Hour, l)
+	require.NoError(t, err)
+	require.NoError(t, n.Notify(&AuditNotification{Database: "db1", Tampered: true}))
+	require.Len(t, queuedNotifications(t, dir), 2)
+
+	n, err = newNotifier(dir, []string{srv.URL}, "secret", 3, time.Hour, l)
+	require.NoError(t, err)
+
+	stopc := make(chan struct{})
+	donec := make(chan struct{}, 1)
+	go n.Run(stopc, donec)
+
+	require.Eventually(t, func() bool { return wh.received() == 2 }, 5*time.Second, 10*time.Millisecond)
+	close(stopc)
+	<-donec
+
+	require.Empty(t, queuedNotifications(t, dir))
+}
+
+func TestNotifierGivesUp(t *testing.T) {
+	wh := &testWebhook{failures: 10}
+	srv := httptest.NewServer(wh)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	n, err := newNotifier(dir, []string{srv.URL}, "secret", 2, time.Nanosecond, logger.NewSimpleLogger("notifier_test", os.Stdout))
+	require.NoError(t, err)
+	require.NoError(t, n.Notify(&AuditNotification{Database: "db1", Tampered: true}))
+
+	n.deliverPending(nil)
+	time.Sleep(time.Millisecond)
+	n.deliverPending(nil)
+
+	require.Empty(t, queuedNotifications(t, dir))
+	failed := queuedNotifications(t, filepath.Join(dir, notificationFailedDir))
+	require.Len(t, failed, 1)
+
+	qn, err := n.read(failed[0])
+	require.NoError(t, err)
+	require.Equal(t, 2, qn.Attempts)
+	require.Contains(t, qn.LastError, "503")
+}
+
+func TestNewNotifierWithoutSecret(t *testing.T) {
+	_, err := newNotifier(t.TempDir(), []string{"http://localhost"}, "", 1, time.Second, logger.NewSimpleLogger("notifier_test", os.Stdout))
+	require.ErrorIs(t, err, ErrNotificationSecretRequired)
+}
+
+func TestNewNotifierWithoutRetryInterval(t *testing.T) {
+	l := logger.NewSimpleLogger("notifier_test", os.Stdout)
+	_, err := newNotifier(t.TempDir(), []string{"http://localhost"}, "secret", 1, 0, l)
+	require.ErrorIs(t, err, ErrInvalidNotificationRetry)
+
+	_, err = newNotifier(t.TempDir(), []string{"http://localhost"}, "secret", 1, -time.Second, l)
+	require.ErrorIs(t, err, ErrInvalidNotificationRetry)
+}
+
+func TestNotifierRetryDelay(t *testing.T) {
+	n := &notifier{retryInterval: time.Minute}
+	require.Equal(t, time.Minute, n.retryDelay(1))
+	require.Equal(t, 2*time.Minute, n.retryDelay(2))
+	require.Equal(t, 8*time.Minute, n.retryDelay(4))
+	require.Equal(t, notificationMaxRetryDelay, n.retryDelay(100))
+}
+
+func TestChainAuditResults(t *testing.T) {
+	var calls []string
+	f := chainAuditResults(
+		func(_ string, _ string, database string, _ bool, _ bool, _ bool, _ *schema.ImmutableState, _ *schema.ImmutableState) {
+			calls = append(calls, "first "+database)
+		},
+		func(_ string, _ string, database string, _ bool, _ bool, _ bool, _ *schema.ImmutableState, _ *schema.ImmutableState) {
+			calls = append(calls, "second "+database)
+		},
+	)
+	f("server1", "127.0.0.1", "db1", true, false, true, nil, nil)
+	require.Equal(t, []string{"first db1", "second db1"}, calls)
+}
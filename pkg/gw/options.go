@@ -19,6 +19,7 @@ package gw
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/codenotary/immudb/pkg/client"
@@ -27,45 +28,133 @@ import (
 
 // Options immudb gateway server options
 type Options struct {
-	Dir            string
-	Address        string
-	Port           int
-	MetricsPort    int
-	ImmudbAddress  string
-	ImmudbPort     int
-	Audit          bool
-	AuditInterval  time.Duration
-	AuditUsername  string
-	AuditPassword  string `json:"-"`
-	AuditSignature string
-	Detached       bool
-	MTLs           bool
-	MTLsOptions    client.MTLsOptions
-	Config         string
-	Pidfile        string
-	Logfile        string
-	TokenService   tokenservice.TokenService
+	Dir                            string
+	Address                        string
+	Port                           int
+	MetricsPort                    int
+	ImmudbAddress                  string
+	ImmudbPort                     int
+	Audit                          bool
+	AuditInterval                  time.Duration
+	AuditUsername                  string
+	AuditPassword                  string `json:"-"`
+	AuditSignature                 string
+	AuditDatabases                 []string
+	AuditNotificationURLs          []string
+	AuditNotificationSecret        string `json:"-"`
+	AuditNotificationRetries       int
+	AuditNotificationRetryInterval time.Duration
+	AuditServerSigningPubKey       string
+	AuditRunToken                  string `json:"-"`
+	ServerSigningPubKey            string
+	TLSCertificate                 string
+	TLSKey                         string
+	TLSMinVersion                  string
+	TLSClientCAs                   string
+	ShutdownTimeout                time.Duration
+	LivenessChecks                 []string
+	ReadinessChecks                []string
+	TracingExporter                string
+	TracingEndpoint                string
+	TracingInsecure                bool
+	TracingFile                    string
+	TracingSampleRatio             float64
+	AccessLog                      bool
+	AccessLogFile                  string
+	APIKeysFile                    string
+	JWTJWKS                        string
+	JWTIssuer                      string
+	JWTAudience                    string
+	JWTMappingFile                 string
+	PolicyFile                     string
+	PolicyDryRun                   bool
+	RateLimitsFile                 string
+	CORSAllowedOrigins             []string
+	CORSAllowedMethods             []string
+	CORSAllowedHeaders             []string
+	CORSExposedHeaders             []string
+	CORSAllowCredentials           bool
+	CORSMaxAge                     time.Duration
+	CORSRoutes                     []CORSRoute
+	MaxReadBodySize                int64
+	MaxWriteBodySize               int64
+	MaxAdminBodySize               int64
+	MaxStreamSize                  int64
+	StrictJSON                     bool
+	ClientIdleTimeout              time.Duration
+	MaxUserClients                 int
+	Detached                       bool
+	MTLs                           bool
+	MTLsOptions                    client.MTLsOptions
+	Config                         string
+	Pidfile                        string
+	Logfile                        string
+	LogLevel                       string
+	ConfigWatch                    bool
+	TokenService                   tokenservice.TokenService
 }
 
 // DefaultOptions ...
 func DefaultOptions() Options {
 	return Options{
-		Dir:            ".",
-		Address:        "0.0.0.0",
-		Port:           3323,
-		MetricsPort:    9476,
-		ImmudbAddress:  "127.0.0.1",
-		ImmudbPort:     3322,
-		Audit:          false,
-		AuditInterval:  5 * time.Minute,
-		AuditUsername:  "immugwauditor",
-		AuditPassword:  "",
-		AuditSignature: "ignore",
-		Detached:       false,
-		MTLs:           false,
-		Config:         "configs/immugw.toml",
-		Pidfile:        "",
-		Logfile:        "",
+		Dir:                            ".",
+		Address:                        "0.0.0.0",
+		Port:                           3323,
+		MetricsPort:                    9476,
+		ImmudbAddress:                  "127.0.0.1",
+		ImmudbPort:                     3322,
+		Audit:                          false,
+		AuditInterval:                  5 * time.Minute,
+		AuditUsername:                  "immugwauditor",
+		AuditPassword:                  "",
+		AuditSignature:                 "ignore",
+		AuditServerSigningPubKey:       "",
+		AuditNotificationRetries:       10,
+		AuditNotificationRetryInterval: 30 * time.Second,
+		ServerSigningPubKey:            "",
+		TLSCertificate:                 "",
+		TLSKey:                         "",
+		TLSMinVersion:                  "1.2",
+		TLSClientCAs:                   "",
+		ShutdownTimeout:                30 * time.Second,
+		LivenessChecks:                 []string{},
+		ReadinessChecks:                []string{HealthCheckImmudb, HealthCheckClients, HealthCheckStateDirs, HealthCheckAudit},
+		TracingExporter:                "",
+		TracingEndpoint:                "localhost:4317",
+		TracingInsecure:                false,
+		TracingFile:                    "",
+		TracingSampleRatio:             1,
+		AccessLog:                      false,
+		AccessLogFile:                  "",
+		APIKeysFile:                    "",
+		JWTJWKS:                        "",
+		JWTIssuer:                      "",
+		JWTAudience:                    "",
+		JWTMappingFile:                 "",
+		PolicyFile:                     "",
+		PolicyDryRun:                   false,
+		RateLimitsFile:                 "",
+		CORSAllowedOrigins:             []string{"*"},
+		CORSAllowedMethods:             []string{http.MethodGet, http.MethodPost, http.MethodHead},
+		CORSAllowedHeaders:             []string{"Origin", "Accept", "Content-Type", "X-Requested-With"},
+		CORSExposedHeaders:             nil,
+		CORSAllowCredentials:           false,
+		CORSMaxAge:                     0,
+		CORSRoutes:                     nil,
+		MaxReadBodySize:                1 << 20,
+		MaxWriteBodySize:               32 << 20,
+		MaxAdminBodySize:               1 << 20,
+		MaxStreamSize:                  1 << 30,
+		StrictJSON:                     false,
+		ClientIdleTimeout:              15 * time.Minute,
+		MaxUserClients:                 1000,
+		Detached:                       false,
+		MTLs:                           false,
+		Config:                         "configs/immugw.toml",
+		Pidfile:                        "",
+		Logfile:                        "",
+		LogLevel:                       "",
+		ConfigWatch:                    false,
 	}
 }
 
@@ -131,6 +220,277 @@ func (o Options) WithAuditSignature(auditSignature string) Options {
 	return o
 }
 
+// WithAuditDatabases sets AuditDatabases
+func (o Options) WithAuditDatabases(auditDatabases []string) Options {
+	o.AuditDatabases = auditDatabases
+	return o
+}
+
+// WithAuditNotificationURLs sets AuditNotificationURLs
+func (o Options) WithAuditNotificationURLs(auditNotificationURLs []string) Options {
+	o.AuditNotificationURLs = auditNotificationURLs
+	return o
+}
+
+// WithAuditNotificationSecret sets AuditNotificationSecret
+func (o Options) WithAuditNotificationSecret(auditNotificationSecret string) Options {
+	o.AuditNotificationSecret = auditNotificationSecret
+	return o
+}
+
+// WithAuditNotificationRetries sets AuditNotificationRetries
+func (o Options) WithAuditNotificationRetries(auditNotificationRetries int) Options {
+	o.AuditNotificationRetries = auditNotificationRetries
+	return o
+}
+
+// WithAuditNotificationRetryInterval sets AuditNotificationRetryInterval
+func (o Options) WithAuditNotificationRetryInterval(auditNotificationRetryInterval time.Duration) Options {
+	o.AuditNotificationRetryInterval = auditNotificationRetryInterval
+	return o
+}
+
+// WithAuditServerSigningPubKey sets AuditServerSigningPubKey
+func (o Options) WithAuditServerSigningPubKey(auditServerSigningPubKey string) Options {
+	o.AuditServerSigningPubKey = auditServerSigningPubKey
+	return o
+}
+
+// WithAuditRunToken sets AuditRunToken
+func (o Options) WithAuditRunToken(auditRunToken string) Options {
+	o.AuditRunToken = auditRunToken
+	return o
+}
+
+// WithServerSigningPubKey sets ServerSigningPubKey
+func (o Options) WithServerSigningPubKey(serverSigningPubKey string) Options {
+	o.ServerSigningPubKey = serverSigningPubKey
+	return o
+}
+
+// WithTLSCertificate sets TLSCertificate
+func (o Options) WithTLSCertificate(tlsCertificate string) Options {
+	o.TLSCertificate = tlsCertificate
+	return o
+}
+
+// WithTLSKey sets TLSKey
+func (o Options) WithTLSKey(tlsKey string) Options {
+	o.TLSKey = tlsKey
+	return o
+}
+
+// WithTLSMinVersion sets TLSMinVersion
+func (o Options) WithTLSMinVersion(tlsMinVersion string) Options {
+	o.TLSMinVersion = tlsMinVersion
+	return o
+}
+
+// WithTLSClientCAs sets TLSClientCAs
+func (o Options) WithTLSClientCAs(tlsClientCAs string) Options {
+	o.TLSClientCAs = tlsClientCAs
+	return o
+}
+
+// WithShutdownTimeout sets ShutdownTimeout
+func (o Options) WithShutdownTimeout(shutdownTimeout time.Duration) Options {
+	o.ShutdownTimeout = shutdownTimeout
+	return o
+}
+
+// WithLivenessChecks sets LivenessChecks
+func (o Options) WithLivenessChecks(livenessChecks []string) Options {
+	o.LivenessChecks = livenessChecks
+	return o
+}
+
+// WithReadinessChecks sets ReadinessChecks
+func (o Options) WithReadinessChecks(readinessChecks []string) Options {
+	o.ReadinessChecks = readinessChecks
+	return o
+}
+
+// WithTracingExporter sets TracingExporter
+func (o Options) WithTracingExporter(tracingExporter string) Options {
+	o.TracingExporter = tracingExporter
+	return o
+}
+
+// WithTracingEndpoint sets TracingEndpoint
+func (o Options) WithTracingEndpoint(tracingEndpoint string) Options {
+	o.TracingEndpoint = tracingEndpoint
+	return o
+}
+
+// WithTracingInsecure sets TracingInsecure
+func (o Options) WithTracingInsecure(tracingInsecure bool) Options {
+	o.TracingInsecure = tracingInsecure
+	return o
+}
+
+// WithTracingFile sets TracingFile
+func (o Options) WithTracingFile(tracingFile string) Options {
+	o.TracingFile = tracingFile
+	return o
+}
+
+// WithTracingSampleRatio sets TracingSampleRatio
+func (o Options) WithTracingSampleRatio(tracingSampleRatio float64) Options {
+	o.TracingSampleRatio = tracingSampleRatio
+	return o
+}
+
+// WithAccessLog sets AccessLog
+func (o Options) WithAccessLog(accessLog bool) Options {
+	o.AccessLog = accessLog
+	return o
+}
+
+// WithAccessLogFile sets AccessLogFile
+func (o Options) WithAccessLogFile(accessLogFile string) Options {
+	o.AccessLogFile = accessLogFile
+	return o
+}
+
+// WithAPIKeysFile sets APIKeysFile
+func (o Options) WithAPIKeysFile(apiKeysFile string) Options {
+	o.APIKeysFile = apiKeysFile
+	return o
+}
+
+// WithJWTJWKS sets JWTJWKS, the file or http(s) URL of the key set the JWT
+// bearer tokens are verified with
+func (o Options) WithJWTJWKS(jwks string) Options {
+	o.JWTJWKS = jwks
+	return o
+}
+
+// WithJWTIssuer sets JWTIssuer
+func (o Options) WithJWTIssuer(issuer string) Options {
+	o.JWTIssuer = issuer
+	return o
+}
+
+// WithJWTAudience sets JWTAudience
+func (o Options) WithJWTAudience(audience string) Options {
+	o.JWTAudience = audience
+	return o
+}
+
+// WithJWTMappingFile sets JWTMappingFile
+func (o Options) WithJWTMappingFile(mappingFile string) Options {
+	o.JWTMappingFile = mappingFile
+	return o
+}
+
+// WithPolicyFile sets PolicyFile
+func (o Options) WithPolicyFile(policyFile string) Options {
+	o.PolicyFile = policyFile
+	return o
+}
+
+// WithPolicyDryRun sets PolicyDryRun
+func (o Options) WithPolicyDryRun(dryRun bool) Options {
+	o.PolicyDryRun = dryRun
+	return o
+}
+
+// WithRateLimitsFile sets RateLimitsFile
+func (o Options) WithRateLimitsFile(rateLimitsFile string) Options {
+	o.RateLimitsFile = rateLimitsFile
+	return o
+}
+
+// WithCORSAllowedOrigins sets CORSAllowedOrigins, an origin can have a
+// wildcard, e.g. https://*.example.com
+func (o Options) WithCORSAllowedOrigins(origins []string) Options {
+	o.CORSAllowedOrigins = origins
+	return o
+}
+
+// WithCORSAllowedMethods sets CORSAllowedMethods
+func (o Options) WithCORSAllowedMethods(methods []string) Options {
+	o.CORSAllowedMethods = methods
+	return o
+}
+
+// WithCORSAllowedHeaders sets CORSAllowedHeaders
+func (o Options) WithCORSAllowedHeaders(headers []string) Options {
+	o.CORSAllowedHeaders = headers
+	return o
+}
+
+// WithCORSExposedHeaders sets CORSExposedHeaders
+func (o Options) WithCORSExposedHeaders(headers []string) Options {
+	o.CORSExposedHeaders = headers
+	return o
+}
+
+// WithCORSAllowCredentials sets CORSAllowCredentials
+func (o Options) WithCORSAllowCredentials(allowCredentials bool) Options {
+	o.CORSAllowCredentials = allowCredentials
+	return o
+}
+
+// WithCORSMaxAge sets CORSMaxAge
+func (o Options) WithCORSMaxAge(maxAge time.Duration) Options {
+	o.CORSMaxAge = maxAge
+	return o
+}
+
+// WithCORSRoutes sets CORSRoutes, the CORS policies of the route prefixes
+func (o Options) WithCORSRoutes(routes []CORSRoute) Options {
+	o.CORSRoutes = routes
+	return o
+}
+
+// WithMaxReadBodySize sets MaxReadBodySize, the maximum size in bytes of the
+// bodies of the read routes, unlimited if 0
+func (o Options) WithMaxReadBodySize(size int64) Options {
+	o.MaxReadBodySize = size
+	return o
+}
+
+// WithMaxWriteBodySize sets MaxWriteBodySize, the maximum size in bytes of
+// the bodies of the write routes, unlimited if 0
+func (o Options) WithMaxWriteBodySize(size int64) Options {
+	o.MaxWriteBodySize = size
+	return o
+}
+
+// WithMaxAdminBodySize sets MaxAdminBodySize, the maximum size in bytes of
+// the bodies of the administrative routes, unlimited if 0
+func (o Options) WithMaxAdminBodySize(size int64) Options {
+	o.MaxAdminBodySize = size
+	return o
+}
+
+// WithMaxStreamSize sets MaxStreamSize, the maximum size in bytes of the
+// values uploaded to the stream routes, unlimited if 0
+func (o Options) WithMaxStreamSize(size int64) Options {
+	o.MaxStreamSize = size
+	return o
+}
+
+// WithStrictJSON sets StrictJSON, rejecting the JSON request bodies with
+// unknown fields or trailing data
+func (o Options) WithStrictJSON(strict bool) Options {
+	o.StrictJSON = strict
+	return o
+}
+
+// WithClientIdleTimeout sets ClientIdleTimeout
+func (o Options) WithClientIdleTimeout(clientIdleTimeout time.Duration) Options {
+	o.ClientIdleTimeout = clientIdleTimeout
+	return o
+}
+
+// WithMaxUserClients sets MaxUserClients
+func (o Options) WithMaxUserClients(maxUserClients int) Options {
+	o.MaxUserClients = maxUserClients
+	return o
+}
+
 // WithMTLs sets MTLs
 func (o Options) WithMTLs(MTLs bool) Options {
 	o.MTLs = MTLs
@@ -167,6 +527,22 @@ func (o Options) WithLogfile(logfile string) Options {
 	return o
 }
 
+// WithLogLevel sets LogLevel
+func (o Options) WithLogLevel(logLevel string) Options {
+	o.LogLevel = logLevel
+	return o
+}
+
+// WithConfigWatch sets ConfigWatch
+func (o Options) WithConfigWatch(configWatch bool) Options {
+	o.ConfigWatch = configWatch
+	return o
+}
+
+// WithTokenService sets TokenService
+//
+// Deprecated: the gateway no longer shares a token service between its
+// clients, every user client keeps its own token in memory.
 func (o Options) WithTokenService(tokenService tokenservice.TokenService) Options {
 	o.TokenService = tokenService
 	return o
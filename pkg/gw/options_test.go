@@ -35,12 +35,57 @@ func TestOptions(t *testing.T) {
 	require.Equal(t, 5*time.Minute, opts.AuditInterval)
 	require.Equal(t, "immugwauditor", opts.AuditUsername)
 	require.Empty(t, opts.AuditPassword)
+	require.Empty(t, opts.AuditServerSigningPubKey)
+	require.Empty(t, opts.ServerSigningPubKey)
+	require.Empty(t, opts.AuditNotificationURLs)
+	require.Empty(t, opts.AuditNotificationSecret)
+	require.Equal(t, 10, opts.AuditNotificationRetries)
+	require.Equal(t, 30*time.Second, opts.AuditNotificationRetryInterval)
+	require.Empty(t, opts.AuditRunToken)
+	require.Empty(t, opts.TLSCertificate)
+	require.Empty(t, opts.TLSKey)
+	require.Equal(t, "1.2", opts.TLSMinVersion)
+	require.Empty(t, opts.TLSClientCAs)
+	require.Equal(t, 30*time.Second, opts.ShutdownTimeout)
+	require.Empty(t, opts.LivenessChecks)
+	require.Equal(t, []string{"immudb", "clients", "state-dirs", "audit"}, opts.ReadinessChecks)
+	require.Empty(t, opts.TracingExporter)
+	require.Equal(t, "localhost:4317", opts.TracingEndpoint)
+	require.False(t, opts.TracingInsecure)
+	require.Empty(t, opts.TracingFile)
+	require.Equal(t, float64(1), opts.TracingSampleRatio)
+	require.False(t, opts.AccessLog)
+	require.Empty(t, opts.AccessLogFile)
+	require.Empty(t, opts.APIKeysFile)
+	require.Empty(t, opts.JWTJWKS)
+	require.Empty(t, opts.JWTIssuer)
+	require.Empty(t, opts.JWTAudience)
+	require.Empty(t, opts.JWTMappingFile)
+	require.Empty(t, opts.PolicyFile)
+	require.False(t, opts.PolicyDryRun)
+	require.Empty(t, opts.RateLimitsFile)
+	require.Equal(t, []string{"*"}, opts.CORSAllowedOrigins)
+	require.Equal(t, []string{"GET", "POST", "HEAD"}, opts.CORSAllowedMethods)
+	require.Equal(t, []string{"Origin", "Accept", "Content-Type", "X-Requested-With"}, opts.CORSAllowedHeaders)
+	require.Empty(t, opts.CORSExposedHeaders)
+	require.False(t, opts.CORSAllowCredentials)
+	require.Zero(t, opts.CORSMaxAge)
+	require.Empty(t, opts.CORSRoutes)
+	require.Equal(t, int64(1<<20), opts.MaxReadBodySize)
+	require.Equal(t, int64(32<<20), opts.MaxWriteBodySize)
+	require.Equal(t, int64(1<<20), opts.MaxAdminBodySize)
+	require.Equal(t, int64(1<<30), opts.MaxStreamSize)
+	require.False(t, opts.StrictJSON)
+	require.Equal(t, 15*time.Minute, opts.ClientIdleTimeout)
+	require.Equal(t, 1000, opts.MaxUserClients)
 	require.False(t, opts.Detached)
 	require.False(t, opts.MTLs)
 	require.Equal(t, "configs/immugw.toml", opts.Config)
 	require.Equal(t, ".", opts.Dir)
 	require.Empty(t, opts.Pidfile)
 	require.Empty(t, opts.Logfile)
+	require.Empty(t, opts.LogLevel)
+	require.False(t, opts.ConfigWatch)
 
 	require.Equal(t, "111.1.1.1", opts.WithAddress("111.1.1.1").Address)
 	require.Equal(t, 1111, opts.WithPort(1111).Port)
@@ -54,6 +99,56 @@ func TestOptions(t *testing.T) {
 		t, "someAuditor", opts.WithAuditUsername("someAuditor").AuditUsername)
 	require.Equal(
 		t, "somePassword", opts.WithAuditPassword("somePassword").AuditPassword)
+	require.Equal(
+		t, []string{"db1", "db2"}, opts.WithAuditDatabases([]string{"db1", "db2"}).AuditDatabases)
+	require.Equal(
+		t, []string{"http://localhost"}, opts.WithAuditNotificationURLs([]string{"http://localhost"}).AuditNotificationURLs)
+	require.Equal(
+		t, "someSecret", opts.WithAuditNotificationSecret("someSecret").AuditNotificationSecret)
+	require.Equal(t, 3, opts.WithAuditNotificationRetries(3).AuditNotificationRetries)
+	require.Equal(
+		t, time.Minute, opts.WithAuditNotificationRetryInterval(time.Minute).AuditNotificationRetryInterval)
+	require.Equal(t, "someToken", opts.WithAuditRunToken("someToken").AuditRunToken)
+	require.Equal(
+		t, "./somePubKey.pem", opts.WithAuditServerSigningPubKey("./somePubKey.pem").AuditServerSigningPubKey)
+	require.Equal(
+		t, "./somePubKey.pem", opts.WithServerSigningPubKey("./somePubKey.pem").ServerSigningPubKey)
+	require.Equal(t, "./cert.pem", opts.WithTLSCertificate("./cert.pem").TLSCertificate)
+	require.Equal(t, "./key.pem", opts.WithTLSKey("./key.pem").TLSKey)
+	require.Equal(t, "1.3", opts.WithTLSMinVersion("1.3").TLSMinVersion)
+	require.Equal(t, "./ca.pem", opts.WithTLSClientCAs("./ca.pem").TLSClientCAs)
+	require.Equal(t, time.Minute, opts.WithShutdownTimeout(time.Minute).ShutdownTimeout)
+	require.Equal(t, []string{"immudb"}, opts.WithLivenessChecks([]string{"immudb"}).LivenessChecks)
+	require.Equal(t, []string{"audit"}, opts.WithReadinessChecks([]string{"audit"}).ReadinessChecks)
+	require.Equal(t, "otlp", opts.WithTracingExporter("otlp").TracingExporter)
+	require.Equal(t, "collector:4317", opts.WithTracingEndpoint("collector:4317").TracingEndpoint)
+	require.True(t, opts.WithTracingInsecure(true).TracingInsecure)
+	require.Equal(t, "./traces.json", opts.WithTracingFile("./traces.json").TracingFile)
+	require.Equal(t, 0.5, opts.WithTracingSampleRatio(0.5).TracingSampleRatio)
+	require.True(t, opts.WithAccessLog(true).AccessLog)
+	require.Equal(t, "./access.log", opts.WithAccessLogFile("./access.log").AccessLogFile)
+	require.Equal(t, "./api_keys.json", opts.WithAPIKeysFile("./api_keys.json").APIKeysFile)
+	require.Equal(t, "https://idp/jwks", opts.WithJWTJWKS("https://idp/jwks").JWTJWKS)
+	require.Equal(t, "https://idp", opts.WithJWTIssuer("https://idp").JWTIssuer)
+	require.Equal(t, "immugw", opts.WithJWTAudience("immugw").JWTAudience)
+	require.Equal(t, "./jwt_mapping.json", opts.WithJWTMappingFile("./jwt_mapping.json").JWTMappingFile)
+	require.Equal(t, "./policy.yaml", opts.WithPolicyFile("./policy.yaml").PolicyFile)
+	require.True(t, opts.WithPolicyDryRun(true).PolicyDryRun)
+	require.Equal(t, "./rate_limits.yaml", opts.WithRateLimitsFile("./rate_limits.yaml").RateLimitsFile)
+	require.Equal(t, []string{"https://*.example.com"}, opts.WithCORSAllowedOrigins([]string{"https://*.example.com"}).CORSAllowedOrigins)
+	require.Equal(t, []string{"PUT"}, opts.WithCORSAllowedMethods([]string{"PUT"}).CORSAllowedMethods)
+	require.Equal(t, []string{"Authorization"}, opts.WithCORSAllowedHeaders([]string{"Authorization"}).CORSAllowedHeaders)
+	require.Equal(t, []string{"X-Request-Id"}, opts.WithCORSExposedHeaders([]string{"X-Request-Id"}).CORSExposedHeaders)
+	require.True(t, opts.WithCORSAllowCredentials(true).CORSAllowCredentials)
+	require.Equal(t, time.Hour, opts.WithCORSMaxAge(time.Hour).CORSMaxAge)
+	require.Equal(t, []CORSRoute{{Prefix: "/user"}}, opts.WithCORSRoutes([]CORSRoute{{Prefix: "/user"}}).CORSRoutes)
+	require.Equal(t, int64(1024), opts.WithMaxReadBodySize(1024).MaxReadBodySize)
+	require.Equal(t, int64(2048), opts.WithMaxWriteBodySize(2048).MaxWriteBodySize)
+	require.Equal(t, int64(512), opts.WithMaxAdminBodySize(512).MaxAdminBodySize)
+	require.Equal(t, int64(512), opts.WithMaxStreamSize(512).MaxStreamSize)
+	require.True(t, opts.WithStrictJSON(true).StrictJSON)
+	require.Equal(t, time.Minute, opts.WithClientIdleTimeout(time.Minute).ClientIdleTimeout)
+	require.Equal(t, 10, opts.WithMaxUserClients(10).MaxUserClients)
 	require.True(t, opts.WithDetached(true).Detached)
 	require.True(t, opts.WithMTLs(true).MTLs)
 	require.Equal(t, "someServer", opts.WithMTLsOptions(
@@ -64,6 +159,8 @@ func TestOptions(t *testing.T) {
 	require.Equal(t, "./somePidfile", opts.WithPidfile("./somePidfile").Pidfile)
 	require.Equal(
 		t, "./someLogfile.log", opts.WithLogfile("./someLogfile.log").Logfile)
+	require.Equal(t, "debug", opts.WithLogLevel("debug").LogLevel)
+	require.True(t, opts.WithConfigWatch(true).ConfigWatch)
 
 	require.Equal(t, "0.0.0.0:3323", opts.Bind())
 	require.Equal(t, "0.0.0.0:9476", opts.MetricsBind())
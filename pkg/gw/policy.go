@@ -0,0 +1,254 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/codenotary/immudb/embedded/logger"
+	"github.com/spf13/viper"
+)
+
+const (
+	// PolicyAllow and PolicyDeny are the effects of the policy rules
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+
+	// policyRoutePrefix is the service prefix of the route pattern names,
+	// optional in the policies
+	policyRoutePrefix = "ImmuService_"
+)
+
+// Policy is the route policy file, YAML, TOML or JSON depending on its
+// extension
+type Policy struct {
+	// Default is the effect applied to the requests matching no rule, deny
+	// if empty
+	Default string `mapstructure:"default"`
+	// Rules are evaluated in order, the first matching one applies
+	Rules []PolicyRule `mapstructure:"rules"`
+}
+
+// PolicyRule allows or denies the requests matching all of its non empty
+// criteria. The routes, databases, identities and roles can be shell
+// patterns, e.g. ImmuService_Verified* or tenant-*.
+type PolicyRule struct {
+	Name   string `mapstructure:"name"`
+	Effect string `mapstructure:"effect"`
+	// Methods are the HTTP methods of the requests
+	Methods []string `mapstructure:"methods"`
+	// Routes are the route pattern names, e.g. ImmuService_DeleteDatabase,
+	// the ImmuService_ prefix being optional
+	Routes []string `mapstructure:"routes"`
+	// Databases are the databases of the route path, and the ones named by
+	// the body of the admin routes, e.g. the database to delete
+	Databases []string `mapstructure:"databases"`
+	// Identities match the immudb user of the API key or JWT, the API key
+	// name, the JWT subject or the client certificate subject of the caller.
+	// The user of an immudb token, not verified by the gateway, is not
+	// matched.
+	Identities []string `mapstructure:"identities"`
+	// Roles match the roles of the API key or JWT identity of the caller
+	Roles []string `mapstructure:"roles"`
+}
+
+// policyRequest is what a policy decides on
+type policyRequest struct {
+	method     string
+	route      string
+	database   string
+	identities []string
+	roles      []string
+}
+
+// loadPolicy reads and validates the policy file
+func loadPolicy(file string) (*Policy, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	var p Policy
+	if err := v.Unmarshal(&p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	p.Default = strings.ToLower(p.Default)
+	if p.Default == "" {
+		p.Default = PolicyDeny
+	}
+	if p.Default != PolicyAllow && p.Default != PolicyDeny {
+		return fmt.Errorf("%w: default must be allow or deny", ErrInvalidPolicy)
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i)
+		}
+		r.Effect = strings.ToLower(r.Effect)
+		if r.Effect != PolicyAllow && r.Effect != PolicyDeny {
+			return fmt.Errorf("%w: %s: effect must be allow or deny", ErrInvalidPolicy, r.Name)
+		}
+		for j, m := range r.Methods {
+			r.Methods[j] = strings.ToUpper(m)
+		}
+		for j, route := range r.Routes {
+			r.Routes[j] = strings.TrimPrefix(route, policyRoutePrefix)
+		}
+		for _, patterns := range [][]string{r.Methods, r.Routes, r.Databases, r.Identities, r.Roles} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("%w: %s: invalid pattern %s", ErrInvalidPolicy, r.Name, pattern)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// decide returns the effect of p on req and the name of the rule it comes
+// from, empty for the default
+func (p *Policy) decide(req policyRequest) (string, string) {
+	for _, r := range p.Rules {
+		if matchAny(r.Methods, req.method) &&
+			matchAny(r.Routes, req.route) &&
+			matchAny(r.Databases, req.database) &&
+			matchAny(r.Identities, req.identities...) &&
+			matchAny(r.Roles, req.roles...) {
+			return r.Effect, r.Name
+		}
+	}
+	return p.Default, ""
+}
+
+// matchAny reports whether one of the values matches one of the patterns,
+// true if there are no patterns
+func matchAny(patterns []string, values ...string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		for _, v := range values {
+			if ok, _ := path.Match(pattern, v); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// policies checks the routes against the current policy, replaced on
+// configuration reloads. Every route is allowed when there is no policy. In
+// dry run mode the decisions are logged but not enforced.
+type policies struct {
+	logger logger.Logger
+
+	mu     sync.RWMutex
+	policy *Policy
+	dryRun bool
+}
+
+func newPolicies(l logger.Logger) *policies {
+	return &policies{logger: l}
+}
+
+// load replaces the policy with the one of file, removing it if file is
+// empty. The current policy is kept when file is not valid.
+func (p *policies) load(file string, dryRun bool) error {
+	policy, err := readPolicy(file)
+	if err != nil {
+		return err
+	}
+	p.set(policy, dryRun)
+	return nil
+}
+
+// readPolicy returns the policy of file, nil if file is empty
+func readPolicy(file string) (*Policy, error) {
+	if file == "" {
+		return nil, nil
+	}
+	return loadPolicy(file)
+}
+
+// set replaces the policy with policy
+func (p *policies) set(policy *Policy, dryRun bool) {
+	p.mu.Lock()
+	p.policy = policy
+	p.dryRun = dryRun
+	p.mu.Unlock()
+}
+
+type policiesKey struct{}
+
+// handler makes p available to the requests served by h
+func (p *policies) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), policiesKey{}, p)))
+	})
+}
+
+// policiesFromContext returns the policies of the request, nil policies
+// allow every route
+func policiesFromContext(ctx context.Context) *policies {
+	p, _ := ctx.Value(policiesKey{}).(*policies)
+	return p
+}
+
+// authorize checks that the policy allows req, run under id if not nil, to
+// access the route name on database
+func (p *policies) authorize(req *http.Request, name string, database string, id *identity) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	policy, dryRun := p.policy, p.dryRun
+	p.mu.RUnlock()
+	if policy == nil {
+		return nil
+	}
+
+	r := policyRequest{method: req.Method, route: name, database: database, identities: verifiedCallerIdentities(req, id)}
+	if id != nil {
+		r.roles = id.roles
+	}
+
+	effect, rule := policy.decide(r)
+	if rule == "" {
+		rule = "default"
+	}
+	if dryRun {
+		p.logger.Infof("policy dry run: %s %s %s database=%q identities=%q (%s)", effect, r.method, name, database, r.identities, rule)
+		return nil
+	}
+	if effect == PolicyDeny {
+		p.logger.Debugf("policy: deny %s %s database=%q identities=%q (%s)", r.method, name, database, r.identities, rule)
+		return ErrPolicyDenied
+	}
+	return nil
+}
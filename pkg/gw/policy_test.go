@@ -0,0 +1,250 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codenotary/immudb/embedded/logger"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immudb/pkg/auth"
+	"github.com/codenotary/immugw/pkg/api"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+default: allow
+rules:
+  - name: no-admin-routes
+    effect: deny
+    routes: [ImmuService_CreateUser, DeleteDatabase]
+  - name: auditors
+    effect: allow
+    methods: [post]
+    routes: [ImmuService_Verified*]
+    roles: [auditor]
+  - name: tenants
+    effect: deny
+    databases: [tenant-*]
+`
+
+func writePolicy(t *testing.T, name string, policy string) string {
+	file := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(file, []byte(policy), 0600))
+	return file
+}
+
+func TestLoadPolicy(t *testing.T) {
+	p, err := loadPolicy(writePolicy(t, "policy.yaml", testPolicy))
+	require.NoError(t, err)
+	require.Equal(t, PolicyAllow, p.Default)
+	require.Len(t, p.Rules, 3)
+	require.Equal(t, []string{"CreateUser", "DeleteDatabase"}, p.Rules[0].Routes)
+	require.Equal(t, []string{"POST"}, p.Rules[1].Methods)
+
+	p, err = loadPolicy(writePolicy(t, "policy.toml", `
+[[rules]]
+effect = "Allow"
+identities = ["alice"]
+databases = ["db1"]
+`))
+	require.NoError(t, err)
+	require.Equal(t, PolicyDeny, p.Default)
+	require.Equal(t, PolicyAllow, p.Rules[0].Effect)
+	require.Equal(t, "rule 0", p.Rules[0].Name)
+
+	_, err = loadPolicy(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.ErrorIs(t, err, ErrInvalidPolicy)
+	for _, policy := range []string{
+		"rules: [",
+		"default: maybe",
+		"rules:\n  - effect: maybe",
+		"rules:\n  - effect: deny\n    routes: ['[']",
+	} {
+		_, err := loadPolicy(writePolicy(t, "policy.yaml", policy))
+		require.ErrorIs(t, err, ErrInvalidPolicy, policy)
+	}
+}
+
+func TestPolicyDecide(t *testing.T) {
+	p, err := loadPolicy(writePolicy(t, "policy.yaml", testPolicy))
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		req    policyRequest
+		effect string
+		rule   string
+	}{
+		{policyRequest{method: "POST", route: "CreateUser"}, PolicyDeny, "no-admin-routes"},
+		{policyRequest{method: "POST", route: "VerifiedGet", database: "tenant-1", roles: []string{"auditor"}}, PolicyAllow, "auditors"},
+		{policyRequest{method: "GET", route: "VerifiedTxById", database: "tenant-1", roles: []string{"auditor"}}, PolicyDeny, "tenants"},
+		{policyRequest{method: "POST", route: "VerifiedGet", database: "tenant-1"}, PolicyDeny, "tenants"},
+		{policyRequest{method: "POST", route: "VerifiedGet", database: "db1"}, PolicyAllow, ""},
+	} {
+		effect, rule := p.decide(c.req)
+		require.Equal(t, c.effect, effect, c.req)
+		require.Equal(t, c.rule, rule, c.req)
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	var logs bytes.Buffer
+	p := newPolicies(logger.NewSimpleLogger("test", &logs))
+	file := writePolicy(t, "policy.yaml", `
+default: deny
+rules:
+  - effect: allow
+    identities: [ci, alice]
+    databases: [db1]
+  - effect: allow
+    roles: [auditor]
+`)
+	require.NoError(t, p.load(file, false))
+
+	keys, err := newAPIKeys([]APIKey{
+		{Name: "ci", Hash: apiKeyHash("key1"), Username: "ci-user", Password: "secret"},
+		{Name: "audit", Hash: apiKeyHash("key2"), Username: "auditor", Password: "secret", Roles: []string{"auditor"}},
+	}, &loginServiceClientMock{})
+	require.NoError(t, err)
+
+	served := false
+	mux := runtime.NewServeMux(runtime.WithProtoErrorHandler(routeErrorHandler(api.DefaultGWErrorHandler)))
+	h := func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		served = true
+		w.Write([]byte("{}"))
+	}
+	handleRoute(mux, "VerifiedGet", http.MethodPost, api.Pattern_ImmuService_VerifiedGet_0(), h)
+	requests := newRequestMetrics(prometheus.NewRegistry())
+
+	serve := func(p *policies, url string, authorization string) int {
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader("{}"))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", authorization)
+		rr := httptest.NewRecorder()
+		var handler http.Handler = keys.handler(mux)
+		if p != nil {
+			handler = p.handler(handler)
+		}
+		requests.handler(handler).ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	alice, err := auth.GenerateToken(auth.User{Username: "alice"}, 0, 60)
+	require.NoError(t, err)
+	bob, err := auth.GenerateToken(auth.User{Username: "bob"}, 0, 60)
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusOK, serve(p, "/db/db1/verified/get", "ApiKey key1"))
+	require.Equal(t, http.StatusOK, serve(p, "/db/db2/verified/get", "ApiKey key2"))
+
+	served = false
+	require.Equal(t, http.StatusForbidden, serve(p, "/db/db2/verified/get", "ApiKey key1"))
+	require.Equal(t, http.StatusForbidden, serve(p, "/db/db1/verified/get", "Bearer "+bob))
+	// the user of an immudb token, which anyone can forge, matches no identity
+	require.Equal(t, http.StatusForbidden, serve(p, "/db/db1/verified/get", "Bearer "+alice))
+	require.Equal(t, http.StatusForbidden, serve(p, "/db/db1/verified/get", ""))
+	require.False(t, served)
+
+	// no policies allow every route
+	require.Equal(t, http.StatusOK, serve(nil, "/db/db1/verified/get", "Bearer "+bob))
+
+	// in dry run mode the decisions are only logged
+	require.NoError(t, p.load(file, true))
+	require.Equal(t, http.StatusOK, serve(p, "/db/db1/verified/get", "Bearer "+bob))
+	require.Contains(t, logs.String(), `policy dry run: deny POST VerifiedGet database="db1" identities=[] (default)`)
+
+	// an invalid policy keeps the current one, no policy allows every route
+	require.ErrorIs(t, p.load(writePolicy(t, "policy.yaml", "default: maybe"), false), ErrInvalidPolicy)
+	require.True(t, p.dryRun)
+	require.NoError(t, p.load("", false))
+	require.Equal(t, http.StatusOK, serve(p, "/db/db1/verified/get", "Bearer "+bob))
+}
+
+func TestPoliciesBodyDatabase(t *testing.T) {
+	p := newPolicies(logger.NewSimpleLogger("test", os.Stdout))
+	require.NoError(t, p.load(writePolicy(t, "policy.yaml", `
+default: allow
+rules:
+  - effect: deny
+    routes: [DeleteDatabase, CreateUser]
+    databases: [prod]
+`), false))
+
+	var deleted string
+	mux := runtime.NewServeMux(runtime.WithProtoErrorHandler(routeErrorHandler(api.DefaultGWErrorHandler)))
+	h := func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		var r schema.DeleteDatabaseRequest
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&r))
+		deleted = r.Database
+		w.Write([]byte("{}"))
+	}
+	handleRoute(mux, "DeleteDatabase", http.MethodPost, api.Pattern_ImmuService_DeleteDatabase_0, h)
+	handleRoute(mux, "CreateUser", http.MethodPost, api.Pattern_ImmuService_CreateUser_0, h)
+	handler := p.handler(mux)
+
+	serve := func(url string, body string) int {
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// the database of the body is the one acted on
+	require.Equal(t, http.StatusForbidden, serve("/db/defaultdb/delete", `{"database":"prod"}`))
+	require.Equal(t, http.StatusForbidden, serve("/db/prod/delete", `{"database":"defaultdb"}`))
+	require.Equal(t, http.StatusForbidden, serve("/user", `{"user":"YWxpY2U=","database":"prod"}`))
+	require.Empty(t, deleted)
+
+	// the body is still read by the handler
+	require.Equal(t, http.StatusOK, serve("/db/defaultdb/delete", `{"database":"staging"}`))
+	require.Equal(t, "staging", deleted)
+}
+
+func TestImmuGwServer_ReloadPolicy(t *testing.T) {
+	l := logger.NewSimpleLogger("test", os.Stdout)
+	gw := &ImmuGwServer{Options: DefaultOptions(), Logger: l, policies: newPolicies(l)}
+
+	file := writePolicy(t, "policy.yaml", "default: deny")
+	next := gw.Options.WithPolicyFile(file)
+	gw.WithOptionsLoader(func() (Options, error) { return next, nil })
+	require.NoError(t, gw.Reload())
+	require.Equal(t, file, gw.Options.PolicyFile)
+	require.Equal(t, PolicyDeny, gw.policies.policy.Default)
+
+	// the policy file is read again even if the options did not change
+	require.NoError(t, os.WriteFile(file, []byte("default: allow"), 0600))
+	require.NoError(t, gw.Reload())
+	require.Equal(t, PolicyAllow, gw.policies.policy.Default)
+
+	require.NoError(t, os.WriteFile(file, []byte("default: maybe"), 0600))
+	require.ErrorIs(t, gw.Reload(), ErrInvalidPolicy)
+	require.Equal(t, PolicyAllow, gw.policies.policy.Default)
+
+	next = next.WithPolicyFile("").WithPolicyDryRun(true)
+	require.NoError(t, gw.Reload())
+	require.Nil(t, gw.policies.policy)
+	require.True(t, gw.Options.PolicyDryRun)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/status"
+)
+
+// ProblemContentType is the content type of the REST error responses
+const ProblemContentType = "application/problem+json"
+
+// Problem is the RFC 7807 body of the REST error responses
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Instance is the path of the request
+	Instance string `json:"instance,omitempty"`
+	// Code is the stable machine readable code of the error
+	Code      ErrorCode `json:"code"`
+	RequestID string    `json:"requestId,omitempty"`
+	// Database is the database of the route path, if any
+	Database string `json:"database,omitempty"`
+}
+
+// newProblem returns the problem err is reported with to the client of req
+func newProblem(req *http.Request, err error) Problem {
+	st := status.Convert(err)
+	p := Problem{
+		Type:     "about:blank",
+		Status:   runtime.HTTPStatusFromCode(st.Code()),
+		Detail:   st.Message(),
+		Instance: req.URL.Path,
+		Code:     grpcErrorCodes[st.Code()],
+	}
+	if m := lookupError(err); m != nil {
+		mapped := status.Convert(m.err)
+		p.Code = m.code
+		p.Status = runtime.HTTPStatusFromCode(mapped.Code())
+		if m.httpStatus != 0 {
+			p.Status = m.httpStatus
+		}
+		if p.Detail == "" {
+			p.Detail = mapped.Message()
+		}
+	}
+	p.Title = http.StatusText(p.Status)
+	p.RequestID, _ = RequestIDFromContext(req.Context())
+	if route := requestRouteFromContext(req.Context()); route != nil {
+		p.Database = route.Database
+	}
+	return p
+}
+
+// problemErrorHandler writes the errors of the REST routes as RFC 7807
+// problems
+func problemErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	p := newProblem(r, err)
+	bs, _ := json.Marshal(p)
+	w.Header().Del("Trailer")
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	w.Write(bs)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/codenotary/immudb/embedded/store"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	immuerrors "github.com/codenotary/immudb/pkg/client/errors"
+	"github.com/codenotary/immudb/pkg/server"
+	"github.com/codenotary/immudb/pkg/signer"
+	"github.com/codenotary/immugw/pkg/api"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMapSdkError(t *testing.T) {
+	st, err := status.New(codes.Unknown, "unknown database db9").
+		WithDetails(&schema.ErrorInfo{Code: string(immuerrors.CodInvalidDatabaseName)})
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		err    error
+		mapped error
+	}{
+		{ErrKeyNotFound, StatusErrKeyNotFound},
+		{status.Error(codes.Unknown, "tbtree: key not found"), StatusErrKeyNotFound},
+		{fmt.Errorf("get: %w", store.ErrKeyNotFound), StatusErrKeyNotFound},
+		{store.ErrCorruptedData, ErrCorruptedData},
+		{status.Error(codes.Unknown, "data is corrupted"), ErrCorruptedData},
+		{&verificationError{key: []byte("key1"), tx: 3, err: store.ErrCorruptedData}, ErrCorruptedData},
+		{status.Error(codes.InvalidArgument, "unable to verify signature: key cannot be verified"), ErrInvalidStateSignature},
+		{errors.New("no signature provided"), ErrInvalidStateSignature},
+		{fmt.Errorf("%w: asn1: syntax error", signer.ErrKeyCannotBeVerified), ErrInvalidStateSignature},
+		{status.Error(codes.Unknown, "illegal arguments: empty key"), server.ErrIllegalArguments},
+		{status.Error(codes.Unknown, "database does not exist"), StatusDatabaseNotFound},
+		{immuerrors.FromError(st.Err()), StatusDatabaseNotFound},
+		{status.Error(codes.Unknown, "already closed"), ErrDatabaseNotLoaded},
+		{ErrPolicyDenied, ErrPolicyDenied},
+	} {
+		require.Equal(t, c.mapped, mapSdkError(c.err), c.err)
+	}
+
+	// the errors without a mapping are returned as they are
+	err = errors.New("connection refused")
+	require.Equal(t, err, mapSdkError(err))
+	err = status.Error(codes.Unknown, "data is corrupted: tx 3")
+	require.Equal(t, err, mapSdkError(err))
+	err = status.Error(codes.Unknown, "unable to verify signature: of the payload")
+	require.Equal(t, err, mapSdkError(err))
+}
+
+func TestProblemErrorHandler(t *testing.T) {
+	var routeErr error
+	mux := runtime.NewServeMux(runtime.WithProtoErrorHandler(routeErrorHandler(problemErrorHandler)))
+	handleRoute(mux, "VerifiedGet", http.MethodPost, api.Pattern_ImmuService_VerifiedGet_0(), func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		_, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
+		runtime.HTTPError(req.Context(), mux, outboundMarshaler, w, req, mapSdkError(routeErr))
+	})
+	handler := requestIDHandler(newRequestMetrics(prometheus.NewRegistry()).handler(mux))
+
+	serve := func(url string, err error) Problem {
+		routeErr = err
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, url, strings.NewReader("{}")))
+		require.Equal(t, ProblemContentType, rr.Header().Get("Content-Type"))
+		var p Problem
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+		require.Equal(t, rr.Code, p.Status)
+		require.Equal(t, http.StatusText(rr.Code), p.Title)
+		require.Equal(t, rr.Header().Get(RequestIDHeader), p.RequestID)
+		return p
+	}
+
+	p := serve("/db/db1/verified/get", store.ErrCorruptedData)
+	require.Equal(t, Problem{
+		Type:      "about:blank",
+		Title:     "Conflict",
+		Status:    http.StatusConflict,
+		Detail:    "data is corrupted",
+		Instance:  "/db/db1/verified/get",
+		Code:      CodeDataCorrupted,
+		RequestID: p.RequestID,
+		Database:  "db1",
+	}, p)
+
+	p = serve("/db/db2/verified/get", status.Error(codes.Unknown, "tbtree: key not found"))
+	require.Equal(t, http.StatusNotFound, p.Status)
+	require.Equal(t, CodeKeyNotFound, p.Code)
+	require.Equal(t, "key not found", p.Detail)
+	require.Equal(t, "db2", p.Database)
+
+	p = serve("/db/db1/verified/get", status.Error(codes.Unknown, "already closed"))
+	require.Equal(t, http.StatusBadRequest, p.Status)
+	require.Equal(t, CodeDatabaseNotLoaded, p.Code)
+
+	p = serve("/db/db1/verified/get", status.Error(codes.InvalidArgument, "missing parameter key"))
+	require.Equal(t, http.StatusBadRequest, p.Status)
+	require.Equal(t, ErrorCode("INVALID_ARGUMENT"), p.Code)
+	require.Equal(t, "missing parameter key", p.Detail)
+
+	p = serve("/db/db1/verified/get", errors.New("connection refused"))
+	require.Equal(t, http.StatusInternalServerError, p.Status)
+	require.Equal(t, ErrorCode("UNKNOWN"), p.Code)
+
+	// the errors of the gateway have their own code too
+	p = serve("/db/db1/verified/get", ErrRateLimited)
+	require.Equal(t, http.StatusTooManyRequests, p.Status)
+	require.Equal(t, CodeRateLimited, p.Code)
+
+	// requests matching no route have no database
+	p = serve("/unknown", nil)
+	require.Equal(t, http.StatusNotImplemented, p.Status)
+	require.Equal(t, ErrorCode("UNIMPLEMENTED"), p.Code)
+	require.Empty(t, p.Database)
+}
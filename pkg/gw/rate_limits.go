@@ -0,0 +1,421 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+)
+
+// the route classes the limits apply to
+const (
+	RouteClassRead  = "read"
+	RouteClassWrite = "write"
+	RouteClassAdmin = "admin"
+)
+
+const (
+	// limiterIdleTimeout is how long the state of a caller not sending
+	// requests is kept
+	limiterIdleTimeout = 10 * time.Minute
+	// limiterSweepInterval is the minimum interval between two evictions of
+	// the idle callers
+	limiterSweepInterval = time.Minute
+)
+
+// writeRoutes and adminRoutes are the routes of the write and admin classes,
+// the other routes are reads
+var (
+	writeRoutes = map[string]bool{
+		"Set":                  true,
+		"VerifiedSet":          true,
+		"SetReference":         true,
+		"VerifiedSetReference": true,
+		"ZAdd":                 true,
+		"VerifiedZAdd":         true,
+		"ExecAll":              true,
+		"Delete":               true,
+		"SQLExec":              true,
+		"StreamSet":            true,
+		"StreamVerifiedSet":    true,
+	}
+	adminRoutes = map[string]bool{
+		"CreateUser":         true,
+		"ChangePassword":     true,
+		"ChangePermission":   true,
+		"SetActiveUser":      true,
+		"ListUsers":          true,
+		"CreateDatabase":     true,
+		"CreateDatabaseWith": true,
+		"CreateDatabaseV2":   true,
+		"LoadDatabase":       true,
+		"UnloadDatabase":     true,
+		"DeleteDatabase":     true,
+		"UpdateDatabase":     true,
+		"UpdateDatabaseV2":   true,
+		"FlushIndex":         true,
+		"CompactIndex":       true,
+	}
+)
+
+// routeClass returns the class of the route name
+func routeClass(name string) string {
+	switch {
+	case adminRoutes[name]:
+		return RouteClassAdmin
+	case writeRoutes[name]:
+		return RouteClassWrite
+	default:
+		return RouteClassRead
+	}
+}
+
+// RateLimits is the rate limits file, YAML, TOML or JSON depending on its
+// extension
+type RateLimits struct {
+	// Limits are evaluated in order, the first matching one applies. The
+	// requests matching no limit are not limited.
+	Limits []RateLimit `mapstructure:"limits"`
+}
+
+// RateLimit limits the requests matching all of its non empty criteria.
+// Every caller, identified by its API key, JWT subject, client certificate
+// subject or source IP, gets its own token bucket and in flight quota for
+// every database and route class.
+type RateLimit struct {
+	Name string `mapstructure:"name"`
+	// Classes are the route classes: read, write and admin
+	Classes []string `mapstructure:"classes"`
+	// Databases are the databases of the route path, shell patterns
+	Databases []string `mapstructure:"databases"`
+	// Identities match the immudb user of the API key or JWT, the API key
+	// name, the JWT subject, the client certificate subject or the source IP
+	// of the caller, shell patterns. The user of an immudb token, not
+	// verified by the gateway, is not matched.
+	Identities []string `mapstructure:"identities"`
+	// Rate is the number of requests per second, unlimited if 0, and Burst
+	// the number of requests allowed at once, the rate rounded up if 0
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+	// MaxInFlight is the number of requests served at the same time,
+	// unlimited if 0
+	MaxInFlight int `mapstructure:"maxInFlight"`
+}
+
+// loadRateLimits reads and validates the rate limits file
+func loadRateLimits(file string) (*RateLimits, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRateLimits, err)
+	}
+	var l RateLimits
+	if err := v.Unmarshal(&l); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRateLimits, err)
+	}
+	if err := l.validate(); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (l *RateLimits) validate() error {
+	for i := range l.Limits {
+		r := &l.Limits[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("limit %d", i)
+		}
+		for j, c := range r.Classes {
+			r.Classes[j] = strings.ToLower(c)
+			if r.Classes[j] != RouteClassRead && r.Classes[j] != RouteClassWrite && r.Classes[j] != RouteClassAdmin {
+				return fmt.Errorf("%w: %s: invalid class %s, allowed values are read, write and admin", ErrInvalidRateLimits, r.Name, c)
+			}
+		}
+		if r.Rate < 0 || r.Burst < 0 || r.MaxInFlight < 0 {
+			return fmt.Errorf("%w: %s: rate, burst and maxInFlight must not be negative", ErrInvalidRateLimits, r.Name)
+		}
+		if r.Rate > 0 && r.Burst == 0 {
+			r.Burst = int(math.Ceil(r.Rate))
+		}
+		for _, patterns := range [][]string{r.Databases, r.Identities} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("%w: %s: invalid pattern %s", ErrInvalidRateLimits, r.Name, pattern)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// limitMetrics are the metrics of the rate limits
+type limitMetrics struct {
+	LimitedTotal *prometheus.CounterVec
+	InFlight     *prometheus.GaugeVec
+	Callers      prometheus.Gauge
+
+	databases databaseLabels
+}
+
+func newLimitMetrics(reg *prometheus.Registry) *limitMetrics {
+	return &limitMetrics{
+		LimitedTotal: promauto.With(reg).NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "rate_limited_requests_total",
+				Help:      "Number of REST API requests rejected by the rate limits by limit, route class, database and reason (rate or in_flight).",
+			},
+			[]string{"limit", "class", "database", "reason"},
+		),
+		InFlight: promauto.With(reg).NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "rate_limit_in_flight_requests",
+				Help:      "Number of REST API requests in flight by limit and route class.",
+			},
+			[]string{"limit", "class"},
+		),
+		Callers: promauto.With(reg).NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "rate_limit_callers",
+				Help:      "Number of callers whose rate limit state is tracked.",
+			},
+		),
+	}
+}
+
+type limiterKey struct {
+	limit    int
+	caller   string
+	database string
+	class    string
+}
+
+// callerLimiter is the state of a caller for a limit
+type callerLimiter struct {
+	bucket   *rate.Limiter
+	inFlight int
+	lastUsed time.Time
+}
+
+// rateLimiter applies the current rate limits, replaced on configuration
+// reloads
+type rateLimiter struct {
+	metrics *limitMetrics
+
+	mu        sync.Mutex
+	limits    *RateLimits
+	callers   map[limiterKey]*callerLimiter
+	lastSweep time.Time
+}
+
+func newRateLimiter(metrics *limitMetrics) *rateLimiter {
+	return &rateLimiter{metrics: metrics, callers: make(map[limiterKey]*callerLimiter)}
+}
+
+// load replaces the rate limits with the ones of file, removing them if file
+// is empty. The current limits are kept when file is not valid. The state of
+// the callers is kept when the limits are unchanged; otherwise only the
+// callers with requests in flight are kept, with new buckets, so that their
+// requests keep counting against the new limit at the same index.
+func (l *rateLimiter) load(file string) error {
+	limits, err := readRateLimits(file)
+	if err != nil {
+		return err
+	}
+	l.set(limits)
+	return nil
+}
+
+// readRateLimits returns the rate limits of file, nil if file is empty
+func readRateLimits(file string) (*RateLimits, error) {
+	if file == "" {
+		return nil, nil
+	}
+	return loadRateLimits(file)
+}
+
+// set replaces the rate limits with limits, keeping the state of the callers
+// as load does
+func (l *rateLimiter) set(limits *RateLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if reflect.DeepEqual(limits, l.limits) {
+		return
+	}
+	l.limits = limits
+	for key, c := range l.callers {
+		if c.inFlight == 0 || limits == nil || key.limit >= len(limits.Limits) {
+			delete(l.callers, key)
+			continue
+		}
+		c.bucket = newBucket(&limits.Limits[key.limit])
+	}
+	l.metrics.Callers.Set(float64(len(l.callers)))
+}
+
+// newBucket returns the token bucket of a caller for limit, nil if its rate
+// is unlimited
+func newBucket(limit *RateLimit) *rate.Limiter {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+}
+
+type rateLimiterKey struct{}
+
+// handler makes l available to the requests served by h
+func (l *rateLimiter) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), rateLimiterKey{}, l)))
+	})
+}
+
+// rateLimiterFromContext returns the rate limiter of the request, a nil rate
+// limiter limits no request
+func rateLimiterFromContext(ctx context.Context) *rateLimiter {
+	l, _ := ctx.Value(rateLimiterKey{}).(*rateLimiter)
+	return l
+}
+
+// acquire checks req, run under id if not nil, against the rate limit of
+// the route name on database. The returned function must be called once
+// req is served. Over limit requests get ErrRateLimited with the
+// Retry-After header set on w.
+func (l *rateLimiter) acquire(w http.ResponseWriter, req *http.Request, name string, database string, id *identity) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	class := routeClass(name)
+	identities := verifiedCallerIdentities(req, id)
+	ip := sourceIP(req)
+	if ip != "" {
+		identities = append(identities, ip)
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limits == nil {
+		return func() {}, nil
+	}
+	index, limit := l.limits.match(class, database, identities)
+	if limit == nil {
+		return func() {}, nil
+	}
+	l.sweep(now)
+
+	key := limiterKey{limit: index, caller: callerKey(req, id, ip), database: database, class: class}
+	c, ok := l.callers[key]
+	if !ok {
+		c = &callerLimiter{bucket: newBucket(limit)}
+		l.callers[key] = c
+		l.metrics.Callers.Set(float64(len(l.callers)))
+	}
+	c.lastUsed = now
+
+	if limit.MaxInFlight > 0 && c.inFlight >= limit.MaxInFlight {
+		l.metrics.LimitedTotal.WithLabelValues(limit.Name, class, l.metrics.databases.label(database), "in_flight").Inc()
+		w.Header().Set("Retry-After", "1")
+		return nil, ErrTooManyInFlight
+	}
+	if c.bucket != nil {
+		r := c.bucket.ReserveN(now, 1)
+		if delay := r.DelayFrom(now); delay > 0 {
+			r.CancelAt(now)
+			l.metrics.LimitedTotal.WithLabelValues(limit.Name, class, l.metrics.databases.label(database), "rate").Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			return nil, ErrRateLimited
+		}
+	}
+
+	c.inFlight++
+	inFlight := l.metrics.InFlight.WithLabelValues(limit.Name, class)
+	inFlight.Inc()
+	return func() {
+		l.mu.Lock()
+		c.inFlight--
+		c.lastUsed = time.Now()
+		l.mu.Unlock()
+		inFlight.Dec()
+	}, nil
+}
+
+// sweep drops the idle callers, at most once per sweep interval
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < limiterSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, c := range l.callers {
+		if c.inFlight == 0 && now.Sub(c.lastUsed) > limiterIdleTimeout {
+			delete(l.callers, key)
+		}
+	}
+	l.metrics.Callers.Set(float64(len(l.callers)))
+}
+
+// match returns the first limit matching the request and its index
+func (l *RateLimits) match(class string, database string, identities []string) (int, *RateLimit) {
+	for i := range l.Limits {
+		r := &l.Limits[i]
+		if matchAny(r.Classes, class) && matchAny(r.Databases, database) && matchAny(r.Identities, identities...) {
+			return i, r
+		}
+	}
+	return 0, nil
+}
+
+// callerKey identifies the caller of req, run under id if not nil, by its API
+// key, JWT subject, client certificate subject or source IP
+func callerKey(req *http.Request, id *identity, ip string) string {
+	if id != nil && id.apiKey != "" {
+		return "apikey:" + id.apiKey
+	}
+	if id != nil && id.subject != "" {
+		return "jwt:" + id.subject
+	}
+	if subject, ok := ClientCertSubjectFromContext(req.Context()); ok {
+		return "cert:" + subject
+	}
+	return "ip:" + ip
+}
+
+// sourceIP returns the IP address req comes from
+func sourceIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/codenotary/immudb/pkg/auth"
+	"github.com/codenotary/immugw/pkg/api"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func writeRateLimits(t *testing.T, name string, limits string) string {
+	file := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(file, []byte(limits), 0600))
+	return file
+}
+
+func TestLoadRateLimits(t *testing.T) {
+	l, err := loadRateLimits(writeRateLimits(t, "rate_limits.yaml", `
+limits:
+  - name: admin
+    classes: [Admin]
+    rate: 0.5
+    maxInFlight: 1
+  - identities: [10.0.0.*]
+    rate: 10
+    burst: 20
+`))
+	require.NoError(t, err)
+	require.Len(t, l.Limits, 2)
+	require.Equal(t, []string{RouteClassAdmin}, l.Limits[0].Classes)
+	require.Equal(t, 1, l.Limits[0].Burst)
+	require.Equal(t, "limit 1", l.Limits[1].Name)
+	require.Equal(t, 20, l.Limits[1].Burst)
+
+	l, err = loadRateLimits(writeRateLimits(t, "rate_limits.toml", `
+[[limits]]
+databases = ["db1"]
+maxInFlight = 5
+`))
+	require.NoError(t, err)
+	require.Equal(t, 5, l.Limits[0].MaxInFlight)
+	require.Zero(t, l.Limits[0].Burst)
+
+	_, err = loadRateLimits(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.ErrorIs(t, err, ErrInvalidRateLimits)
+	for _, limits := range []string{
+		"limits: [",
+		"limits:\n  - classes: [delete]",
+		"limits:\n  - rate: -1",
+		"limits:\n  - maxInFlight: -1",
+		"limits:\n  - databases: ['[']",
+	} {
+		_, err := loadRateLimits(writeRateLimits(t, "rate_limits.yaml", limits))
+		require.ErrorIs(t, err, ErrInvalidRateLimits, limits)
+	}
+}
+
+func TestRouteClass(t *testing.T) {
+	require.Equal(t, RouteClassRead, routeClass("VerifiedGet"))
+	require.Equal(t, RouteClassRead, routeClass("SQLQuery"))
+	require.Equal(t, RouteClassWrite, routeClass("VerifiedSet"))
+	require.Equal(t, RouteClassWrite, routeClass("SQLExec"))
+	require.Equal(t, RouteClassAdmin, routeClass("DeleteDatabase"))
+	require.Equal(t, RouteClassAdmin, routeClass("CreateUser"))
+}
+
+func TestRateLimiter(t *testing.T) {
+	metrics := newLimitMetrics(prometheus.NewRegistry())
+	l := newRateLimiter(metrics)
+	config := `
+limits:
+  - name: writes
+    classes: [write]
+    maxInFlight: 1
+  - name: trusted
+    identities: [10.0.0.1]
+  - name: forged
+    identities: [alice]
+  - name: reads
+    databases: [db1]
+    rate: 0.001
+    burst: 2
+`
+	require.NoError(t, l.load(writeRateLimits(t, "rate_limits.yaml", config)))
+
+	keys, err := newAPIKeys([]APIKey{{Name: "ci", Hash: apiKeyHash("key1"), Username: "ci", Password: "secret"}}, &loginServiceClientMock{})
+	require.NoError(t, err)
+
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	mux := runtime.NewServeMux(runtime.WithProtoErrorHandler(routeErrorHandler(api.DefaultGWErrorHandler)))
+	handleRoute(mux, "VerifiedGet", http.MethodPost, api.Pattern_ImmuService_VerifiedGet_0(), func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		w.Write([]byte("{}"))
+	})
+	handleRoute(mux, "VerifiedSet", http.MethodPost, api.Pattern_ImmuService_VerifiedSet_0(), func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		entered <- struct{}{}
+		<-unblock
+		w.Write([]byte("{}"))
+	})
+	requests := newRequestMetrics(prometheus.NewRegistry())
+	handler := requests.handler(l.handler(keys.handler(mux)))
+
+	serve := func(url string, remoteAddr string, authorization string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader("{}"))
+		require.NoError(t, err)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Authorization", authorization)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// every caller gets its own bucket for every database
+	for i := 0; i < 2; i++ {
+		require.Equal(t, http.StatusOK, serve("/db/db1/verified/get", "10.0.0.2:1000", "").Code)
+	}
+	rr := serve("/db/db1/verified/get", "10.0.0.2:1001", "")
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	require.NotEmpty(t, rr.Header().Get("Retry-After"))
+	require.Equal(t, http.StatusOK, serve("/db/db1/verified/get", "10.0.0.3:1000", "").Code)
+	require.Equal(t, http.StatusOK, serve("/db/db1/verified/get", "10.0.0.2:1000", "ApiKey key1").Code)
+	require.Equal(t, http.StatusOK, serve("/db/db2/verified/get", "10.0.0.2:1000", "").Code)
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.LimitedTotal.WithLabelValues("reads", RouteClassRead, "db1", "rate")))
+	require.Equal(t, 3.0, testutil.ToFloat64(metrics.Callers))
+
+	// the unverified user of an immudb token matches no limit
+	token, err := auth.GenerateToken(auth.User{Username: "alice"}, 0, 60)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		require.Equal(t, http.StatusOK, serve("/db/db1/verified/get", "10.0.0.4:1000", "Bearer "+token).Code)
+	}
+	require.Equal(t, http.StatusTooManyRequests, serve("/db/db1/verified/get", "10.0.0.4:1000", "Bearer "+token).Code)
+
+	// the requests matching a limit without rate are not limited
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusOK, serve("/db/db1/verified/get", "10.0.0.1:1000", "").Code)
+	}
+
+	// the requests in flight are limited per caller
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serve("/db/db1/verified/set", "10.0.0.2:1000", "")
+	}()
+	<-entered
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.InFlight.WithLabelValues("writes", RouteClassWrite)))
+	rr = serve("/db/db1/verified/set", "10.0.0.2:1001", "")
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	require.Equal(t, "1", rr.Header().Get("Retry-After"))
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serve("/db/db1/verified/set", "10.0.0.3:1000", "")
+	}()
+	<-entered
+	unblock <- struct{}{}
+	unblock <- struct{}{}
+	wg.Wait()
+
+	// the quota is released once the requests are served
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		require.Equal(t, http.StatusOK, serve("/db/db1/verified/set", "10.0.0.2:1000", "").Code)
+	}()
+	<-entered
+	unblock <- struct{}{}
+	wg.Wait()
+	require.Zero(t, testutil.ToFloat64(metrics.InFlight.WithLabelValues("writes", RouteClassWrite)))
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.LimitedTotal.WithLabelValues("writes", RouteClassWrite, "db1", "in_flight")))
+
+	// reloading unchanged limits keeps the state of the callers
+	require.NoError(t, l.load(writeRateLimits(t, "rate_limits.yaml", config)))
+	require.Equal(t, http.StatusTooManyRequests, serve("/db/db1/verified/get", "10.0.0.2:1000", "").Code)
+
+	// reloading other limits keeps the requests in flight
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serve("/db/db1/verified/set", "10.0.0.2:1000", "")
+	}()
+	<-entered
+	require.NoError(t, l.load(writeRateLimits(t, "rate_limits.yaml", strings.Replace(config, "rate: 0.001", "rate: 0.002", 1))))
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.Callers))
+	require.Equal(t, http.StatusTooManyRequests, serve("/db/db1/verified/set", "10.0.0.2:1001", "").Code)
+	require.Equal(t, http.StatusOK, serve("/db/db1/verified/get", "10.0.0.2:1000", "").Code)
+	unblock <- struct{}{}
+	wg.Wait()
+
+	// removing the limits drops the state of the callers, no limits limit no
+	// request
+	require.NoError(t, l.load(""))
+	require.Zero(t, testutil.ToFloat64(metrics.Callers))
+	require.Equal(t, http.StatusOK, serve("/db/db1/verified/get", "10.0.0.2:1000", "").Code)
+	require.ErrorIs(t, l.load(writeRateLimits(t, "rate_limits.yaml", "limits: [")), ErrInvalidRateLimits)
+}
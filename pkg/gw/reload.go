@@ -0,0 +1,235 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"github.com/codenotary/immudb/embedded/logger"
+	"github.com/codenotary/immudb/pkg/auth"
+)
+
+// OptionsLoader reads the current gateway configuration
+type OptionsLoader func() (Options, error)
+
+// liveOptions are the options applied on a configuration reload, the others
+// require a restart
+var liveOptions = map[string]bool{
+	"AuditInterval":        true,
+	"AuditUsername":        true,
+	"AuditPassword":        true,
+	"AuditDatabases":       true,
+	"LogLevel":             true,
+	"Logfile":              true,
+	"PolicyFile":           true,
+	"PolicyDryRun":         true,
+	"RateLimitsFile":       true,
+	"CORSAllowedOrigins":   true,
+	"CORSAllowedMethods":   true,
+	"CORSAllowedHeaders":   true,
+	"CORSExposedHeaders":   true,
+	"CORSAllowCredentials": true,
+	"CORSMaxAge":           true,
+	"CORSRoutes":           true,
+}
+
+// ignoredOptions are not read from the configuration
+var ignoredOptions = map[string]bool{
+	"Config":       true,
+	"Detached":     true,
+	"TokenService": true,
+}
+
+// WithOptionsLoader sets the loader used to read the configuration on reloads
+func (s *ImmuGwServer) WithOptionsLoader(loader OptionsLoader) ImmuGw {
+	s.optionsLoader = loader
+	return s
+}
+
+// Reload reads the configuration with the options loader and applies the
+// settings that can be changed at runtime. The changed settings that require
+// a restart are not applied and are reported with ErrSettingsNotReloadable.
+func (s *ImmuGwServer) Reload() error {
+	if s.optionsLoader == nil {
+		return ErrReloadNotSupported
+	}
+	opts, err := s.optionsLoader()
+	if err != nil {
+		return fmt.Errorf("unable to read configuration: %w", err)
+	}
+	return s.reload(opts)
+}
+
+func (s *ImmuGwServer) reload(opts Options) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	live, restart := changedOptions(s.Options, opts)
+
+	// every setting is validated before any is applied, so that an invalid
+	// configuration leaves the current one in place
+
+	// the auditor would panic on a non positive interval
+	if s.Options.Audit && opts.AuditInterval <= 0 {
+		return fmt.Errorf("unable to apply audit configuration: %w", ErrInvalidAuditInterval)
+	}
+	var auditPassword string
+	if s.auditor != nil {
+		var err error
+		if auditPassword, err = auth.DecodeBase64Password(opts.AuditPassword); err != nil {
+			return fmt.Errorf("unable to apply audit configuration: %w", err)
+		}
+	}
+
+	// the policy file and the rate limits are read again on every reload,
+	// their content may have changed
+	policy, err := readPolicy(opts.PolicyFile)
+	if err != nil {
+		return fmt.Errorf("unable to apply route policy: %w", err)
+	}
+	limits, err := readRateLimits(opts.RateLimitsFile)
+	if err != nil {
+		return fmt.Errorf("unable to apply rate limits: %w", err)
+	}
+
+	var cors *corsPolicy
+	if s.cors != nil && hasPrefix(live, "CORS") {
+		if cors, err = newCORSPolicy(opts); err != nil {
+			return fmt.Errorf("unable to apply CORS configuration: %w", err)
+		}
+	}
+
+	// the logger is created last, as it is the only one to be closed when
+	// it is not applied
+	l, err := s.newReloadedLogger(opts)
+	if err != nil {
+		return fmt.Errorf("unable to apply logging configuration: %w", err)
+	}
+
+	if s.policies != nil {
+		s.policies.set(policy, opts.PolicyDryRun)
+		if opts.PolicyFile != "" {
+			s.Logger.Infof("route policy %s reloaded", opts.PolicyFile)
+		}
+	}
+	// the state of the rate limited callers is kept if the limits are
+	// unchanged
+	if s.rateLimiter != nil {
+		s.rateLimiter.set(limits)
+		if opts.RateLimitsFile != "" {
+			s.Logger.Infof("rate limits %s reloaded", opts.RateLimitsFile)
+		}
+	}
+	if cors != nil {
+		s.cors.set(cors)
+	}
+	if l != nil {
+		if err := s.logger.swap(l); err != nil {
+			s.Logger.Warningf("unable to close the previous logger: %s", err)
+		}
+	}
+	if s.auditor != nil {
+		s.auditor.setCredentials(opts.AuditUsername, auditPassword, opts.AuditDatabases)
+		if opts.AuditInterval != s.Options.AuditInterval {
+			s.auditor.setInterval(opts.AuditInterval)
+		}
+	}
+
+	s.Options.PolicyFile = opts.PolicyFile
+	s.Options.PolicyDryRun = opts.PolicyDryRun
+	s.Options.RateLimitsFile = opts.RateLimitsFile
+	s.Options.CORSAllowedOrigins = opts.CORSAllowedOrigins
+	s.Options.CORSAllowedMethods = opts.CORSAllowedMethods
+	s.Options.CORSAllowedHeaders = opts.CORSAllowedHeaders
+	s.Options.CORSExposedHeaders = opts.CORSExposedHeaders
+	s.Options.CORSAllowCredentials = opts.CORSAllowCredentials
+	s.Options.CORSMaxAge = opts.CORSMaxAge
+	s.Options.CORSRoutes = opts.CORSRoutes
+	s.Options.LogLevel = opts.LogLevel
+	s.Options.Logfile = opts.Logfile
+	s.Options.AuditInterval = opts.AuditInterval
+	s.Options.AuditUsername = opts.AuditUsername
+	s.Options.AuditPassword = opts.AuditPassword
+	s.Options.AuditDatabases = opts.AuditDatabases
+
+	if len(live) == 0 && len(restart) == 0 {
+		s.Logger.Infof("configuration reloaded: no changes")
+		return nil
+	}
+	if len(live) > 0 {
+		s.Logger.Infof("configuration reloaded: applied %s", strings.Join(live, ", "))
+	}
+	if len(restart) > 0 {
+		return fmt.Errorf("%w: %s", ErrSettingsNotReloadable, strings.Join(restart, ", "))
+	}
+	return nil
+}
+
+// newReloadedLogger returns the logger configured by opts when the log level
+// or file changed, nil otherwise
+func (s *ImmuGwServer) newReloadedLogger(opts Options) (logger.Logger, error) {
+	if s.logger == nil || (opts.LogLevel == s.Options.LogLevel && opts.Logfile == s.Options.Logfile) {
+		return nil, nil
+	}
+	return NewLogger(opts)
+}
+
+// changedOptions returns the names of the options changed from prev to
+// next, split between the ones applied live and the ones requiring a restart
+func changedOptions(prev, next Options) (live []string, restart []string) {
+	pv, nv := reflect.ValueOf(prev), reflect.ValueOf(next)
+	for i := 0; i < pv.NumField(); i++ {
+		name := pv.Type().Field(i).Name
+		if ignoredOptions[name] || reflect.DeepEqual(pv.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		if liveOptions[name] {
+			live = append(live, name)
+		} else {
+			restart = append(restart, name)
+		}
+	}
+	return live, restart
+}
+
+// hasPrefix reports whether one of the names starts with prefix
+func hasPrefix(names []string, prefix string) bool {
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ImmuGwServer) installReloadHandler() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			s.Logger.Infof("caught SIGHUP, reloading configuration ...")
+			if err := s.Reload(); err != nil {
+				s.Logger.Errorf("configuration reload: %s", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb/embedded/logger"
+	"github.com/codenotary/immudb/pkg/client/tokenservice"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedOptions(t *testing.T) {
+	prev := DefaultOptions()
+
+	live, restart := changedOptions(prev, prev.WithTokenService(tokenservice.NewInmemoryTokenService()).WithDetached(true))
+	require.Empty(t, live)
+	require.Empty(t, restart)
+
+	next := prev.
+		WithAuditInterval(time.Minute).
+		WithAuditDatabases([]string{"db1"}).
+		WithLogLevel("debug").
+		WithImmudbAddress("10.0.0.1").
+		WithPort(4000)
+	live, restart = changedOptions(prev, next)
+	require.Equal(t, []string{"AuditInterval", "AuditDatabases", "LogLevel"}, live)
+	require.Equal(t, []string{"Port", "ImmudbAddress"}, restart)
+}
+
+func TestImmuGwServer_Reload(t *testing.T) {
+	dir := t.TempDir()
+
+	gw := &ImmuGwServer{
+		Options: DefaultOptions().WithAudit(true),
+		Logger:  logger.NewSimpleLogger("test", os.Stdout),
+	}
+	require.ErrorIs(t, gw.Reload(), ErrReloadNotSupported)
+
+	gw.logger = newReloadableLogger(gw.Logger)
+	gw.Logger = gw.logger
+
+	a, err := newAuditor("bufconn", "immugwauditor", "password", nil, nil, nil, dir, nil, nil, gw.Logger)
+	require.NoError(t, err)
+	gw.auditor = a
+
+	loadErr := errors.New("some load error")
+	gw.WithOptionsLoader(func() (Options, error) { return Options{}, loadErr })
+	require.ErrorIs(t, gw.Reload(), loadErr)
+
+	logfile := filepath.Join(dir, "logs", "immugw.log")
+	next := gw.Options.
+		WithAuditInterval(time.Minute).
+		WithAuditUsername("auditor2").
+		WithAuditPassword("password2").
+		WithAuditDatabases([]string{"db1"}).
+		WithLogfile(logfile).
+		WithLogLevel("debug").
+		WithImmudbPort(4000)
+	gw.WithOptionsLoader(func() (Options, error) { return next, nil })
+
+	// the live settings are applied, the other ones are reported
+	err = gw.Reload()
+	require.ErrorIs(t, err, ErrSettingsNotReloadable)
+	require.Contains(t, err.Error(), "ImmudbPort")
+
+	require.Equal(t, time.Minute, gw.Options.AuditInterval)
+	require.Equal(t, logfile, gw.Options.Logfile)
+	require.Equal(t, 3322, gw.Options.ImmudbPort)
+	require.Equal(t, time.Minute, <-a.intervalc)
+	require.Equal(t, []byte("auditor2"), a.username)
+	require.Equal(t, []byte("password2"), a.password)
+	require.Equal(t, []string{"db1"}, a.databases)
+
+	gw.Logger.Debugf("reloaded")
+	require.NoError(t, gw.logger.Close())
+	bs, err := os.ReadFile(logfile)
+	require.NoError(t, err)
+	require.Contains(t, string(bs), "reloaded")
+
+	// invalid settings are not applied
+	gw.WithOptionsLoader(func() (Options, error) { return next.WithLogLevel("verbose"), nil })
+	require.ErrorIs(t, gw.Reload(), ErrInvalidLogLevel)
+	require.Equal(t, "debug", gw.Options.LogLevel)
+
+	// nor is anything else along with a non positive audit interval
+	gw.WithOptionsLoader(func() (Options, error) { return next.WithAuditInterval(0).WithLogLevel("info"), nil })
+	require.ErrorIs(t, gw.Reload(), ErrInvalidAuditInterval)
+	require.Equal(t, time.Minute, gw.Options.AuditInterval)
+	require.Equal(t, "debug", gw.Options.LogLevel)
+	require.Empty(t, a.intervalc)
+
+	// nor is a valid policy along with an invalid CORS configuration
+	gw.policies = newPolicies(gw.Logger)
+	gw.cors = &corsHandler{}
+	require.NoError(t, gw.cors.load(gw.Options))
+	policyFile := writePolicy(t, "policy.yaml", "default: deny\n")
+	gw.WithOptionsLoader(func() (Options, error) {
+		return next.WithPolicyFile(policyFile).WithCORSAllowCredentials(true).WithCORSAllowedOrigins([]string{"*"}), nil
+	})
+	require.ErrorIs(t, gw.Reload(), ErrInvalidCORS)
+	require.Nil(t, gw.policies.policy)
+	require.Empty(t, gw.Options.PolicyFile)
+	require.False(t, gw.Options.CORSAllowCredentials)
+	require.Equal(t, []byte("password2"), a.password)
+}
+
+func TestNewLogger(t *testing.T) {
+	_, err := NewLogger(DefaultOptions().WithLogLevel("verbose"))
+	require.ErrorIs(t, err, ErrInvalidLogLevel)
+
+	l, err := NewLogger(DefaultOptions().WithLogLevel("ERROR"))
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	logfile := filepath.Join(t.TempDir(), "immugw.log")
+	l, err = NewLogger(DefaultOptions().WithLogfile(logfile).WithLogLevel("warn"))
+	require.NoError(t, err)
+	l.Infof("filtered")
+	l.Warningf("logged")
+	require.NoError(t, l.Close())
+
+	bs, err := os.ReadFile(logfile)
+	require.NoError(t, err)
+	require.NotContains(t, string(bs), "filtered")
+	require.Contains(t, string(bs), "logged")
+}
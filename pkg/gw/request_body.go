@@ -0,0 +1,143 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+)
+
+// streamBodyLimit is the key of the maximum size of the values uploaded to the
+// stream routes, whose bodies are not buffered
+const streamBodyLimit = "stream"
+
+// bodyLimits are the maximum sizes in bytes of the request bodies per route
+// class, and of the stream uploads, a zero size is unlimited
+type bodyLimits map[string]int64
+
+// newBodyLimits returns the body size limits configured by the options
+func newBodyLimits(o Options) (bodyLimits, error) {
+	l := bodyLimits{
+		RouteClassRead:  o.MaxReadBodySize,
+		RouteClassWrite: o.MaxWriteBodySize,
+		RouteClassAdmin: o.MaxAdminBodySize,
+		streamBodyLimit: o.MaxStreamSize,
+	}
+	for class, size := range l {
+		if size < 0 {
+			return nil, fmt.Errorf("%w: %s body size %d", ErrInvalidMaxBodySize, class, size)
+		}
+	}
+	return l, nil
+}
+
+type bodyLimitsKey struct{}
+
+// handler makes l available to the requests served by h
+func (l bodyLimits) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), bodyLimitsKey{}, l)))
+	})
+}
+
+// bodyLimitsFromContext returns the body size limits of the request, nil
+// limits do not limit any route
+func bodyLimitsFromContext(ctx context.Context) bodyLimits {
+	l, _ := ctx.Value(bodyLimitsKey{}).(bodyLimits)
+	return l
+}
+
+// limit checks that the body of req does not exceed the size limit of the
+// class of the route name before it is decoded. The body is read in memory
+// up to the limit, as the handlers do anyway, so that the overflow of the
+// chunked bodies is detected too. The bodies of the stream routes are only
+// checked against their declared length, the routes require one.
+func (l bodyLimits) limit(req *http.Request, name string) error {
+	if streamRoutes[name] {
+		if max := l[streamBodyLimit]; max > 0 && req.ContentLength > max {
+			return ErrBodyTooLarge
+		}
+		return nil
+	}
+	max := l[routeClass(name)]
+	if max == 0 || req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if req.ContentLength > max {
+		return ErrBodyTooLarge
+	}
+	bs, err := io.ReadAll(io.LimitReader(req.Body, max+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(bs)) > max {
+		return ErrBodyTooLarge
+	}
+	req.Body = io.NopCloser(bytes.NewReader(bs))
+	return nil
+}
+
+// strictJSONPb is the JSONPb marshaler of the gateway rejecting the request
+// bodies with unknown fields or data after the JSON value
+type strictJSONPb struct {
+	runtime.JSONPb
+}
+
+func newStrictJSONPb() *strictJSONPb {
+	return &strictJSONPb{JSONPb: runtime.JSONPb{OrigName: true}}
+}
+
+// NewDecoder returns a strict decoder reading from r
+func (j *strictJSONPb) NewDecoder(r io.Reader) runtime.Decoder {
+	return strictDecoder{json.NewDecoder(r)}
+}
+
+// Unmarshal strictly unmarshals data into v
+func (j *strictJSONPb) Unmarshal(data []byte, v interface{}) error {
+	return j.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type strictDecoder struct {
+	*json.Decoder
+}
+
+// Decode decodes the next JSON value into v, the unknown fields of the
+// protobuf messages are rejected with the name of the field. The value must
+// be the last one of the input.
+func (d strictDecoder) Decode(v interface{}) error {
+	var err error
+	if m, ok := v.(proto.Message); ok {
+		err = (&jsonpb.Unmarshaler{}).UnmarshalNext(d.Decoder, m)
+	} else {
+		err = runtime.DecoderWrapper{Decoder: d.Decoder}.Decode(v)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return ErrTrailingData
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immugw/pkg/api"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/utilities"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// decodingHandler decodes the body of the requests into a SetRequest as the
+// route handlers do
+func decodingHandler(mux *runtime.ServeMux) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
+		var protoReq schema.SetRequest
+		newReader, err := utilities.IOReaderFactory(req.Body)
+		if err == nil {
+			err = inboundMarshaler.NewDecoder(newReader()).Decode(&protoReq)
+		}
+		if err != nil && err != io.EOF {
+			runtime.HTTPError(req.Context(), mux, outboundMarshaler, w, req, status.Errorf(codes.InvalidArgument, "%v", err))
+			return
+		}
+		outboundMarshaler.NewEncoder(w).Encode(&protoReq)
+	}
+}
+
+func TestNewBodyLimits(t *testing.T) {
+	l, err := newBodyLimits(DefaultOptions().WithMaxWriteBodySize(0))
+	require.NoError(t, err)
+	require.Equal(t, bodyLimits{RouteClassRead: 1 << 20, RouteClassWrite: 0, RouteClassAdmin: 1 << 20, streamBodyLimit: 1 << 30}, l)
+
+	_, err = newBodyLimits(DefaultOptions().WithMaxAdminBodySize(-1))
+	require.ErrorIs(t, err, ErrInvalidMaxBodySize)
+
+	_, err = newBodyLimits(DefaultOptions().WithMaxStreamSize(-1))
+	require.ErrorIs(t, err, ErrInvalidMaxBodySize)
+}
+
+func TestBodyLimits(t *testing.T) {
+	l, err := newBodyLimits(DefaultOptions().WithMaxReadBodySize(16).WithMaxWriteBodySize(64).WithMaxAdminBodySize(0))
+	require.NoError(t, err)
+
+	mux := runtime.NewServeMux(runtime.WithProtoErrorHandler(routeErrorHandler(problemErrorHandler)))
+	handleRoute(mux, "VerifiedGet", http.MethodPost, api.Pattern_ImmuService_VerifiedGet_0(), decodingHandler(mux))
+	handleRoute(mux, "Set", http.MethodPost, api.Pattern_ImmuService_Set_0, decodingHandler(mux))
+	handleRoute(mux, "CreateDatabaseV2", http.MethodPost, api.Pattern_ImmuService_CreateDatabaseV2_0, decodingHandler(mux))
+	handler := l.handler(mux)
+
+	serve := func(url string, body string, chunked bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		if chunked {
+			req.ContentLength = -1
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	body := `{"KVs":[{"key":"a2V5MQ==","value":"dmFsdWUx"}]}`
+	require.Equal(t, http.StatusOK, serve("/db/db1/set", body, false).Code)
+	require.Equal(t, http.StatusOK, serve("/db/db1/set", body, true).Code)
+	require.Equal(t, http.StatusOK, serve("/db/db2/create/v2", strings.Repeat(" ", 1024)+body, false).Code)
+	require.Equal(t, http.StatusOK, serve("/db/db1/verified/get", "{}", false).Code)
+
+	rr := serve("/db/db1/verified/get", body, false)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	require.Contains(t, rr.Body.String(), "request body too large")
+
+	require.Equal(t, http.StatusRequestEntityTooLarge, serve("/db/db1/verified/get", body, true).Code)
+	require.Equal(t, http.StatusRequestEntityTooLarge, serve("/db/db1/set", body+strings.Repeat(" ", 64), true).Code)
+
+	// requests without limits are not limited
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/db/db1/verified/get", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestStrictJSONPb(t *testing.T) {
+	mux := runtime.NewServeMux(
+		runtime.WithProtoErrorHandler(routeErrorHandler(problemErrorHandler)),
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, newStrictJSONPb()),
+	)
+	handleRoute(mux, "Set", http.MethodPost, api.Pattern_ImmuService_Set_0, decodingHandler(mux))
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/db/db1/set", strings.NewReader(body)))
+		return rr
+	}
+
+	rr := serve(`{"KVs":[{"key":"a2V5MQ==","value":"dmFsdWUx"}],"noWait":true}` + "\n")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Contains(t, rr.Body.String(), `"noWait":true`)
+	require.Equal(t, http.StatusOK, serve("").Code)
+
+	rr = serve(`{"KVs":[{"key":"a2V5MQ==","vaule":"dmFsdWUx"}]}`)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Contains(t, rr.Body.String(), `unknown field \"vaule\" in immudb.schema.KeyValue`)
+
+	rr = serve(`{"KVs":[],"noWiat":true}`)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Contains(t, rr.Body.String(), `unknown field \"noWiat\"`)
+
+	rr = serve(`{"noWait":true}{"noWait":false}`)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Contains(t, rr.Body.String(), ErrTrailingData.Error())
+
+	require.Equal(t, http.StatusBadRequest, serve(`{"noWait":true} x`).Code)
+
+	var v map[string]interface{}
+	require.NoError(t, newStrictJSONPb().Unmarshal([]byte(`{"a":1}`), &v))
+	require.Equal(t, map[string]interface{}{"a": 1.0}, v)
+	require.ErrorIs(t, newStrictJSONPb().Unmarshal([]byte(`{"a":1} 2`), &v), ErrTrailingData)
+}
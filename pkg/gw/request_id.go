@@ -0,0 +1,105 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// RequestIDHeader is the HTTP header carrying the ID of a request
+	RequestIDHeader = "X-Request-Id"
+	// RequestIDMetadata is the gRPC metadata key the request ID is forwarded
+	// to immudb with
+	RequestIDMetadata = "x-request-id"
+
+	maxRequestIDLength = 128
+)
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID of the request, if any
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// requestIDHandler assigns an ID to every request served by h, the one of
+// the X-Request-Id header if valid or a generated one, and sets it on the
+// response
+func requestIDHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+			req.Header.Set(RequestIDHeader, id)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		h.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID reports whether id is a non empty string of printable ASCII
+// characters short enough to be logged and forwarded as is
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	// crypto/rand does not fail on the supported platforms
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDDialOptions returns opts with the interceptors forwarding the
+// request ID to immudb
+func requestIDDialOptions(opts []grpc.DialOption) []grpc.DialOption {
+	return append(opts[:len(opts):len(opts)],
+		grpc.WithChainUnaryInterceptor(requestIDUnaryInterceptor),
+		grpc.WithChainStreamInterceptor(requestIDStreamInterceptor),
+	)
+}
+
+func withRequestIDMetadata(ctx context.Context) context.Context {
+	if id, ok := RequestIDFromContext(ctx); ok {
+		return metadata.AppendToOutgoingContext(ctx, RequestIDMetadata, id)
+	}
+	return ctx
+}
+
+func requestIDUnaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(withRequestIDMetadata(ctx), method, req, reply, cc, opts...)
+}
+
+func requestIDStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(withRequestIDMetadata(ctx), desc, cc, method, opts...)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestIDHandler(t *testing.T) {
+	var id string
+	handler := requestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id, _ = RequestIDFromContext(req.Context())
+	}))
+
+	serve := func(header string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		require.NoError(t, err)
+		if header != "" {
+			req.Header.Set(RequestIDHeader, header)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("")
+	require.Len(t, id, 32)
+	require.Equal(t, id, rr.Header().Get(RequestIDHeader))
+
+	prev := id
+	serve("")
+	require.NotEqual(t, prev, id)
+
+	rr = serve("req-1")
+	require.Equal(t, "req-1", id)
+	require.Equal(t, "req-1", rr.Header().Get(RequestIDHeader))
+
+	// invalid IDs are replaced
+	for _, header := range []string{"req 1", strings.Repeat("a", maxRequestIDLength+1)} {
+		rr = serve(header)
+		require.Len(t, id, 32, header)
+		require.Equal(t, id, rr.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestRequestIDInterceptors(t *testing.T) {
+	var md metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "token")
+	require.NoError(t, requestIDUnaryInterceptor(ctx, "/immudb.schema.ImmuService/VerifiableGet", nil, nil, nil, invoker))
+	require.Empty(t, md.Get(RequestIDMetadata))
+
+	ctx = context.WithValue(ctx, requestIDKey{}, "req-1")
+	require.NoError(t, requestIDUnaryInterceptor(ctx, "/immudb.schema.ImmuService/VerifiableGet", nil, nil, nil, invoker))
+	require.Equal(t, []string{"req-1"}, md.Get(RequestIDMetadata))
+	require.Equal(t, []string{"token"}, md.Get("authorization"))
+
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil, nil
+	}
+	md = nil
+	_, err := requestIDStreamInterceptor(ctx, &grpc.StreamDesc{}, nil, "/immudb.schema.ImmuService/StreamGet", streamer)
+	require.NoError(t, err)
+	require.Equal(t, []string{"req-1"}, md.Get(RequestIDMetadata))
+
+	require.Len(t, requestIDDialOptions(nil), 2)
+}
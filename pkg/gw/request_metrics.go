@@ -0,0 +1,151 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	immugwclient "github.com/codenotary/immugw/pkg/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// unmatchedRoute labels the requests not matching any REST route
+const unmatchedRoute = "unmatched"
+
+// otherDatabase labels the requests for the databases the gateway has no
+// client for, whose names come from arbitrary request paths
+const otherDatabase = "other"
+
+// databaseLabels returns the metrics label of a database
+type databaseLabels func(database string) string
+
+// newDatabaseLabels labels the databases client has been added for with
+// their name and the other ones with otherDatabase
+func newDatabaseLabels(client immugwclient.Client) databaseLabels {
+	return func(database string) string {
+		if database == "" {
+			return ""
+		}
+		if _, err := client.For(database); err != nil {
+			return otherDatabase
+		}
+		return database
+	}
+}
+
+// label returns the label of database, its name if no labels are set
+func (l databaseLabels) label(database string) string {
+	if l == nil {
+		return database
+	}
+	return l(database)
+}
+
+// requestMetrics are the metrics of the REST API requests
+type requestMetrics struct {
+	RequestsTotal   *prometheus.CounterVec
+	RequestDuration *prometheus.HistogramVec
+	ResponseSize    *prometheus.HistogramVec
+
+	databases databaseLabels
+}
+
+func newRequestMetrics(reg *prometheus.Registry) *requestMetrics {
+	return &requestMetrics{
+		RequestsTotal: promauto.With(reg).NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "http_requests_total",
+				Help:      "Number of REST API requests by route, database, HTTP status and gRPC code.",
+			},
+			[]string{"route", "method", "database", "status", "grpc_code"},
+		),
+		RequestDuration: promauto.With(reg).NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: metricsNamespace,
+				Name:      "http_request_duration_seconds",
+				Help:      "Latency of the REST API requests in seconds.",
+				Buckets:   prometheus.DefBuckets,
+			},
+			[]string{"route", "method", "database"},
+		),
+		ResponseSize: promauto.With(reg).NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: metricsNamespace,
+				Name:      "http_response_size_bytes",
+				Help:      "Size of the REST API responses in bytes.",
+				Buckets:   prometheus.ExponentialBuckets(64, 4, 10),
+			},
+			[]string{"route", "method", "database"},
+		),
+	}
+}
+
+// handler records the metrics of the requests served by h
+func (m *requestMetrics) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		req, route := withRequestRoute(req)
+		rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		h.ServeHTTP(rw, req)
+
+		pattern, method := route.Pattern, route.Method
+		if pattern == "" {
+			pattern, method = unmatchedRoute, req.Method
+		}
+		database := m.databases.label(route.Database)
+		m.RequestsTotal.WithLabelValues(
+			pattern, method, database, strconv.Itoa(rw.status), route.grpcCode(rw.status).String(),
+		).Inc()
+		m.RequestDuration.WithLabelValues(pattern, method, database).Observe(time.Since(start).Seconds())
+		m.ResponseSize.WithLabelValues(pattern, method, database).Observe(float64(rw.size))
+	})
+}
+
+// statusRecorder records the status code and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
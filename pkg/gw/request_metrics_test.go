@@ -0,0 +1,89 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/codenotary/immudb/embedded/logger"
+	"github.com/codenotary/immugw/pkg/api"
+	immugwclient "github.com/codenotary/immugw/pkg/client"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	ms := newMetricsServer("", logger.NewSimpleLogger("test", os.Stdout), func() float64 { return 0 })
+	ms.mc.labelDatabases(immugwclient.NewMockClientWithDb(nil, nil, "db1"))
+	m := ms.mc.requests
+
+	mux := runtime.NewServeMux(runtime.WithProtoErrorHandler(routeErrorHandler(api.DefaultGWErrorHandler)))
+	handleRoute(mux, "VerifiedGet", http.MethodPost, api.Pattern_ImmuService_VerifiedGet_0(), func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		if pathParams["databaseName"] == "missingdb" {
+			_, outbound := runtime.MarshalerForRequest(mux, req)
+			runtime.HTTPError(req.Context(), mux, outbound, w, req, status.Error(codes.NotFound, "database not found"))
+			return
+		}
+		w.Write([]byte("{}"))
+	})
+	handler := m.handler(mux)
+
+	serve := func(url string) int {
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader("{}"))
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	pattern := "/db/{databaseName=*}/verified/get"
+
+	require.Equal(t, http.StatusOK, serve("/db/db1/verified/get"))
+	require.Equal(t, http.StatusOK, serve("/db/db1/verified/get"))
+	require.Equal(t, float64(2), testutil.ToFloat64(m.RequestsTotal.WithLabelValues(pattern, "POST", "db1", "200", "OK")))
+	require.Equal(t, 1, testutil.CollectAndCount(m.RequestDuration))
+	require.Equal(t, 1, testutil.CollectAndCount(m.ResponseSize))
+
+	require.Equal(t, http.StatusNotFound, serve("/db/missingdb/verified/get"))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.RequestsTotal.WithLabelValues(pattern, "POST", otherDatabase, "404", "NotFound")))
+
+	// the databases without a client share the same series
+	require.Equal(t, http.StatusOK, serve("/db/random1/verified/get"))
+	require.Equal(t, http.StatusOK, serve("/db/random2/verified/get"))
+	require.Equal(t, float64(2), testutil.ToFloat64(m.RequestsTotal.WithLabelValues(pattern, "POST", otherDatabase, "200", "OK")))
+	require.Equal(t, 2, testutil.CollectAndCount(m.RequestDuration))
+
+	require.Equal(t, http.StatusNotImplemented, serve("/unknown"))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.RequestsTotal.WithLabelValues(unmatchedRoute, "POST", "", "501", "Unimplemented")))
+
+	// request metrics are exported next to the audit metrics
+	ms.mc.UpdateAuditResult("server1", "127.0.0.1", "db1", true, false, true, nil, nil)
+	req, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	ms.mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Contains(t, rr.Body.String(), "immugw_http_requests_total")
+	require.Contains(t, rr.Body.String(), "immugw_http_request_duration_seconds")
+	require.Contains(t, rr.Body.String(), "immugw_audit_result_per_server")
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// requestRoute is the REST route matched by a request. The runtime mux does
+// not expose the matched pattern to the handlers wrapping it, so the route is
+// filled in by the route handler and read back once the request is served.
+type requestRoute struct {
+	Name     string
+	Method   string
+	Pattern  string
+	Database string
+	// User, APIKey and Subject are the immudb identity, the API key and the
+	// JWT subject the request was authenticated with, if any
+	User    string
+	APIKey  string
+	Subject string
+
+	// code is the gRPC code of the error returned to the client, if any
+	code    codes.Code
+	errored bool
+}
+
+type requestRouteKey struct{}
+
+// withRequestRoute returns a copy of req carrying an empty route, or req
+// itself when it already carries one
+func withRequestRoute(req *http.Request) (*http.Request, *requestRoute) {
+	if route := requestRouteFromContext(req.Context()); route != nil {
+		return req, route
+	}
+	route := &requestRoute{}
+	return req.WithContext(context.WithValue(req.Context(), requestRouteKey{}, route)), route
+}
+
+// requestRouteFromContext returns the route of the request, if any
+func requestRouteFromContext(ctx context.Context) *requestRoute {
+	route, _ := ctx.Value(requestRouteKey{}).(*requestRoute)
+	return route
+}
+
+// handleRoute registers h on mux for the route name, method and pattern,
+// recording the matched route and database in the request. The requests
+// carrying an API key or a mapped JWT are served under their immudb identity,
+// once the route policy and the rate limits allow them and their body is
+// within the size limit of the route class. The database named by the body
+// of the admin routes is authorized as well.
+func handleRoute(mux *runtime.ServeMux, name string, method string, pattern runtime.Pattern, h runtime.HandlerFunc) {
+	p := pattern.String()
+	mux.Handle(method, pattern, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		if route := requestRouteFromContext(req.Context()); route != nil {
+			route.Name = name
+			route.Method = method
+			route.Pattern = p
+			route.Database = pathParams["databaseName"]
+		}
+		id, err := requestIdentity(req)
+		if err == nil {
+			err = policiesFromContext(req.Context()).authorize(req, name, pathParams["databaseName"], id)
+		}
+		var release func()
+		if err == nil {
+			release, err = rateLimiterFromContext(req.Context()).acquire(w, req, name, pathParams["databaseName"], id)
+		}
+		if err == nil {
+			err = bodyLimitsFromContext(req.Context()).limit(req, name)
+			if err == nil {
+				err = authorizeBodyDatabase(mux, req, name, pathParams["databaseName"], id)
+			}
+			if err != nil {
+				release()
+			}
+		}
+		if err != nil {
+			_, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
+			runtime.HTTPError(req.Context(), mux, outboundMarshaler, w, req, err)
+			return
+		}
+		defer release()
+		if id != nil {
+			id.serve(mux, name, pathParams["databaseName"], h, w, req, pathParams)
+			return
+		}
+		h(w, req, pathParams)
+	})
+}
+
+// bodyDatabaseRoutes are the admin routes acting on the database named by
+// their request body, which is not necessarily the one of the path, with the
+// message of the body
+var bodyDatabaseRoutes = map[string]func() interface{}{
+	"CreateDatabase":     func() interface{} { return &schema.Database{} },
+	"CreateDatabaseWith": func() interface{} { return &schema.DatabaseSettings{} },
+	"CreateDatabaseV2":   func() interface{} { return &schema.CreateDatabaseRequest{} },
+	"LoadDatabase":       func() interface{} { return &schema.LoadDatabaseRequest{} },
+	"UnloadDatabase":     func() interface{} { return &schema.UnloadDatabaseRequest{} },
+	"DeleteDatabase":     func() interface{} { return &schema.DeleteDatabaseRequest{} },
+	"UpdateDatabase":     func() interface{} { return &schema.DatabaseSettings{} },
+	"UpdateDatabaseV2":   func() interface{} { return &schema.UpdateDatabaseRequest{} },
+	"CreateUser":         func() interface{} { return &schema.CreateUserRequest{} },
+	"ChangePermission":   func() interface{} { return &schema.ChangePermissionRequest{} },
+}
+
+// bodyDatabase returns the database named by the body of req when the route
+// name is one of the bodyDatabaseRoutes. The body is decoded as the handler
+// decodes it and left to be read again.
+func bodyDatabase(mux *runtime.ServeMux, req *http.Request, name string) (string, bool, error) {
+	newMessage, ok := bodyDatabaseRoutes[name]
+	if !ok {
+		return "", false, nil
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", true, nil
+	}
+	bs, err := io.ReadAll(req.Body)
+	if err != nil {
+		return "", false, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(bs))
+
+	inboundMarshaler, _ := runtime.MarshalerForRequest(mux, req)
+	m := newMessage()
+	if err := inboundMarshaler.NewDecoder(bytes.NewReader(bs)).Decode(m); err != nil && err != io.EOF {
+		return "", false, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	switch m := m.(type) {
+	case interface{ GetDatabase() string }:
+		return m.GetDatabase(), true, nil
+	case interface{ GetDatabaseName() string }:
+		return m.GetDatabaseName(), true, nil
+	case interface{ GetName() string }:
+		return m.GetName(), true, nil
+	}
+	return "", true, nil
+}
+
+// authorizeBodyDatabase checks that the route policy and id, if not nil,
+// allow req to access the database named by its body, if the route name has
+// one and it is not the database of the path, already authorized
+func authorizeBodyDatabase(mux *runtime.ServeMux, req *http.Request, name string, database string, id *identity) error {
+	target, ok, err := bodyDatabase(mux, req, name)
+	if err != nil || !ok || target == database {
+		return err
+	}
+	if err := policiesFromContext(req.Context()).authorize(req, name, target, id); err != nil {
+		return err
+	}
+	if id != nil {
+		return id.authorize(name, target)
+	}
+	return nil
+}
+
+// routeErrorHandler records the gRPC code of the errors returned to the
+// client before handing them to h
+func routeErrorHandler(h runtime.ProtoErrorHandlerFunc) runtime.ProtoErrorHandlerFunc {
+	return func(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+		if route := requestRouteFromContext(r.Context()); route != nil {
+			route.code = status.Code(err)
+			route.errored = true
+		}
+		h(ctx, mux, marshaler, w, r, err)
+	}
+}
+
+// grpcCode returns the gRPC code of the request outcome given its HTTP status
+func (r *requestRoute) grpcCode(httpStatus int) codes.Code {
+	if r.errored {
+		return r.code
+	}
+	if httpStatus >= http.StatusBadRequest {
+		return codes.Unknown
+	}
+	return codes.OK
+}
@@ -18,6 +18,7 @@ package gw
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"fmt"
 	"net/http"
 	"os"
@@ -27,18 +28,16 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/codenotary/immudb/pkg/client/auditor"
-	"github.com/codenotary/immudb/pkg/client/cache"
-	"github.com/codenotary/immudb/pkg/client/state"
 	"github.com/codenotary/immugw/pkg/api"
 	immugwclient "github.com/codenotary/immugw/pkg/client"
 
 	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immudb/pkg/client/state"
 	"github.com/codenotary/immudb/pkg/immuos"
 	"github.com/codenotary/immudb/pkg/server"
+	"github.com/codenotary/immudb/pkg/signer"
 	"github.com/codenotary/immugw/pkg/json"
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
-	"github.com/rs/cors"
 )
 
 var startedAt time.Time
@@ -49,7 +48,57 @@ func (s *ImmuGwServer) Start() error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	client := immugwclient.New(&s.CliOptions)
+	var err error
+
+	var auditPubKey *ecdsa.PublicKey
+	if s.Options.Audit {
+		if auditPubKey, err = s.auditServerSigningPubKey(); err != nil {
+			s.Logger.Errorf("invalid audit configuration: %s", err)
+			return err
+		}
+	}
+
+	if s.logger == nil {
+		s.logger = newReloadableLogger(s.Logger)
+		s.Logger = s.logger
+	}
+
+	tlsConfig, err := restTLSConfig(s.Options)
+	if err != nil {
+		s.Logger.Errorf("invalid tls configuration: %s", err)
+		return err
+	}
+
+	tp, err := newTracerProvider(s.Options)
+	if err != nil {
+		s.Logger.Errorf("invalid tracing configuration: %s", err)
+		return err
+	}
+
+	accessLog, err := newAccessLog(s.Options)
+	if err != nil {
+		s.Logger.Errorf("unable to open access log: %s", err)
+		return err
+	}
+	defer accessLog.Close()
+
+	s.CliOptions.DialOptions = requestIDDialOptions(s.CliOptions.DialOptions)
+	wrapStateService := newProvedStateService
+	if tp != nil {
+		installTracing(tp)
+		// deferred before the cleanup so that the spans are flushed last
+		defer s.shutdownTracing(tp)
+		s.CliOptions.DialOptions = tracingDialOptions(s.CliOptions.DialOptions)
+		wrapStateService = func(db string, ss state.StateService) state.StateService {
+			return newTracedStateService(db, newProvedStateService(db, ss))
+		}
+	}
+	// the dual proofs are checked last, as they are returned to the client
+	s.CliOptions.DialOptions = stateProofDialOptions(s.CliOptions.DialOptions)
+	client := immugwclient.NewWithStateServiceWrapper(&s.CliOptions, wrapStateService)
+	// deferred first so that it runs once everything else has been stopped
+	defer s.cleanup(client)
+	s.MetricServer.mc.labelDatabases(client)
 
 	ic, err := client.Add("defaultdb") // TODO: fix this and make this dynamic
 	if err != nil {
@@ -57,11 +106,80 @@ func (s *ImmuGwServer) Start() error {
 		return err
 	}
 
-	ic.WithTokenService(s.Options.TokenService)
+	keys, err := loadAPIKeys(s.Options.APIKeysFile, ic.GetServiceClient())
+	if err != nil {
+		s.Logger.Errorf("unable to load API keys: %s", err)
+		return err
+	}
+	jwtAuth, err := newJWTAuth(s.Options, ic.GetServiceClient())
+	if err != nil {
+		s.Logger.Errorf("unable to set up JWT authentication: %s", err)
+		return err
+	}
+	policies := newPolicies(s.Logger)
+	if err := policies.load(s.Options.PolicyFile, s.Options.PolicyDryRun); err != nil {
+		s.Logger.Errorf("unable to load route policy: %s", err)
+		return err
+	}
+	rateLimiter := newRateLimiter(s.MetricServer.mc.limits)
+	if err := rateLimiter.load(s.Options.RateLimitsFile); err != nil {
+		s.Logger.Errorf("unable to load rate limits: %s", err)
+		return err
+	}
+	cors := &corsHandler{}
+	if err := cors.load(s.Options); err != nil {
+		s.Logger.Errorf("invalid CORS configuration: %s", err)
+		return err
+	}
+	bodyLimits, err := newBodyLimits(s.Options)
+	if err != nil {
+		s.Logger.Errorf("invalid body size limits: %s", err)
+		return err
+	}
+	s.reloadMu.Lock()
+	s.policies = policies
+	s.rateLimiter = rateLimiter
+	s.cors = cors
+	s.reloadMu.Unlock()
+
+	livenessChecks, err := s.healthChecks(s.Options.LivenessChecks, client)
+	if err != nil {
+		s.Logger.Errorf("invalid liveness checks: %s", err)
+		return err
+	}
+	readinessChecks, err := s.healthChecks(s.Options.ReadinessChecks, client)
+	if err != nil {
+		s.Logger.Errorf("invalid readiness checks: %s", err)
+		return err
+	}
+	s.MetricServer.handleHealth(livenessChecks, readinessChecks)
 
-	mux := runtime.NewServeMux(runtime.WithProtoErrorHandler(api.DefaultGWErrorHandler))
+	muxOptions := []runtime.ServeMuxOption{runtime.WithProtoErrorHandler(routeErrorHandler(problemErrorHandler))}
+	if s.Options.StrictJSON {
+		muxOptions = append(muxOptions, runtime.WithMarshalerOption(runtime.MIMEWildcard, newStrictJSONPb()))
+	}
+	mux := runtime.NewServeMux(muxOptions...)
 
-	handler := cors.Default().Handler(mux)
+	var handler http.Handler = mux
+	handler = s.MetricServer.mc.verifications.handler(handler)
+	handler = bodyLimits.handler(handler)
+	handler = policies.handler(handler)
+	handler = rateLimiter.handler(handler)
+	if keys != nil {
+		handler = keys.handler(handler)
+	}
+	if jwtAuth != nil {
+		handler = jwtAuth.handler(mux, handler)
+	}
+	if tp != nil {
+		handler = tracingHandler(handler)
+	}
+	handler = s.MetricServer.mc.requests.handler(handler)
+	if accessLog != nil {
+		handler = accessLog.handler(handler)
+	}
+	handler = requestIDHandler(handler)
+	handler = clientCertSubjectHandler(cors.handler(handler))
 
 	rt := DefaultRuntime()
 	json := json.DefaultJSON()
@@ -75,16 +193,24 @@ func (s *ImmuGwServer) Start() error {
 	udb := NewUseDatabaseHandler(mux, client, rt, json)
 	tx := NewVerifiedTxByIdHandler(mux, client, rt, json)
 	vsql := NewVerifiedSQLGetHandler(mux, client, rt, json)
+	vscan := NewVerifiedScanHandler(mux, client, rt, json)
+	vhh := NewVerifiedHistoryHandler(mux, client, rt, json)
+	sth := NewStreamHandler(mux, client, rt, json)
 
-	mux.Handle(http.MethodPost, api.Pattern_ImmuService_Set_0, sh.Set)
-	mux.Handle(http.MethodPost, api.Pattern_ImmuService_VerifiedSet_0(), ssh.VerifiedSet)
-	mux.Handle(http.MethodPost, api.Pattern_ImmuService_VerifiedGet_0(), sgh.VerifiedGet)
-	mux.Handle(http.MethodPost, api.Pattern_ImmuService_History_0, hh.History)
-	mux.Handle(http.MethodPost, api.Pattern_ImmuService_VerifiedSetReference_0(), sr.SafeReference)
-	mux.Handle(http.MethodPost, api.Pattern_ImmuService_VerifiedZAdd_0(), sza.VerifiedZadd)
-	mux.Handle(http.MethodGet, schema.Pattern_ImmuService_UseDatabase_0(), udb.UseDatabase)
-	mux.Handle(http.MethodGet, api.Pattern_ImmuService_VerifiedTxById_0(), tx.VerifiedTxById)
-	mux.Handle(http.MethodPost, api.Pattern_ImmuService_VerifiableSQLGet_0(), vsql.VerifiedSQLGetHandler)
+	handleRoute(mux, "Set", http.MethodPost, api.Pattern_ImmuService_Set_0, sh.Set)
+	handleRoute(mux, "VerifiedSet", http.MethodPost, api.Pattern_ImmuService_VerifiedSet_0(), ssh.VerifiedSet)
+	handleRoute(mux, "VerifiedGet", http.MethodPost, api.Pattern_ImmuService_VerifiedGet_0(), sgh.VerifiedGet)
+	handleRoute(mux, "History", http.MethodPost, api.Pattern_ImmuService_History_0, hh.History)
+	handleRoute(mux, "VerifiedSetReference", http.MethodPost, api.Pattern_ImmuService_VerifiedSetReference_0(), sr.SafeReference)
+	handleRoute(mux, "VerifiedZAdd", http.MethodPost, api.Pattern_ImmuService_VerifiedZAdd_0(), sza.VerifiedZadd)
+	handleRoute(mux, "UseDatabase", http.MethodGet, schema.Pattern_ImmuService_UseDatabase_0(), udb.UseDatabase)
+	handleRoute(mux, "VerifiedTxById", http.MethodGet, api.Pattern_ImmuService_VerifiedTxById_0(), tx.VerifiedTxById)
+	handleRoute(mux, "VerifiableSQLGet", http.MethodPost, api.Pattern_ImmuService_VerifiableSQLGet_0(), vsql.VerifiedSQLGetHandler)
+	handleRoute(mux, "VerifiedScan", http.MethodPost, api.Pattern_ImmuService_VerifiedScan_0(), vscan.VerifiedScan)
+	handleRoute(mux, "VerifiedHistory", http.MethodPost, api.Pattern_ImmuService_VerifiedHistory_0(), vhh.VerifiedHistory)
+	handleRoute(mux, "StreamSet", http.MethodPost, api.Pattern_ImmuService_StreamSet_0(), sth.StreamSet)
+	handleRoute(mux, "StreamVerifiedSet", http.MethodPost, api.Pattern_ImmuService_StreamVerifiedSet_0(), sth.StreamVerifiedSet)
+	handleRoute(mux, "StreamVerifiedGet", http.MethodGet, api.Pattern_ImmuService_StreamVerifiedGet_0(), sth.StreamVerifiedGet)
 
 	err = RegisterImmuServiceHandlerClient(ctx, mux, client, ic.GetServiceClient())
 	if err != nil {
@@ -92,7 +218,13 @@ func (s *ImmuGwServer) Start() error {
 		return err
 	}
 
+	client.WithMaxUsers(s.Options.MaxUserClients)
+	if s.Options.ClientIdleTimeout > 0 {
+		go s.evictIdleClients(ctx, client, s.Options.ClientIdleTimeout)
+	}
+
 	s.installShutdownHandler()
+	s.installReloadHandler()
 	s.Logger.Infof("starting immugw: %v", s.Options)
 	if s.Options.Pidfile != "" {
 		if s.Pid, err = server.NewPid(s.Options.Pidfile, immuos.NewStandardOS()); err != nil {
@@ -102,31 +234,81 @@ func (s *ImmuGwServer) Start() error {
 	}
 
 	if s.Options.Audit {
-		defaultAuditor, err := auditor.DefaultAuditor(
-			s.Options.AuditInterval,
+		if s.Options.AuditInterval <= 0 {
+			s.Logger.Errorf("unable to start auditor: %s", ErrInvalidAuditInterval)
+			return ErrInvalidAuditInterval
+		}
+		updateAuditResult := s.MetricServer.mc.UpdateAuditResult
+
+		history, err := newAuditHistory(filepath.Join(s.Options.Dir, "audit_history"), s.Logger)
+		if err != nil {
+			s.Logger.Errorf("unable to open audit history: %s", err)
+			return err
+		}
+		s.MetricServer.handleAuditHistory(history)
+
+		if len(s.Options.AuditNotificationURLs) > 0 {
+			n, err := newNotifier(
+				filepath.Join(s.Options.Dir, "notifications"),
+				s.Options.AuditNotificationURLs,
+				s.Options.AuditNotificationSecret,
+				s.Options.AuditNotificationRetries,
+				s.Options.AuditNotificationRetryInterval,
+				s.Logger,
+			)
+			if err != nil {
+				s.Logger.Errorf("unable to create audit notifier: %s", err)
+				return err
+			}
+			notifierDone := make(chan struct{}, 1)
+			go n.Run(ctx.Done(), notifierDone)
+			defer func() {
+				cancel()
+				<-notifierDone
+			}()
+			updateAuditResult = chainAuditResults(updateAuditResult, n.UpdateAuditResult)
+		}
+
+		defaultAuditor, err := newAuditor(
 			fmt.Sprintf("%s:%d", s.Options.ImmudbAddress, s.Options.ImmudbPort),
-			s.CliOptions.DialOptions,
 			s.Options.AuditUsername,
 			s.Options.AuditPassword,
-			nil,
-			nil,
-			auditor.AuditNotificationConfig{},
+			s.Options.AuditDatabases,
+			auditPubKey,
 			ic.GetServiceClient(),
-			state.NewUUIDProvider(ic.GetServiceClient()),
-			cache.NewHistoryFileCache(filepath.Join(s.CliOptions.Dir, "auditor")),
-			s.MetricServer.mc.UpdateAuditResult,
+			filepath.Join(s.CliOptions.Dir, "auditor"),
+			updateAuditResult,
+			history.Append,
 			s.Logger,
-			nil)
+		)
 		if err != nil {
 			s.Logger.Errorf("unable to create auditor: %s", err)
 			return err
 		}
-		go defaultAuditor.Run(s.Options.AuditInterval, false, ctx.Done(), s.auditorDone)
+		if s.Options.AuditRunToken != "" {
+			s.MetricServer.handleAuditRun(defaultAuditor, s.Options.AuditRunToken)
+		}
+		s.reloadMu.Lock()
+		s.auditor = defaultAuditor
+		s.reloadMu.Unlock()
+		go defaultAuditor.Run(s.Options.AuditInterval, ctx.Done(), s.auditorDone)
 		defer func() { <-s.auditorDone }()
 	}
 
+	restServer := &http.Server{
+		Addr:      s.Options.Address + ":" + strconv.Itoa(s.Options.Port),
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
 	go func() {
-		if err = http.ListenAndServe(s.Options.Address+":"+strconv.Itoa(s.Options.Port), handler); err != nil && err != http.ErrServerClosed {
+		var err error
+		if tlsConfig != nil {
+			// the certificate is already loaded in the tls configuration
+			err = restServer.ListenAndServeTLS("", "")
+		} else {
+			err = restServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			s.Logger.Errorf("unable to launch immugw: %+s", err)
 		}
 	}()
@@ -139,12 +321,56 @@ func (s *ImmuGwServer) Start() error {
 	}()
 	startedAt = time.Now()
 	<-s.quit
-	if s.Options.Audit {
-		cancel()
-	}
+
+	s.Logger.Infof("shutting down immugw, waiting up to %s for in-flight requests ...", s.Options.ShutdownTimeout)
+	s.drain(restServer)
+	// stops the auditor and the notifier, their completion is awaited by the deferred calls above
+	cancel()
 	return err
 }
 
+// drain stops accepting new requests and waits for the in-flight ones to
+// complete within the shutdown timeout, the remaining connections are closed
+func (s *ImmuGwServer) drain(restServer *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Options.ShutdownTimeout)
+	defer cancel()
+
+	if err := restServer.Shutdown(ctx); err != nil {
+		s.Logger.Warningf("in-flight requests not completed within %s, closing their connections: %s", s.Options.ShutdownTimeout, err)
+		if err := restServer.Close(); err != nil {
+			s.Logger.Errorf("failed to close immugw connections: %s", err)
+		}
+	}
+}
+
+// cleanup disconnects the clients of every database and removes the pidfile
+func (s *ImmuGwServer) cleanup(client immugwclient.Client) {
+	if err := client.Close(); err != nil {
+		s.Logger.Errorf("failed to close immudb clients: %s", err)
+	}
+	if s.Pid != (server.PIDFile{}) {
+		if err := s.Pid.Remove(); err != nil {
+			s.Logger.Errorf("failed to remove pidfile: %s", err)
+		}
+	}
+	s.Logger.Infof("immugw stopped")
+}
+
+// auditServerSigningPubKey returns the public key the auditor verifies the
+// server signatures with, nil when signatures are ignored
+func (s *ImmuGwServer) auditServerSigningPubKey() (*ecdsa.PublicKey, error) {
+	switch s.Options.AuditSignature {
+	case "", "ignore":
+		return nil, nil
+	case "validate":
+		if s.Options.AuditServerSigningPubKey == "" {
+			return nil, ErrAuditSigningPubKeyRequired
+		}
+		return signer.ParsePublicKeyFile(s.Options.AuditServerSigningPubKey)
+	}
+	return nil, ErrInvalidAuditSignature
+}
+
 // Stop stops the immudb gateway server
 func (s *ImmuGwServer) Stop() error {
 	s.Logger.Infof("stopping immugw: %v", s.Options)
@@ -156,14 +382,10 @@ func (s *ImmuGwServer) installShutdownHandler() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		defer func() {
-			s.quit <- struct{}{}
-		}()
 		<-c
 		s.Logger.Debugf("Caught SIGTERM")
 		if err := s.Stop(); err != nil {
 			s.Logger.Errorf("Shutdown error: %v", err)
 		}
-		s.Logger.Infof("Shutdown completed")
 	}()
 }
@@ -16,6 +16,13 @@ limitations under the License.
 package gw
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -23,11 +30,15 @@ import (
 
 	"github.com/codenotary/immudb/embedded/logger"
 	"github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/client/clienttest"
 	"github.com/codenotary/immudb/pkg/client/homedir"
 	"github.com/codenotary/immudb/pkg/client/tokenservice"
+	"github.com/codenotary/immudb/pkg/immuos"
 	"github.com/codenotary/immudb/pkg/server"
 	"github.com/codenotary/immudb/pkg/server/servertest"
+	immugwclient "github.com/codenotary/immugw/pkg/client"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 )
 
@@ -85,6 +96,7 @@ func TestImmuGwServer_StartWithAuditor(t *testing.T) {
 	defer func() {
 		matches, _ := filepath.Glob("state-*")
 		os.RemoveAll(options.Dir)
+		os.RemoveAll("audit_history")
 		for _, m := range matches {
 			os.RemoveAll(m)
 		}
@@ -123,3 +135,171 @@ func TestImmuGwServer_StartWithAuditor(t *testing.T) {
 	err := gw.Start()
 	assert.Nil(t, err)
 }
+
+func TestImmuGwServer_StartWithAuditorSignatureValidationWithoutKey(t *testing.T) {
+	gw := ImmuGwServer{
+		Options: Options{}.WithAudit(true).WithAuditSignature("validate"),
+		Logger:  logger.NewSimpleLogger("test", os.Stdout),
+	}
+
+	err := gw.Start()
+	assert.ErrorIs(t, err, ErrAuditSigningPubKeyRequired)
+}
+
+func TestImmuGwServer_AuditServerSigningPubKey(t *testing.T) {
+	dir := t.TempDir()
+
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pubKeyBytes, err := x509.MarshalPKIXPublicKey(&pk.PublicKey)
+	require.NoError(t, err)
+
+	validPubKey := filepath.Join(dir, "pub.pem")
+	require.NoError(t, os.WriteFile(validPubKey, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubKeyBytes}), 0600))
+	invalidPubKey := filepath.Join(dir, "invalid.pem")
+	require.NoError(t, os.WriteFile(invalidPubKey, []byte("not a key"), 0600))
+
+	tt := []struct {
+		name      string
+		signature string
+		pubKey    string
+		wantKey   bool
+		wantErr   error
+	}{
+		{"default", "", "", false, nil},
+		{"ignore", "ignore", validPubKey, false, nil},
+		{"validate", "validate", validPubKey, true, nil},
+		{"validate without key", "validate", "", false, ErrAuditSigningPubKeyRequired},
+		{"unknown mode", "verify", validPubKey, false, ErrInvalidAuditSignature},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			gw := ImmuGwServer{
+				Options: Options{}.
+					WithAuditSignature(tc.signature).
+					WithAuditServerSigningPubKey(tc.pubKey),
+			}
+
+			key, err := gw.auditServerSigningPubKey()
+			require.ErrorIs(t, err, tc.wantErr)
+			if tc.wantKey {
+				require.True(t, pk.PublicKey.Equal(key))
+			} else {
+				require.Nil(t, key)
+			}
+		})
+	}
+
+	for _, pubKey := range []string{invalidPubKey, filepath.Join(dir, "missing.pem")} {
+		gw := ImmuGwServer{
+			Options: Options{}.
+				WithAuditSignature("validate").
+				WithAuditServerSigningPubKey(pubKey),
+		}
+		_, err := gw.auditServerSigningPubKey()
+		require.Error(t, err)
+	}
+}
+
+func TestImmuGwServer_Drain(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	restServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	restServer.Start()
+	defer restServer.Close()
+
+	gw := ImmuGwServer{
+		Options: DefaultOptions().WithShutdownTimeout(5 * time.Second),
+		Logger:  logger.NewSimpleLogger("test", os.Stdout),
+	}
+
+	// in-flight requests complete before the server is shut down
+	respc := make(chan *http.Response, 1)
+	errc := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(restServer.URL)
+		respc <- resp
+		errc <- err
+	}()
+	<-started
+
+	drained := make(chan struct{})
+	go func() {
+		gw.drain(restServer.Config)
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		t.Fatal("the server has been shut down with requests in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-drained
+
+	resp := <-respc
+	require.NoError(t, <-errc)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	// new requests are refused
+	_, err := http.Get(restServer.URL)
+	require.Error(t, err)
+}
+
+func TestImmuGwServer_DrainTimeout(t *testing.T) {
+	started := make(chan struct{}, 1)
+	restServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		<-req.Context().Done()
+	}))
+	restServer.Start()
+	defer restServer.Close()
+
+	gw := ImmuGwServer{
+		Options: DefaultOptions().WithShutdownTimeout(10 * time.Millisecond),
+		Logger:  logger.NewSimpleLogger("test", os.Stdout),
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := http.Get(restServer.URL)
+		errc <- err
+	}()
+	<-started
+
+	// connections of requests not completed within the timeout are closed
+	gw.drain(restServer.Config)
+	require.Error(t, <-errc)
+}
+
+func TestImmuGwServer_Cleanup(t *testing.T) {
+	pidfile := filepath.Join(t.TempDir(), "immugw.pid")
+	pid, err := server.NewPid(pidfile, immuos.NewStandardOS())
+	require.NoError(t, err)
+	require.FileExists(t, pidfile)
+
+	disconnected := false
+	cli := &clienttest.ImmuClientMock{
+		IsConnectedF: func() bool { return true },
+		DisconnectF: func() error {
+			disconnected = true
+			return nil
+		},
+	}
+
+	gw := ImmuGwServer{
+		Options: DefaultOptions().WithPidfile(pidfile),
+		Logger:  logger.NewSimpleLogger("test", os.Stdout),
+		Pid:     pid,
+	}
+	gw.cleanup(immugwclient.NewMockClient(cli, client.DefaultOptions()))
+
+	require.True(t, disconnected)
+	require.NoFileExists(t, pidfile)
+}
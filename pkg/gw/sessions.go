@@ -0,0 +1,103 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	immuclient "github.com/codenotary/immudb/pkg/client"
+	immugwclient "github.com/codenotary/immugw/pkg/client"
+)
+
+// requestUser returns the immudb user of the token of req, empty for the
+// requests without a token. The token is not verified, immudb verifies it on
+// every call made with it: the user only selects the client the call is made
+// with, so that the users do not share their token stores.
+func requestUser(req *http.Request) string {
+	token := strings.TrimSpace(req.Header.Get("Authorization"))
+	if len(token) > len("Bearer ") && strings.EqualFold(token[:len("Bearer ")], "Bearer ") {
+		token = strings.TrimSpace(token[len("Bearer "):])
+	}
+	return tokenUser(token)
+}
+
+// tokenUser returns the subject of the public payload of an immudb token,
+// a PASETO v2 public token: version.purpose.payload[.footer], the payload
+// being the JSON claims followed by their ed25519 signature
+func tokenUser(token string) string {
+	pieces := strings.Split(token, ".")
+	if len(pieces) < 3 || pieces[0] != "v2" || pieces[1] != "public" {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(pieces[2])
+	if err != nil || len(payload) < ed25519.SignatureSize {
+		return ""
+	}
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload[:len(payload)-ed25519.SignatureSize], &claims); err != nil {
+		return ""
+	}
+	return claims.Subject
+}
+
+// clientFor returns the client of the user of req for database db, in use
+// until req is done so that it is not evicted while serving a long request
+func clientFor(client immugwclient.Client, req *http.Request, db string) (immuclient.ImmuClient, error) {
+	cli, release, err := client.ForUser(requestUser(req), db)
+	if err != nil {
+		return nil, err
+	}
+	done := req.Context().Done()
+	if done == nil {
+		release()
+		return cli, nil
+	}
+	go func() {
+		<-done
+		release()
+	}()
+	return cli, nil
+}
+
+// evictIdleClients disconnects the clients of the users idle for longer than
+// idle until ctx is done
+func (s *ImmuGwServer) evictIdleClients(ctx context.Context, client immugwclient.Client, idle time.Duration) {
+	interval := idle / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n := client.EvictIdle(idle); n > 0 {
+				s.Logger.Debugf("disconnected %d idle user clients", n)
+			}
+		}
+	}
+}
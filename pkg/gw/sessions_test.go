@@ -0,0 +1,119 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb/pkg/auth"
+	immuclient "github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/client/clienttest"
+	immugwclient "github.com/codenotary/immugw/pkg/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestUser(t *testing.T) {
+	token, err := auth.GenerateToken(auth.User{Username: "alice"}, 0, 60)
+	require.NoError(t, err)
+	require.Equal(t, "alice", tokenUser(token))
+
+	for header, user := range map[string]string{
+		"Bearer " + token:             "alice",
+		"bearer  " + token:            "alice",
+		token:                         "alice",
+		"":                            "",
+		"Bearer":                      "",
+		"Bearer v2.public":            "",
+		"Bearer v2.public.!!!.immudb": "",
+		"Bearer v2.public.eyJzdWIiOiJhbGljZSJ9.immudb": "",
+		"ApiKey key1": "",
+	} {
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", header)
+		require.Equal(t, user, requestUser(req), header)
+	}
+}
+
+type idleClient struct {
+	immugwclient.Client
+	evictions chan time.Duration
+}
+
+func (c *idleClient) EvictIdle(idle time.Duration) int {
+	c.evictions <- idle
+	return 1
+}
+
+func TestEvictIdleClients(t *testing.T) {
+	s := DefaultServer()
+	client := &idleClient{
+		Client:    immugwclient.NewMockClient(&clienttest.ImmuClientMock{}, immuclient.DefaultOptions()),
+		evictions: make(chan time.Duration, 1),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.evictIdleClients(ctx, client, time.Millisecond)
+		close(done)
+	}()
+
+	require.Equal(t, time.Millisecond, <-client.evictions)
+	cancel()
+	<-done
+}
+
+type userClient struct {
+	immugwclient.Client
+	user     string
+	released chan struct{}
+}
+
+func (c *userClient) ForUser(user string, db string) (immuclient.ImmuClient, func(), error) {
+	c.user = user
+	return nil, func() { close(c.released) }, nil
+}
+
+func TestClientForReleasesOnRequestDone(t *testing.T) {
+	client := &userClient{
+		Client:   immugwclient.NewMockClient(&clienttest.ImmuClientMock{}, immuclient.DefaultOptions()),
+		released: make(chan struct{}),
+	}
+	token, err := auth.GenerateToken(auth.User{Username: "alice"}, 0, 60)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	_, err = clientFor(client, req, "defaultdb")
+	require.NoError(t, err)
+	require.Equal(t, "alice", client.user)
+
+	// the client stays in use while the request is served
+	select {
+	case <-client.released:
+		t.Fatal("client released before the request is done")
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancel()
+	<-client.released
+}
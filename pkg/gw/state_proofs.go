@@ -0,0 +1,188 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"sync"
+
+	"github.com/codenotary/immudb/embedded/store"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immudb/pkg/client/state"
+	"google.golang.org/grpc"
+)
+
+// stateProof is what the gateway saw of the last verified call of the immudb
+// client made for a request: the local state the call started from, and
+// whether the dual proof returned by immudb is consistent with it. The immudb
+// client reports every failed proof as corrupted data, the consistency of the
+// dual proof tells the consistency failures from the inclusion ones.
+type stateProof struct {
+	mu    sync.Mutex
+	state *schema.ImmutableState
+	// checked is set once the dual proof has been checked against state
+	checked    bool
+	consistent bool
+	// targetTx is the tx of the state the call advances to
+	targetTx uint64
+}
+
+type stateProofKey struct{}
+
+// withStateProof returns ctx with a new state proof record
+func withStateProof(ctx context.Context) context.Context {
+	return context.WithValue(ctx, stateProofKey{}, &stateProof{})
+}
+
+// stateProofFromContext returns the state proof record of ctx, nil if there
+// is none
+func stateProofFromContext(ctx context.Context) *stateProof {
+	p, _ := ctx.Value(stateProofKey{}).(*stateProof)
+	return p
+}
+
+// setState records the local state a verified call starts from
+func (p *stateProof) setState(s *schema.ImmutableState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state = s
+	p.checked, p.consistent, p.targetTx = false, false, 0
+}
+
+// check checks the dual proof returned by immudb against the recorded state,
+// the way the immudb client does, the state being checked once. The proofs
+// missing a linear advance proof immudb would have to complete are not
+// checked.
+func (p *stateProof) check(vTx *schema.VerifiableTx) {
+	if vTx == nil || vTx.DualProof == nil || vTx.DualProof.SourceTxHeader == nil || vTx.DualProof.TargetTxHeader == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state == nil {
+		return
+	}
+	state := p.state
+	p.state = nil
+
+	dualProof := schema.DualProofFromProto(vTx.DualProof)
+	p.targetTx = dualProof.TargetTxHeader.ID
+	p.checked = true
+	// the client has nothing to check the first state against
+	if state.TxId == 0 {
+		p.consistent = true
+		return
+	}
+
+	sourceID, targetID := dualProof.SourceTxHeader.ID, dualProof.TargetTxHeader.ID
+	sourceAlh, targetAlh := dualProof.SourceTxHeader.Alh(), dualProof.TargetTxHeader.Alh()
+	switch state.TxId {
+	case sourceID:
+		sourceAlh = schema.DigestFromProto(state.TxHash)
+	case targetID:
+		targetAlh = schema.DigestFromProto(state.TxHash)
+	default:
+		p.consistent = false
+		return
+	}
+	if dualProof.LinearAdvanceProof == nil {
+		end := sourceID
+		if dualProof.TargetTxHeader.BlTxID < end {
+			end = dualProof.TargetTxHeader.BlTxID
+		}
+		if end > dualProof.SourceTxHeader.BlTxID+1 {
+			p.checked = false
+			return
+		}
+	}
+	p.consistent = store.VerifyDualProof(dualProof, sourceID, targetID, sourceAlh, targetAlh)
+}
+
+// failure returns the kind of the proof which failed in the last verified
+// call, unknown if its dual proof was not checked
+func (p *stateProof) failure() string {
+	if p == nil {
+		return VerificationUnknown
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case !p.checked:
+		return VerificationUnknown
+	case p.consistent:
+		return VerificationInclusion
+	default:
+		return VerificationConsistency
+	}
+}
+
+// verifiedTx returns the tx of the state the last verified call advanced
+// to, 0 if it is not known
+func (p *stateProof) verifiedTx() uint64 {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.checked {
+		return 0
+	}
+	return p.targetTx
+}
+
+// provedStateService records the local states the verified calls of the
+// immudb client start from in the state proof of their context
+type provedStateService struct {
+	state.StateService
+}
+
+func newProvedStateService(db string, s state.StateService) state.StateService {
+	return &provedStateService{StateService: s}
+}
+
+func (s *provedStateService) GetState(ctx context.Context, db string) (*schema.ImmutableState, error) {
+	st, err := s.StateService.GetState(ctx, db)
+	if p := stateProofFromContext(ctx); p != nil && err == nil {
+		p.setState(st)
+	}
+	return st, err
+}
+
+// stateProofDialOptions returns opts with the interceptor checking the dual
+// proofs returned to the immudb client
+func stateProofDialOptions(opts []grpc.DialOption) []grpc.DialOption {
+	return append(opts[:len(opts):len(opts)],
+		grpc.WithChainUnaryInterceptor(stateProofUnaryInterceptor),
+	)
+}
+
+func stateProofUnaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	p := stateProofFromContext(ctx)
+	if err != nil || p == nil {
+		return err
+	}
+	switch r := reply.(type) {
+	case *schema.VerifiableTx:
+		p.check(r)
+	case *schema.VerifiableEntry:
+		p.check(r.GetVerifiableTx())
+	case *schema.VerifiableSQLEntry:
+		p.check(r.GetVerifiableTx())
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"context"
+	"testing"
+
+	"github.com/codenotary/immudb/embedded/store"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	immuclient "github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/server"
+	"github.com/codenotary/immudb/pkg/server/servertest"
+	immugwclient "github.com/codenotary/immugw/pkg/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestStateProof(t *testing.T) {
+	bs := servertest.NewBufconnServer(server.DefaultOptions().WithAuth(false).WithDir(t.TempDir()))
+	bs.Start()
+	defer bs.Stop()
+
+	opts := immuclient.DefaultOptions().
+		WithDialOptions(stateProofDialOptions([]grpc.DialOption{grpc.WithContextDialer(bs.Dialer), grpc.WithInsecure()})).
+		WithAuth(false).
+		WithDir(t.TempDir())
+	client := immugwclient.NewWithStateServiceWrapper(opts, newProvedStateService)
+	ic, err := client.Add("defaultdb")
+	require.NoError(t, err)
+
+	for _, v := range []string{"value1", "value2", "value3"} {
+		_, err = ic.Set(context.Background(), []byte("key1"), []byte(v))
+		require.NoError(t, err)
+	}
+
+	// the verified calls of the client record the state they advance to
+	ctx := withStateProof(context.Background())
+	_, err = ic.VerifiedGet(ctx, []byte("key1"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), stateProofFromContext(ctx).verifiedTx())
+
+	// the state is checked once, the raw calls made afterwards are not
+	vEntry, err := ic.GetServiceClient().VerifiableGet(ctx, &schema.VerifiableGetRequest{
+		KeyRequest:   &schema.KeyRequest{Key: []byte("key1")},
+		ProveSinceTx: 1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), stateProofFromContext(ctx).verifiedTx())
+
+	source := schema.TxHeaderFromProto(vEntry.VerifiableTx.DualProof.SourceTxHeader)
+	require.Equal(t, uint64(1), source.ID)
+	alh := source.Alh()
+
+	p := &stateProof{}
+	require.Equal(t, VerificationUnknown, p.failure())
+	require.Zero(t, p.verifiedTx())
+
+	p.setState(&schema.ImmutableState{TxId: 1, TxHash: alh[:]})
+	p.check(vEntry.VerifiableTx)
+	require.Equal(t, VerificationInclusion, p.failure())
+	require.Equal(t, uint64(3), p.verifiedTx())
+
+	// a state immudb is not consistent with fails the consistency proof
+	p.setState(&schema.ImmutableState{TxId: 1, TxHash: make([]byte, len(alh))})
+	p.check(vEntry.VerifiableTx)
+	require.Equal(t, VerificationConsistency, p.failure())
+
+	p.setState(&schema.ImmutableState{TxId: 2, TxHash: alh[:]})
+	p.check(vEntry.VerifiableTx)
+	require.Equal(t, VerificationConsistency, p.failure())
+
+	// there is nothing to check the first state against
+	p.setState(&schema.ImmutableState{})
+	p.check(vEntry.VerifiableTx)
+	require.Equal(t, VerificationInclusion, p.failure())
+
+	// the failures of the immudb client are told apart by their state proof
+	v := newVerifications(prometheus.NewRegistry(), 3)
+	p.setState(&schema.ImmutableState{TxId: 1, TxHash: make([]byte, len(alh))})
+	p.check(vEntry.VerifiableTx)
+	v.failed(context.WithValue(context.Background(), stateProofKey{}, p), "defaultdb", "VerifiedGet", []byte("key1"), 0, store.ErrCorruptedData)
+	require.Equal(t, float64(1), testutil.ToFloat64(v.Failed.WithLabelValues("defaultdb", "VerifiedGet", VerificationConsistency)))
+	v.failed(context.Background(), "defaultdb", "VerifiedGet", []byte("key1"), 0, store.ErrCorruptedData)
+	require.Equal(t, float64(1), testutil.ToFloat64(v.Failed.WithLabelValues("defaultdb", "VerifiedGet", VerificationUnknown)))
+}
@@ -0,0 +1,463 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/codenotary/immudb/embedded/store"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	immuclient "github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/database"
+	"github.com/codenotary/immudb/pkg/stream"
+	immugwclient "github.com/codenotary/immugw/pkg/client"
+	"github.com/codenotary/immugw/pkg/json"
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// StreamTxHeader is the tx of the entry whose value is streamed
+	StreamTxHeader = "X-Immugw-Tx"
+	// StreamVerifiedTrailer and StreamErrorTrailer are the trailers the
+	// outcome of the verification of the streamed value is sent in, once the
+	// whole value has been sent. The error is the code of the problem the
+	// failure would be reported with.
+	StreamVerifiedTrailer = "X-Immugw-Verified"
+	StreamErrorTrailer    = "X-Immugw-Error"
+)
+
+// streamRoutes read their request body while sending it to immudb, it is not
+// buffered
+var streamRoutes = map[string]bool{
+	"StreamSet":         true,
+	"StreamVerifiedSet": true,
+}
+
+// StreamHandler ...
+type StreamHandler interface {
+	StreamSet(w http.ResponseWriter, req *http.Request, pathParams map[string]string)
+	StreamVerifiedSet(w http.ResponseWriter, req *http.Request, pathParams map[string]string)
+	StreamVerifiedGet(w http.ResponseWriter, req *http.Request, pathParams map[string]string)
+}
+
+type streamHandler struct {
+	mux     *runtime.ServeMux
+	client  immugwclient.Client
+	runtime Runtime
+	json    json.JSON
+}
+
+// NewStreamHandler ...
+func NewStreamHandler(mux *runtime.ServeMux, client immugwclient.Client, rt Runtime, json json.JSON) StreamHandler {
+	return &streamHandler{
+		mux:     mux,
+		client:  client,
+		runtime: rt,
+		json:    json,
+	}
+}
+
+// StreamSet stores the octet stream body of the request as the value of the
+// key of the path, sending it to immudb in chunks
+func (h *streamHandler) StreamSet(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	h.set(w, req, pathParams, false)
+}
+
+// StreamVerifiedSet is StreamSet verifying the tx the value is stored in
+func (h *streamHandler) StreamVerifiedSet(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	h.set(w, req, pathParams, true)
+}
+
+func (h *streamHandler) set(w http.ResponseWriter, req *http.Request, pathParams map[string]string, verified bool) {
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	_, outboundMarshaler := h.runtime.MarshalerForRequest(h.mux, req)
+
+	rctx, err := h.runtime.AnnotateContext(ctx, h.mux, req)
+	if err != nil {
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, err)
+		return
+	}
+
+	databasename, key, err := streamParams(pathParams)
+	if err == nil {
+		err = checkStreamUpload(req)
+	}
+	if err != nil {
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, err)
+		return
+	}
+	client, err := clientFor(h.client, req, databasename)
+	if err != nil {
+		h.runtime.HTTPError(rctx, h.mux, outboundMarshaler, w, req, err)
+		return
+	}
+
+	// the value is hashed while it is sent, to be verified without reading
+	// it back
+	digest := newValueDigest()
+	kvs := []*stream.KeyValue{{
+		Key:   &stream.ValueSize{Content: bytes.NewReader(key), Size: len(key)},
+		Value: &stream.ValueSize{Content: &deferredEOFReader{r: io.TeeReader(req.Body, digest)}, Size: int(req.ContentLength)},
+	}}
+	var msg *schema.TxHeader
+	if verified {
+		vctx, span := startVerificationSpan(withStateProof(rctx), databasename, "StreamVerifiedSet")
+		msg, err = client.StreamSet(vctx, kvs)
+		if err == nil {
+			err = verifyStreamSet(vctx, client, key, msg.GetId(), digest)
+		}
+		endSpan(span, err)
+		if err != nil {
+			verificationsFromContext(req.Context()).failed(vctx, databasename, "StreamVerifiedSet", key, msg.GetId(), err)
+		} else {
+			verificationsFromContext(req.Context()).verified(databasename, "StreamVerifiedSet", key, msg.GetId(), stateProofFromContext(vctx).verifiedTx())
+		}
+	} else {
+		msg, err = client.StreamSet(rctx, kvs)
+	}
+	if err != nil {
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, mapSdkError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	newData, err := h.json.Marshal(msg)
+	if err != nil {
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, err)
+		return
+	}
+	if _, err := w.Write(newData); err != nil {
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, err)
+		return
+	}
+}
+
+// StreamVerifiedGet streams the value of the key of the path, at the atTx
+// query parameter if set, as it is received from immudb. The value can only
+// be verified once it has been sent, the outcome is sent in the trailers.
+func (h *streamHandler) StreamVerifiedGet(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	_, outboundMarshaler := h.runtime.MarshalerForRequest(h.mux, req)
+
+	rctx, err := h.runtime.AnnotateContext(ctx, h.mux, req)
+	if err != nil {
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, err)
+		return
+	}
+
+	databasename, key, err := streamParams(pathParams)
+	if err != nil {
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, err)
+		return
+	}
+	var atTx uint64
+	if s := req.URL.Query().Get("atTx"); s != "" {
+		if atTx, err = strconv.ParseUint(s, 10, 64); err != nil {
+			h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, status.Errorf(codes.InvalidArgument, "invalid parameter %s", "atTx"))
+			return
+		}
+	}
+	client, err := clientFor(h.client, req, databasename)
+	if err != nil {
+		h.runtime.HTTPError(rctx, h.mux, outboundMarshaler, w, req, err)
+		return
+	}
+
+	vctx, span := startVerificationSpan(withStateProof(rctx), databasename, "StreamVerifiedGet")
+	v, err := openVerifiedStream(vctx, client, key, atTx)
+	if err != nil {
+		endSpan(span, err)
+		verificationsFromContext(req.Context()).failed(vctx, databasename, "StreamVerifiedGet", key, atTx, err)
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, mapSdkError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(StreamTxHeader, strconv.FormatUint(v.tx(), 10))
+	w.Header().Add("Trailer", StreamVerifiedTrailer)
+	w.Header().Add("Trailer", StreamErrorTrailer)
+	w.WriteHeader(http.StatusOK)
+
+	err = v.copy(w)
+	if err == nil {
+		err = v.verify(vctx, client)
+	}
+	endSpan(span, err)
+	if err != nil {
+		verificationsFromContext(req.Context()).failed(vctx, databasename, "StreamVerifiedGet", key, v.tx(), err)
+		err = mapSdkError(err)
+		// the status has been sent already, the error is only recorded
+		if route := requestRouteFromContext(req.Context()); route != nil {
+			route.code = status.Code(err)
+			route.errored = true
+		}
+		w.Header().Set(StreamVerifiedTrailer, "false")
+		w.Header().Set(StreamErrorTrailer, string(newProblem(req, err).Code))
+		return
+	}
+	verificationsFromContext(req.Context()).verified(databasename, "StreamVerifiedGet", key, v.tx(), v.state.GetTxId())
+	w.Header().Set(StreamVerifiedTrailer, "true")
+}
+
+// streamParams returns the database and the key of the path of the stream
+// routes
+func streamParams(pathParams map[string]string) (string, []byte, error) {
+	databasename, ok := pathParams["databaseName"]
+	if !ok {
+		return "", nil, status.Errorf(codes.InvalidArgument, "missing parameter %s", "databaseName")
+	}
+	key := pathParams["key"]
+	if key == "" {
+		return "", nil, status.Errorf(codes.InvalidArgument, "missing parameter %s", "key")
+	}
+	return databasename, []byte(key), nil
+}
+
+// checkStreamUpload checks that req uploads an octet stream of known length,
+// which is sent to immudb ahead of the value
+func checkStreamUpload(req *http.Request) error {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/octet-stream" {
+		return ErrUnsupportedType
+	}
+	if req.ContentLength < 0 {
+		return ErrLengthRequired
+	}
+	return nil
+}
+
+// deferredEOFReader returns the io.EOF read along with the last bytes of r on
+// the next read, the immudb stream sender fails on any error without sending
+// the bytes read with it
+type deferredEOFReader struct {
+	r   io.Reader
+	eof bool
+}
+
+func (r *deferredEOFReader) Read(p []byte) (int, error) {
+	if r.eof {
+		return 0, io.EOF
+	}
+	n, err := r.r.Read(p)
+	if err == io.EOF && n > 0 {
+		r.eof = true
+		return n, nil
+	}
+	return n, err
+}
+
+// newValueDigest returns the hash of a value as it is stored, with its prefix
+func newValueDigest() hash.Hash {
+	h := sha256.New()
+	h.Write([]byte{database.PlainValuePrefix})
+	return h
+}
+
+// valueEntrySpec returns the entry spec of key whose value has the digest
+func valueEntrySpec(key []byte, md *store.KVMetadata, digest hash.Hash) *store.EntrySpec {
+	spec := &store.EntrySpec{
+		Key:              database.EncodeKey(key),
+		Metadata:         md,
+		IsValueTruncated: true,
+	}
+	copy(spec.HashValue[:], digest.Sum(nil))
+	return spec
+}
+
+// verifyStreamSet proves that the value of key, of which digest is the hash,
+// is stored without metadata in the tx txID
+func verifyStreamSet(ctx context.Context, client immuclient.ImmuClient, key []byte, txID uint64, digest hash.Hash) error {
+	// the state is read once the tx has been committed, so that it is not
+	// older than the tx
+	state, err := verifiedState(ctx, client)
+	if err != nil {
+		return err
+	}
+	return verifyTxEntry(ctx, client, state, txID, key, valueEntrySpec(key, nil, digest))
+}
+
+// verifiedStream is an entry whose value is streamed by immudb along with
+// the proofs of its inclusion in its tx and of the consistency of the tx with
+// a verified state. The value is hashed while it is read and the entry is
+// verified once the whole value has been read.
+type verifiedStream struct {
+	key            []byte
+	state          *schema.ImmutableState
+	entry          *schema.Entry
+	verifiableTx   *schema.VerifiableTx
+	inclusionProof *schema.InclusionProof
+	value          io.Reader
+	digest         hash.Hash
+}
+
+// openVerifiedStream requests the verifiable entry of key at atTx, proven
+// since the verified state of the server, and reads it up to its value
+func openVerifiedStream(ctx context.Context, client immuclient.ImmuClient, key []byte, atTx uint64) (*verifiedStream, error) {
+	state, err := verifiedState(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	gs, err := client.GetServiceClient().StreamVerifiableGet(ctx, &schema.VerifiableGetRequest{
+		KeyRequest:   &schema.KeyRequest{Key: key, AtTx: atTx},
+		ProveSinceTx: state.TxId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	f := stream.NewStreamServiceFactory(stream.DefaultChunkSize)
+	entryProto, verifiableTxProto, inclusionProofProto, vr, err := f.NewVEntryStreamReceiver(f.NewMsgReceiver(gs)).Next()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &verifiedStream{
+		key:            key,
+		state:          state,
+		entry:          &schema.Entry{},
+		verifiableTx:   &schema.VerifiableTx{},
+		inclusionProof: &schema.InclusionProof{},
+		value:          vr,
+		digest:         newValueDigest(),
+	}
+	if err := proto.Unmarshal(entryProto, v.entry); err != nil {
+		return nil, err
+	}
+	if err := proto.Unmarshal(verifiableTxProto, v.verifiableTx); err != nil {
+		return nil, err
+	}
+	if err := proto.Unmarshal(inclusionProofProto, v.inclusionProof); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// tx returns the tx the entry is proven in, the one of the reference if the
+// key is one
+func (v *verifiedStream) tx() uint64 {
+	if v.entry.ReferencedBy != nil {
+		return v.entry.ReferencedBy.Tx
+	}
+	return v.entry.Tx
+}
+
+// copy writes the value to w chunk by chunk, as it is received
+func (v *verifiedStream) copy(w io.Writer) error {
+	buf := make([]byte, stream.DefaultChunkSize)
+	for {
+		n, err := v.value.Read(buf)
+		if n > 0 {
+			v.digest.Write(buf[:n])
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		// the value ends with an empty read or with the stream
+		if err == io.EOF || err == nil && n == 0 {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// verify proves the consistency of the tx of the entry with the state the
+// stream was opened at, and the inclusion of the entry, with the hash of the
+// value read, in the tx. The proofs are the ones of the immudb client. When
+// the key is a reference, the entry it resolves to, with the hash of the
+// value read, is proven as well.
+//
+// The local state of the client is not advanced past the state the stream
+// was opened at, which verifiedState stored already: the newer txs are only
+// proven consistent with it by the immudb proofs the client does not check.
+func (v *verifiedStream) verify(ctx context.Context, client immuclient.ImmuClient) error {
+	e := v.entry
+	vTx := v.tx()
+	proof := v.verifiableTx.GetDualProof()
+	if proof.GetSourceTxHeader() == nil || proof.GetTargetTxHeader() == nil {
+		return &verificationError{kind: VerificationConsistency, key: v.key, tx: vTx, err: ErrCorruptedData}
+	}
+	dualProof := schema.DualProofFromProto(proof)
+
+	var hdr *store.TxHeader
+	var sourceID, targetID uint64
+	var sourceAlh, targetAlh [sha256.Size]byte
+	if v.state.TxId <= vTx {
+		hdr = dualProof.TargetTxHeader
+		sourceID, sourceAlh = v.state.TxId, schema.DigestFromProto(v.state.TxHash)
+		targetID, targetAlh = vTx, hdr.Alh()
+	} else {
+		hdr = dualProof.SourceTxHeader
+		sourceID, sourceAlh = vTx, hdr.Alh()
+		targetID, targetAlh = v.state.TxId, schema.DigestFromProto(v.state.TxHash)
+	}
+	if hdr.ID != vTx {
+		return &verificationError{kind: VerificationConsistency, key: v.key, tx: vTx, err: ErrCorruptedData}
+	}
+	if v.state.TxId > 0 {
+		err := schema.FillMissingLinearAdvanceProof(ctx, dualProof, sourceID, targetID, client.GetServiceClient())
+		if err != nil {
+			return err
+		}
+		if !store.VerifyDualProof(dualProof, sourceID, targetID, sourceAlh, targetAlh) {
+			return &verificationError{kind: VerificationConsistency, key: v.key, tx: vTx, err: ErrCorruptedData}
+		}
+	}
+
+	valueSpec := valueEntrySpec(e.Key, schema.KVMetadataFromProto(e.Metadata), v.digest)
+	entrySpec := valueSpec
+	if e.ReferencedBy != nil {
+		ref := e.ReferencedBy
+		entrySpec = database.EncodeReference(ref.Key, schema.KVMetadataFromProto(ref.Metadata), e.Key, ref.AtTx)
+	}
+	digest, err := entrySpecDigest(hdr.Version, entrySpec)
+	if err != nil {
+		return err
+	}
+	if !store.VerifyInclusion(schema.InclusionProofFromProto(v.inclusionProof), digest, hdr.Eh) {
+		return &verificationError{kind: VerificationInclusion, key: v.key, tx: vTx, err: ErrCorruptedData}
+	}
+	if e.ReferencedBy == nil {
+		return nil
+	}
+
+	// the referenced entry is proven against the newest state proven so
+	// far, or a newer verified one if it was written since
+	state := v.state
+	if vTx > state.TxId {
+		alh := dualProof.TargetTxHeader.Alh()
+		state = &schema.ImmutableState{TxId: vTx, TxHash: alh[:]}
+	}
+	if e.Tx > state.TxId {
+		if state, err = verifiedState(ctx, client); err != nil {
+			return err
+		}
+	}
+	return verifyTxEntry(ctx, client, state, e.Tx, v.key, valueSpec)
+}
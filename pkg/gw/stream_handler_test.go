@@ -0,0 +1,202 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	immuclient "github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/server"
+	"github.com/codenotary/immudb/pkg/server/servertest"
+	"github.com/codenotary/immugw/pkg/api"
+	immugwclient "github.com/codenotary/immugw/pkg/client"
+	gwjson "github.com/codenotary/immugw/pkg/json"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestStreamHandler(t *testing.T) {
+	bs := servertest.NewBufconnServer(server.DefaultOptions().WithAuth(false).WithDir(t.TempDir()))
+	bs.Start()
+	defer bs.Stop()
+
+	opts := immuclient.DefaultOptions().
+		WithDialOptions([]grpc.DialOption{grpc.WithContextDialer(bs.Dialer), grpc.WithInsecure()}).
+		WithAuth(false).
+		WithDir(t.TempDir())
+	client := immugwclient.New(opts)
+	_, err := client.Add("defaultdb")
+	require.NoError(t, err)
+
+	mux := runtime.NewServeMux(runtime.WithProtoErrorHandler(routeErrorHandler(problemErrorHandler)))
+	sth := NewStreamHandler(mux, client, newDefaultRuntime(), gwjson.DefaultJSON())
+	handleRoute(mux, "StreamSet", http.MethodPost, api.Pattern_ImmuService_StreamSet_0(), sth.StreamSet)
+	handleRoute(mux, "StreamVerifiedSet", http.MethodPost, api.Pattern_ImmuService_StreamVerifiedSet_0(), sth.StreamVerifiedSet)
+	handleRoute(mux, "StreamVerifiedGet", http.MethodGet, api.Pattern_ImmuService_StreamVerifiedGet_0(), sth.StreamVerifiedGet)
+
+	// the stream uploads are not limited by the size of the write bodies
+	limits := bodyLimits{RouteClassWrite: 1024, streamBodyLimit: 6 << 20}
+	srv := httptest.NewServer(limits.handler(mux))
+	defer srv.Close()
+
+	post := func(path string, contentType string, body io.Reader) (*http.Response, map[string]interface{}) {
+		resp, err := http.Post(srv.URL+path, contentType, body)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var m map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+		return resp, m
+	}
+	get := func(path string) (*http.Response, []byte) {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		bs, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, bs
+	}
+
+	// larger than the maximum message size of the immudb clients
+	value := make([]byte, 5<<20)
+	_, err = rand.Read(value)
+	require.NoError(t, err)
+
+	resp, body := post("/db/defaultdb/stream/verified/set/docs/report.bin", "application/octet-stream", bytes.NewReader(value))
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	id, ok := body["id"].(float64)
+	require.True(t, ok, body)
+	tx := strconv.FormatUint(uint64(id), 10)
+
+	resp, got := get("/db/defaultdb/stream/verified/get/docs/report.bin")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/octet-stream", resp.Header.Get("Content-Type"))
+	require.Equal(t, tx, resp.Header.Get(StreamTxHeader))
+	require.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	require.True(t, bytes.Equal(value, got))
+	require.Equal(t, "true", resp.Trailer.Get(StreamVerifiedTrailer))
+	require.Empty(t, resp.Trailer.Get(StreamErrorTrailer))
+
+	resp, body = post("/db/defaultdb/stream/set/docs/report.bin", "application/octet-stream", strings.NewReader("second"))
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+
+	resp, got = get("/db/defaultdb/stream/verified/get/docs/report.bin")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "second", string(got))
+	require.Equal(t, "true", resp.Trailer.Get(StreamVerifiedTrailer))
+
+	resp, got = get("/db/defaultdb/stream/verified/get/docs/report.bin?atTx=" + tx)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.True(t, bytes.Equal(value, got))
+	require.Equal(t, "true", resp.Trailer.Get(StreamVerifiedTrailer))
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		path   string
+		ctype  string
+		body   io.Reader
+		status int
+		code   ErrorCode
+	}{
+		{"chunked upload", http.MethodPost, "/db/defaultdb/stream/set/key1", "application/octet-stream", io.MultiReader(strings.NewReader("value")), http.StatusLengthRequired, CodeLengthRequired},
+		{"JSON upload", http.MethodPost, "/db/defaultdb/stream/set/key1", "application/json", strings.NewReader(`{"value":"dmFsdWU="}`), http.StatusUnsupportedMediaType, CodeUnsupportedType},
+		{"upload too large", http.MethodPost, "/db/defaultdb/stream/set/key1", "application/octet-stream", bytes.NewReader(make([]byte, 7<<20)), http.StatusRequestEntityTooLarge, CodeBodyTooLarge},
+		{"missing key", http.MethodGet, "/db/defaultdb/stream/verified/get/missing", "", nil, http.StatusNotFound, CodeKeyNotFound},
+		{"invalid tx", http.MethodGet, "/db/defaultdb/stream/verified/get/docs/report.bin?atTx=last", "", nil, http.StatusBadRequest, "INVALID_ARGUMENT"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, srv.URL+tc.path, tc.body)
+			require.NoError(t, err)
+			if tc.ctype != "" {
+				req.Header.Set("Content-Type", tc.ctype)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tc.status, resp.StatusCode)
+			require.Equal(t, ProblemContentType, resp.Header.Get("Content-Type"))
+			var p Problem
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+			require.Equal(t, tc.code, p.Code)
+		})
+	}
+}
+
+func TestVerifiedStreamTampered(t *testing.T) {
+	bs := servertest.NewBufconnServer(server.DefaultOptions().WithAuth(false).WithDir(t.TempDir()))
+	bs.Start()
+	defer bs.Stop()
+
+	opts := immuclient.DefaultOptions().
+		WithDialOptions([]grpc.DialOption{grpc.WithContextDialer(bs.Dialer), grpc.WithInsecure()}).
+		WithAuth(false).
+		WithDir(t.TempDir())
+	client := immugwclient.New(opts)
+	ic, err := client.Add("defaultdb")
+	require.NoError(t, err)
+
+	_, err = ic.Set(context.Background(), []byte("key1"), []byte("value1"))
+	require.NoError(t, err)
+
+	v, err := openVerifiedStream(context.Background(), ic, []byte("key1"), 0)
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, v.copy(&out))
+	require.Equal(t, "value1", out.String())
+	require.NoError(t, v.verify(context.Background(), ic))
+
+	// a value altered on its way fails the inclusion proof
+	v, err = openVerifiedStream(context.Background(), ic, []byte("key1"), 0)
+	require.NoError(t, err)
+	require.NoError(t, v.copy(io.Discard))
+	v.digest.Write([]byte("tampered"))
+	err = v.verify(context.Background(), ic)
+	var ve *verificationError
+	require.ErrorAs(t, err, &ve)
+	require.Equal(t, VerificationInclusion, ve.kind)
+	require.Equal(t, v.tx(), ve.tx)
+
+	// so does the value of the entry a reference resolves to
+	_, err = ic.SetReference(context.Background(), []byte("ref1"), []byte("key1"))
+	require.NoError(t, err)
+	v, err = openVerifiedStream(context.Background(), ic, []byte("ref1"), 0)
+	require.NoError(t, err)
+	out.Reset()
+	require.NoError(t, v.copy(&out))
+	require.Equal(t, "value1", out.String())
+	require.NoError(t, v.verify(context.Background(), ic))
+
+	v, err = openVerifiedStream(context.Background(), ic, []byte("ref1"), 0)
+	require.NoError(t, err)
+	require.NoError(t, v.copy(io.Discard))
+	v.digest.Write([]byte("tampered"))
+	err = v.verify(context.Background(), ic)
+	require.ErrorAs(t, err, &ve)
+	require.Equal(t, VerificationInclusion, ve.kind)
+	require.Equal(t, []byte("ref1"), ve.key)
+	require.Equal(t, uint64(1), ve.tx)
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// restTLSConfig returns the TLS configuration of the REST listener, nil when
+// the REST API is served in cleartext. Client certificates are required and
+// verified against TLSClientCAs when it is set.
+func restTLSConfig(o Options) (*tls.Config, error) {
+	if o.TLSCertificate == "" && o.TLSKey == "" {
+		if o.TLSClientCAs != "" {
+			return nil, ErrTLSCertificateNeeded
+		}
+		return nil, nil
+	}
+	if o.TLSCertificate == "" || o.TLSKey == "" {
+		return nil, ErrTLSKeyPairRequired
+	}
+
+	minVersion := uint16(tls.VersionTLS12)
+	if o.TLSMinVersion != "" {
+		v, ok := tlsVersions[o.TLSMinVersion]
+		if !ok {
+			return nil, ErrInvalidTLSMinVersion
+		}
+		minVersion = v
+	}
+
+	cert, err := tls.LoadX509KeyPair(o.TLSCertificate, o.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+	}
+
+	if o.TLSClientCAs != "" {
+		bs, err := os.ReadFile(o.TLSClientCAs)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bs) {
+			return nil, ErrInvalidTLSClientCAs
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+type clientCertSubjectKey struct{}
+
+// ClientCertSubjectFromContext returns the subject of the verified client
+// certificate of the request, if any
+func ClientCertSubjectFromContext(ctx context.Context) (string, bool) {
+	subject, ok := ctx.Value(clientCertSubjectKey{}).(string)
+	return subject, ok
+}
+
+// clientCertSubjectHandler adds the subject of the verified client
+// certificate to the request context
+func clientCertSubjectHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
+			subject := req.TLS.VerifiedChains[0][0].Subject.String()
+			req = req.WithContext(context.WithValue(req.Context(), clientCertSubjectKey{}, subject))
+		}
+		h.ServeHTTP(w, req)
+	})
+}
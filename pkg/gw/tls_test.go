@@ -0,0 +1,182 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCertificate struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// writeTestCertificate writes a certificate signed by parent, self signed
+// when parent is nil, and its private key in dir
+func writeTestCertificate(t *testing.T, dir string, name string, parent *testCertificate, template *x509.Certificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.Subject = pkix.Name{CommonName: name, Organization: []string{"immugw"}}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	tc := &testCertificate{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".cert.pem"),
+		keyFile:  filepath.Join(dir, name+".key.pem"),
+	}
+	require.NoError(t, os.WriteFile(tc.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(tc.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return tc
+}
+
+func writeTestCertificates(t *testing.T) (ca *testCertificate, srv *testCertificate, cli *testCertificate) {
+	dir := t.TempDir()
+	ca = writeTestCertificate(t, dir, "ca", nil, &x509.Certificate{
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	srv = writeTestCertificate(t, dir, "localhost", ca, &x509.Certificate{
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	cli = writeTestCertificate(t, dir, "client", ca, &x509.Certificate{
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return ca, srv, cli
+}
+
+func TestRestTLSConfig(t *testing.T) {
+	ca, srv, _ := writeTestCertificates(t)
+	opts := DefaultOptions()
+
+	config, err := restTLSConfig(opts)
+	require.NoError(t, err)
+	require.Nil(t, config)
+
+	_, err = restTLSConfig(opts.WithTLSCertificate(srv.certFile))
+	require.ErrorIs(t, err, ErrTLSKeyPairRequired)
+	_, err = restTLSConfig(opts.WithTLSKey(srv.keyFile))
+	require.ErrorIs(t, err, ErrTLSKeyPairRequired)
+	_, err = restTLSConfig(opts.WithTLSClientCAs(ca.certFile))
+	require.ErrorIs(t, err, ErrTLSCertificateNeeded)
+
+	opts = opts.WithTLSCertificate(srv.certFile).WithTLSKey(srv.keyFile)
+
+	config, err = restTLSConfig(opts)
+	require.NoError(t, err)
+	require.Len(t, config.Certificates, 1)
+	require.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	require.Equal(t, tls.NoClientCert, config.ClientAuth)
+
+	config, err = restTLSConfig(opts.WithTLSMinVersion("1.3"))
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+
+	_, err = restTLSConfig(opts.WithTLSMinVersion("2.0"))
+	require.ErrorIs(t, err, ErrInvalidTLSMinVersion)
+
+	_, err = restTLSConfig(opts.WithTLSKey(ca.keyFile))
+	require.Error(t, err)
+
+	config, err = restTLSConfig(opts.WithTLSClientCAs(ca.certFile))
+	require.NoError(t, err)
+	require.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+	require.NotNil(t, config.ClientCAs)
+
+	_, err = restTLSConfig(opts.WithTLSClientCAs(srv.keyFile))
+	require.ErrorIs(t, err, ErrInvalidTLSClientCAs)
+}
+
+func TestClientCertSubjectHandler(t *testing.T) {
+	ca, srv, cli := writeTestCertificates(t)
+
+	config, err := restTLSConfig(DefaultOptions().
+		WithTLSCertificate(srv.certFile).
+		WithTLSKey(srv.keyFile).
+		WithTLSClientCAs(ca.certFile))
+	require.NoError(t, err)
+
+	ts := httptest.NewUnstartedServer(clientCertSubjectHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		subject, ok := ClientCertSubjectFromContext(req.Context())
+		require.True(t, ok)
+		w.Write([]byte(subject))
+	})))
+	ts.TLS = config
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: certs,
+		}}}
+	}
+
+	clientCert, err := tls.LoadX509KeyPair(cli.certFile, cli.keyFile)
+	require.NoError(t, err)
+
+	resp, err := newClient(clientCert).Get(ts.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "CN=client,O=immugw", string(body))
+
+	// clients without a certificate are rejected during the handshake
+	_, err = newClient().Get(ts.URL)
+	require.Error(t, err)
+}
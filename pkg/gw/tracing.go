@@ -0,0 +1,265 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immudb/pkg/client/state"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// tracing exporters
+const (
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+	TracingExporterFile   = "file"
+)
+
+const tracerName = "github.com/codenotary/immugw/pkg/gw"
+
+// newTracerProvider returns the tracer provider configured by the tracing
+// options, or nil when tracing is disabled
+func newTracerProvider(o Options) (*sdktrace.TracerProvider, error) {
+	if o.TracingExporter == "" {
+		return nil, nil
+	}
+	if o.TracingSampleRatio < 0 || o.TracingSampleRatio > 1 {
+		return nil, ErrInvalidTracingSampleRatio
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch o.TracingExporter {
+	case TracingExporterOTLP:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(o.TracingEndpoint)}
+		if o.TracingInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(context.Background(), opts...)
+	case TracingExporterStdout:
+		exporter, err = stdouttrace.New()
+	case TracingExporterFile:
+		exporter, err = newFileSpanExporter(o.TracingFile)
+	default:
+		return nil, ErrInvalidTracingExporter
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("immugw"))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.TracingSampleRatio))),
+	), nil
+}
+
+// fileSpanExporter writes the spans as JSON to a file, which is closed with
+// the exporter
+type fileSpanExporter struct {
+	*stdouttrace.Exporter
+	f *os.File
+}
+
+func newFileSpanExporter(name string) (*fileSpanExporter, error) {
+	if name == "" {
+		return nil, ErrTracingFileRequired
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileSpanExporter{Exporter: exporter, f: f}, nil
+}
+
+func (e *fileSpanExporter) Shutdown(ctx context.Context) error {
+	err := e.Exporter.Shutdown(ctx)
+	if cerr := e.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// installTracing makes tp the tracer provider of the gateway, and W3C trace
+// context the propagation format of the traces
+func installTracing(tp trace.TracerProvider) {
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// shutdownTracing flushes the pending spans and disables tracing
+func (s *ImmuGwServer) shutdownTracing(tp *sdktrace.TracerProvider) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Options.ShutdownTimeout)
+	defer cancel()
+	if err := tp.Shutdown(ctx); err != nil {
+		s.Logger.Warningf("unable to flush traces: %s", err)
+	}
+	otel.SetTracerProvider(trace.NewNoopTracerProvider())
+}
+
+// tracingDialOptions returns opts with the interceptors propagating the
+// trace context to immudb
+func tracingDialOptions(opts []grpc.DialOption) []grpc.DialOption {
+	return append(opts[:len(opts):len(opts)],
+		grpc.WithChainUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(otelgrpc.StreamClientInterceptor()),
+	)
+}
+
+// startSpan starts a span of the gateway tracer, a no-op one unless tracing
+// is enabled
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// startVerificationSpan starts the span of the verification of operation on
+// database, which covers the proofs requested to immudb and their checks
+func startVerificationSpan(ctx context.Context, database string, operation string) (context.Context, trace.Span) {
+	return startSpan(ctx, "verify "+operation, semconv.DBName(database))
+}
+
+// endSpan ends span, recording err if any
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracingHandler starts a span for every request served by h, continuing
+// the trace of the W3C trace context headers of the request. The span is
+// named after the route matched by the request.
+func tracingHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := otel.Tracer(tracerName).Start(ctx, req.Method+" "+unmatchedRoute,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPMethod(req.Method)),
+		)
+		defer span.End()
+
+		rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rw, req.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPStatusCode(rw.status))
+		if route := requestRouteFromContext(ctx); route != nil && route.Pattern != "" {
+			span.SetName(req.Method + " " + route.Pattern)
+			span.SetAttributes(semconv.HTTPRoute(route.Pattern), semconv.DBName(route.Database))
+		}
+		if rw.status >= http.StatusInternalServerError {
+			span.SetStatus(otelcodes.Error, http.StatusText(rw.status))
+		}
+	})
+}
+
+// tracedStateService records a span for every read and write of the state
+// of a database. SetState takes no context, so its span is a child of the
+// context of the GetState call made by the holder of the cache lock, which
+// every verified call of the immudb client takes around both. The lock is
+// also taken in process so that the lock windows of concurrent requests
+// never overlap, whatever the cache.
+type tracedStateService struct {
+	state.StateService
+	lock sync.Mutex
+
+	mu     sync.Mutex
+	locked bool
+	ctx    context.Context
+}
+
+func newTracedStateService(db string, s state.StateService) state.StateService {
+	return &tracedStateService{StateService: s}
+}
+
+func (s *tracedStateService) CacheLock() error {
+	s.lock.Lock()
+	if err := s.StateService.CacheLock(); err != nil {
+		s.lock.Unlock()
+		return err
+	}
+	s.mu.Lock()
+	s.locked = true
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *tracedStateService) GetState(ctx context.Context, db string) (*schema.ImmutableState, error) {
+	sctx, span := startSpan(ctx, "state get", semconv.DBName(db))
+	st, err := s.StateService.GetState(sctx, db)
+	endSpan(span, err)
+
+	// the reads outside of a lock window are not followed by a write
+	s.mu.Lock()
+	if s.locked && s.ctx == nil {
+		s.ctx = ctx
+	}
+	s.mu.Unlock()
+	return st, err
+}
+
+func (s *tracedStateService) SetState(db string, st *schema.ImmutableState) error {
+	s.mu.Lock()
+	ctx := s.ctx
+	s.mu.Unlock()
+	if ctx == nil {
+		return s.StateService.SetState(db, st)
+	}
+
+	_, span := startSpan(ctx, "state set", semconv.DBName(db), attribute.Int64("immudb.tx", int64(st.GetTxId())))
+	err := s.StateService.SetState(db, st)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracedStateService) CacheUnlock() error {
+	s.mu.Lock()
+	if !s.locked {
+		s.mu.Unlock()
+		return s.StateService.CacheUnlock()
+	}
+	s.locked = false
+	s.ctx = nil
+	s.mu.Unlock()
+	defer s.lock.Unlock()
+	return s.StateService.CacheUnlock()
+}
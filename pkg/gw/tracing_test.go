@@ -0,0 +1,197 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immudb/pkg/client/state"
+	"github.com/codenotary/immugw/pkg/api"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// withTestTracing records the spans of the test in memory
+func withTestTracing(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	installTracing(tp)
+	t.Cleanup(func() {
+		tp.Shutdown(context.Background())
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	})
+	return exporter
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	tp, err := newTracerProvider(DefaultOptions())
+	require.NoError(t, err)
+	require.Nil(t, tp)
+
+	_, err = newTracerProvider(DefaultOptions().WithTracingExporter("zipkin"))
+	require.ErrorIs(t, err, ErrInvalidTracingExporter)
+
+	_, err = newTracerProvider(DefaultOptions().WithTracingExporter(TracingExporterFile))
+	require.ErrorIs(t, err, ErrTracingFileRequired)
+
+	_, err = newTracerProvider(DefaultOptions().WithTracingExporter(TracingExporterStdout).WithTracingSampleRatio(1.5))
+	require.ErrorIs(t, err, ErrInvalidTracingSampleRatio)
+
+	file := filepath.Join(t.TempDir(), "traces", "immugw.json")
+	tp, err = newTracerProvider(DefaultOptions().WithTracingExporter(TracingExporterFile).WithTracingFile(file))
+	require.NoError(t, err)
+	_, span := tp.Tracer(tracerName).Start(context.Background(), "test span")
+	span.End()
+	require.NoError(t, tp.Shutdown(context.Background()))
+
+	bs, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Contains(t, string(bs), `"Name":"test span"`)
+}
+
+func TestTracingHandler(t *testing.T) {
+	exporter := withTestTracing(t)
+
+	mux := runtime.NewServeMux()
+	handleRoute(mux, "VerifiedGet", http.MethodPost, api.Pattern_ImmuService_VerifiedGet_0(), func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		_, span := startVerificationSpan(req.Context(), pathParams["databaseName"], "VerifiedGet")
+		endSpan(span, ErrCorruptedData)
+		w.WriteHeader(http.StatusConflict)
+	})
+	handler := newRequestMetrics(prometheus.NewRegistry()).handler(tracingHandler(mux))
+
+	req, err := http.NewRequest(http.MethodPost, "/db/db1/verified/get", strings.NewReader("{}"))
+	require.NoError(t, err)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusConflict, rr.Code)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+
+	verification, request := spans[0], spans[1]
+	require.Equal(t, "verify VerifiedGet", verification.Name)
+	require.Equal(t, request.SpanContext.SpanID(), verification.Parent.SpanID())
+	require.Len(t, verification.Events, 1)
+
+	require.Equal(t, "POST /db/{databaseName=*}/verified/get", request.Name)
+	require.Equal(t, trace.SpanKindServer, request.SpanKind)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", request.SpanContext.TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", request.Parent.SpanID().String())
+	require.True(t, request.Parent.IsRemote())
+}
+
+func TestTracedStateService(t *testing.T) {
+	exporter := withTestTracing(t)
+
+	var ss state.StateService = newTracedStateService("db1", &stateServiceMock{})
+	ctx, span := startSpan(context.Background(), "request")
+	otherCtx, otherSpan := startSpan(context.Background(), "other request")
+
+	// reads outside of a lock window, as the ones of other requests, don't
+	// parent the writes
+	_, err := ss.GetState(otherCtx, "db1")
+	require.NoError(t, err)
+	require.NoError(t, ss.CacheLock())
+	_, err = ss.GetState(ctx, "db1")
+	require.NoError(t, err)
+	require.NoError(t, ss.SetState("db1", &schema.ImmutableState{TxId: 3}))
+	require.NoError(t, ss.CacheUnlock())
+	// writes not preceded by a read under the same lock are not traced
+	require.NoError(t, ss.SetState("db1", &schema.ImmutableState{TxId: 4}))
+	require.NoError(t, ss.CacheLock())
+	require.NoError(t, ss.SetState("db1", &schema.ImmutableState{TxId: 5}))
+	require.NoError(t, ss.CacheUnlock())
+	span.End()
+	otherSpan.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 5)
+	require.Equal(t, "state get", spans[0].Name)
+	require.Equal(t, otherSpan.SpanContext().SpanID(), spans[0].Parent.SpanID())
+	require.Equal(t, "state get", spans[1].Name)
+	require.Equal(t, "state set", spans[2].Name)
+	for _, s := range spans[1:3] {
+		require.Equal(t, span.SpanContext().SpanID(), s.Parent.SpanID())
+	}
+}
+
+func TestTracedStateServiceLock(t *testing.T) {
+	ss := newTracedStateService("db1", &stateServiceMock{})
+	require.NoError(t, ss.CacheLock())
+
+	// the lock windows of concurrent requests don't overlap
+	locked := make(chan struct{})
+	go func() {
+		ss.CacheLock()
+		close(locked)
+		ss.CacheUnlock()
+	}()
+	select {
+	case <-locked:
+		t.Fatal("cache locked twice")
+	case <-time.After(10 * time.Millisecond):
+	}
+	require.NoError(t, ss.CacheUnlock())
+	<-locked
+}
+
+func TestTracingDialOptions(t *testing.T) {
+	opts := make([]grpc.DialOption, 1, 4)
+	opts[0] = grpc.WithBlock()
+
+	traced := tracingDialOptions(opts)
+	require.Len(t, traced, 3)
+	require.Len(t, opts, 1)
+
+	// the interceptors are not appended to the backing array of opts
+	require.NotSame(t, &opts[0], &traced[0])
+}
+
+type stateServiceMock struct {
+	state.StateService
+}
+
+func (m *stateServiceMock) GetState(ctx context.Context, db string) (*schema.ImmutableState, error) {
+	return &schema.ImmutableState{Db: db}, nil
+}
+
+func (m *stateServiceMock) SetState(db string, st *schema.ImmutableState) error {
+	return nil
+}
+
+func (m *stateServiceMock) CacheLock() error {
+	return nil
+}
+
+func (m *stateServiceMock) CacheUnlock() error {
+	return nil
+}
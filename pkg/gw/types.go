@@ -18,6 +18,7 @@ package gw
 
 import (
 	"os"
+	"sync"
 	"time"
 
 	"github.com/codenotary/immudb/pkg/client"
@@ -35,6 +36,8 @@ type ImmuGw interface {
 	WithLogger(logger.Logger) ImmuGw
 	WithOptions(Options) ImmuGw
 	WithCliOptions(client.Options) ImmuGw
+	WithOptionsLoader(OptionsLoader) ImmuGw
+	Reload() error
 }
 
 // ImmuGwServer ...
@@ -47,6 +50,14 @@ type ImmuGwServer struct {
 	Pid          server.PIDFile
 	Client       schema.ImmuServiceClient
 	MetricServer *metricServer
+
+	optionsLoader OptionsLoader
+	reloadMu      sync.Mutex
+	logger        *reloadableLogger
+	auditor       *auditor
+	policies      *policies
+	rateLimiter   *rateLimiter
+	cors          *corsHandler
 }
 
 // DefaultServer returns a default immudb gateway server
@@ -67,9 +78,11 @@ func (c *ImmuGwServer) WithClient(client schema.ImmuServiceClient) ImmuGw {
 	return c
 }
 
-// WithLogger ...
+// WithLogger sets the logger of the server, replaced when the log settings
+// are reloaded
 func (c *ImmuGwServer) WithLogger(logger logger.Logger) ImmuGw {
-	c.Logger = logger
+	c.logger = newReloadableLogger(logger)
+	c.Logger = c.logger
 	return c
 }
 
@@ -42,6 +42,8 @@ func TestTypes(t *testing.T) {
 	server.Logger = nil
 	server.WithLogger(slogger)
 	require.NotNil(t, server.Logger)
+	// the logger is kept across the reloads of the log settings
+	require.Equal(t, server.logger, server.Logger)
 
 	server.WithOptions(defaultOptions.WithPort(1111))
 	require.Equal(t, 1111, server.Options.Port)
@@ -80,14 +80,14 @@ func (h *useDatabaseHandler) UseDatabase(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	client, err = h.client.For(databasename)
-	if err == immugwclient.ErrDatabaseNotFound {
-		var err error
-		client, err = h.client.Add(databasename)
-		if err != nil {
-			h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, mapSdkError(err))
-			return
-		}
+	if _, err := h.client.Add(databasename); err != nil {
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, mapSdkError(err))
+		return
+	}
+	client, err = clientFor(h.client, req, databasename)
+	if err != nil {
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, mapSdkError(err))
+		return
 	}
 
 	msg, err := client.UseDatabase(rctx, &schema.Database{DatabaseName: databasename})
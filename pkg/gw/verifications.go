@@ -0,0 +1,287 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/codenotary/immugw/pkg/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// kinds of verification failures
+const (
+	VerificationInclusion   = "inclusion"
+	VerificationConsistency = "consistency"
+	VerificationSignature   = "signature"
+	VerificationUnknown     = "unknown"
+)
+
+const (
+	verificationEventsSize         = 512
+	verificationEventsDefaultLimit = 100
+)
+
+// verificationError is a failed proof with the entry it failed for. The kind
+// is empty when the failed proof is not known.
+type verificationError struct {
+	kind string
+	key  []byte
+	tx   uint64
+	err  error
+}
+
+func (e *verificationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *verificationError) Unwrap() error {
+	return e.err
+}
+
+// VerificationEvent is the outcome of the verification of a REST request
+type VerificationEvent struct {
+	Time      time.Time `json:"time"`
+	Database  string    `json:"database"`
+	Operation string    `json:"operation"`
+	Key       []byte    `json:"key,omitempty"`
+	Tx        uint64    `json:"tx,omitempty"`
+	Verified  bool      `json:"verified"`
+	Failure   string    `json:"failure,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	// StateTx is the latest verified tx of the database after the event
+	StateTx       uint64 `json:"stateTx,omitempty"`
+	StateAdvanced bool   `json:"stateAdvanced,omitempty"`
+}
+
+// verifications counts the verification outcomes of the REST requests and
+// keeps the most recent ones in memory
+type verifications struct {
+	mu      sync.Mutex
+	events  []VerificationEvent
+	next    int
+	stateTx map[string]uint64
+
+	Verified      *prometheus.CounterVec
+	Failed        *prometheus.CounterVec
+	StateAdvances *prometheus.CounterVec
+	StateTx       *prometheus.GaugeVec
+}
+
+func newVerifications(reg *prometheus.Registry, size int) *verifications {
+	return &verifications{
+		events:  make([]VerificationEvent, 0, size),
+		stateTx: make(map[string]uint64),
+		Verified: promauto.With(reg).NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "verifications_total",
+				Help:      "Number of successful verifications of REST requests.",
+			},
+			[]string{"database", "operation"},
+		),
+		Failed: promauto.With(reg).NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "verification_failures_total",
+				Help:      "Number of failed verifications of REST requests by kind (inclusion, consistency, signature).",
+			},
+			[]string{"database", "operation", "kind"},
+		),
+		StateAdvances: promauto.With(reg).NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "state_advances_total",
+				Help:      "Number of times the verified state of a database advanced.",
+			},
+			[]string{"database"},
+		),
+		StateTx: promauto.With(reg).NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "verified_state_tx",
+				Help:      "Latest verified tx of a database.",
+			},
+			[]string{"database"},
+		),
+	}
+}
+
+type verificationsKey struct{}
+
+// handler makes v available to the requests served by h
+func (v *verifications) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), verificationsKey{}, v)))
+	})
+}
+
+// verificationsFromContext returns the verifications of the request, nil
+// verifications record nothing
+func verificationsFromContext(ctx context.Context) *verifications {
+	v, _ := ctx.Value(verificationsKey{}).(*verifications)
+	return v
+}
+
+// verified records the successful verification of key at tx of database
+// against its state at stateTx, 0 if that state is not known
+func (v *verifications) verified(database string, operation string, key []byte, tx uint64, stateTx uint64) {
+	if v == nil {
+		return
+	}
+	v.Verified.WithLabelValues(database, operation).Inc()
+	v.add(VerificationEvent{
+		Database:  database,
+		Operation: operation,
+		Key:       key,
+		Tx:        tx,
+		Verified:  true,
+	}, stateTx)
+}
+
+// failed records err when it is a verification failure of key at tx of
+// database, other errors are ignored. The failures of the immudb client are
+// told apart with the state proof of ctx.
+func (v *verifications) failed(ctx context.Context, database string, operation string, key []byte, tx uint64, err error) {
+	if v == nil {
+		return
+	}
+	kind, ok := verificationFailure(err)
+	if !ok {
+		return
+	}
+	if kind == VerificationUnknown {
+		kind = stateProofFromContext(ctx).failure()
+	}
+	var ve *verificationError
+	if errors.As(err, &ve) && (ve.key != nil || ve.tx != 0) {
+		key, tx = ve.key, ve.tx
+	}
+	v.Failed.WithLabelValues(database, operation, kind).Inc()
+	v.add(VerificationEvent{
+		Database:  database,
+		Operation: operation,
+		Key:       key,
+		Tx:        tx,
+		Failure:   kind,
+		Error:     err.Error(),
+	}, 0)
+}
+
+// verificationFailure returns the kind of the verification failure err, if
+// err is one. The immudb client reports every failed proof as corrupted data,
+// so its failures are of unknown kind until told apart by their state proof.
+func verificationFailure(err error) (string, bool) {
+	var ve *verificationError
+	if errors.As(err, &ve) && ve.kind != "" {
+		return ve.kind, true
+	}
+	switch mapSdkError(err) {
+	case ErrInvalidStateSignature:
+		return VerificationSignature, true
+	case ErrCorruptedData:
+		return VerificationUnknown, true
+	}
+	return "", false
+}
+
+// add appends e to the ring, advancing the verified state of the database
+// when e verified it at a newer stateTx
+func (v *verifications) add(e VerificationEvent, stateTx uint64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	e.Time = time.Now().UTC()
+	if e.Verified && stateTx > v.stateTx[e.Database] {
+		v.stateTx[e.Database] = stateTx
+		e.StateAdvanced = true
+		v.StateAdvances.WithLabelValues(e.Database).Inc()
+		v.StateTx.WithLabelValues(e.Database).Set(float64(stateTx))
+	}
+	e.StateTx = v.stateTx[e.Database]
+
+	if len(v.events) < cap(v.events) {
+		v.events = append(v.events, e)
+		return
+	}
+	v.events[v.next] = e
+	v.next = (v.next + 1) % len(v.events)
+}
+
+// recent returns up to limit events matching database and outcome, the
+// newest first
+func (v *verifications) recent(database string, outcome string, limit int) []VerificationEvent {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	events := []VerificationEvent{}
+	for i := 0; i < len(v.events) && len(events) < limit; i++ {
+		// the newest event is the one before next
+		e := v.events[(v.next-1-i+2*len(v.events))%len(v.events)]
+		if database != "" && e.Database != database {
+			continue
+		}
+		if outcome == "verified" && !e.Verified || outcome == "failed" && e.Verified {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// recentVerificationsHandler serves the most recent verification events,
+// optionally filtered by database and outcome (verified or failed)
+func recentVerificationsHandler(v *verifications, json json.JSON) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		values := req.URL.Query()
+		outcome := values.Get("outcome")
+		if outcome != "" && outcome != "verified" && outcome != "failed" {
+			http.Error(w, "invalid outcome, allowed values are verified and failed", http.StatusBadRequest)
+			return
+		}
+		limit := verificationEventsDefaultLimit
+		if l := values.Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n <= 0 {
+				http.Error(w, fmt.Sprintf("invalid limit: %s", l), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		bs, err := json.Marshal(v.recent(values.Get("database"), outcome, limit))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("internal error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bs)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/codenotary/immudb/embedded/store"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/client/clienttest"
+	"github.com/codenotary/immudb/pkg/signer"
+	immugwclient "github.com/codenotary/immugw/pkg/client"
+	immugwjson "github.com/codenotary/immugw/pkg/json"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifications(t *testing.T) {
+	v := newVerifications(prometheus.NewRegistry(), 3)
+
+	// the state advances with the state the entries are verified against
+	v.verified("db1", "VerifiedGet", []byte("key1"), 2, 5)
+	v.verified("db1", "VerifiedGet", []byte("key1"), 3, 4)
+	require.Equal(t, float64(2), testutil.ToFloat64(v.Verified.WithLabelValues("db1", "VerifiedGet")))
+	require.Equal(t, float64(1), testutil.ToFloat64(v.StateAdvances.WithLabelValues("db1")))
+	require.Equal(t, float64(5), testutil.ToFloat64(v.StateTx.WithLabelValues("db1")))
+
+	events := v.recent("", "", 10)
+	require.Len(t, events, 2)
+	require.Equal(t, uint64(3), events[0].Tx)
+	require.False(t, events[0].StateAdvanced)
+	require.Equal(t, uint64(5), events[0].StateTx)
+	require.True(t, events[1].StateAdvanced)
+	require.Equal(t, uint64(2), events[1].Tx)
+
+	// errors other than verification failures are not recorded
+	v.failed(context.Background(), "db1", "VerifiedGet", []byte("key2"), 0, errors.New("connection refused"))
+	require.Len(t, v.recent("", "", 10), 2)
+
+	v.failed(context.Background(), "db2", "VerifiedScan", nil, 0, &verificationError{kind: VerificationInclusion, key: []byte("key3"), tx: 7, err: ErrCorruptedData})
+	require.Equal(t, float64(1), testutil.ToFloat64(v.Failed.WithLabelValues("db2", "VerifiedScan", VerificationInclusion)))
+
+	// the oldest event is dropped once the ring is full
+	v.failed(context.Background(), "db2", "VerifiedGet", []byte("key4"), 0, signer.ErrKeyCannotBeVerified)
+	require.Equal(t, float64(1), testutil.ToFloat64(v.Failed.WithLabelValues("db2", "VerifiedGet", VerificationSignature)))
+
+	events = v.recent("", "", 10)
+	require.Len(t, events, 3)
+	require.Equal(t, []byte("key4"), events[0].Key)
+	require.Equal(t, VerificationSignature, events[0].Failure)
+	require.Equal(t, []byte("key3"), events[1].Key)
+	require.Equal(t, uint64(7), events[1].Tx)
+	require.Equal(t, uint64(3), events[2].Tx)
+
+	require.Len(t, v.recent("db2", "", 10), 2)
+	require.Len(t, v.recent("", "verified", 10), 1)
+	require.Len(t, v.recent("", "failed", 1), 1)
+}
+
+func TestVerificationFailure(t *testing.T) {
+	_, ok := verificationFailure(ErrKeyNotFound)
+	require.False(t, ok)
+
+	kind, ok := verificationFailure(ErrInvalidStateSignature)
+	require.True(t, ok)
+	require.Equal(t, VerificationSignature, kind)
+
+	kind, ok = verificationFailure(&verificationError{kind: VerificationConsistency, tx: 3, err: ErrCorruptedData})
+	require.True(t, ok)
+	require.Equal(t, VerificationConsistency, kind)
+
+	// the failed proof is not known from the errors of the immudb client
+	kind, ok = verificationFailure(store.ErrCorruptedData)
+	require.True(t, ok)
+	require.Equal(t, VerificationUnknown, kind)
+
+	kind, ok = verificationFailure(&verificationError{key: []byte("key1"), tx: 3, err: store.ErrCorruptedData})
+	require.True(t, ok)
+	require.Equal(t, VerificationUnknown, kind)
+}
+
+func TestVerifiedGetHandlerVerifications(t *testing.T) {
+	v := newVerifications(prometheus.NewRegistry(), verificationEventsSize)
+	corrupted := false
+	cli := &clienttest.ImmuClientMock{
+		VerifiedGetAtF: func(ctx context.Context, key []byte, tx uint64) (*schema.Entry, error) {
+			// as recorded by the client when its dual proof is consistent
+			p := stateProofFromContext(ctx)
+			p.checked, p.consistent, p.targetTx = true, true, 6
+			if corrupted {
+				return nil, store.ErrCorruptedData
+			}
+			return &schema.Entry{Key: key, Tx: 4}, nil
+		},
+		CurrentStateF: func(context.Context) (*schema.ImmutableState, error) {
+			panic("the failures are classified without calling immudb")
+		},
+	}
+	mux := runtime.NewServeMux()
+	h := NewVerifiedGetHandler(mux, immugwclient.NewMockClient(cli, client.DefaultOptions()), DefaultRuntime(), immugwjson.DefaultJSON())
+	handler := v.handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.VerifiedGet(w, req, defaultTestParams)
+	}))
+
+	serve := func() int {
+		req, err := http.NewRequest(http.MethodPost, "/db/defaultdb/verified/get", strings.NewReader(`{"keyRequest":{"key":"a2V5MQ=="}}`))
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	require.Equal(t, http.StatusOK, serve())
+	corrupted = true
+	require.Equal(t, http.StatusConflict, serve())
+
+	require.Equal(t, float64(1), testutil.ToFloat64(v.Verified.WithLabelValues("defaultdb", "VerifiedGet")))
+	require.Equal(t, float64(1), testutil.ToFloat64(v.Failed.WithLabelValues("defaultdb", "VerifiedGet", VerificationInclusion)))
+	require.Equal(t, float64(1), testutil.ToFloat64(v.StateAdvances.WithLabelValues("defaultdb")))
+	require.Equal(t, float64(6), testutil.ToFloat64(v.StateTx.WithLabelValues("defaultdb")))
+
+	// the recent events are served newest first
+	req, err := http.NewRequest(http.MethodGet, "/verifications/recent?outcome=failed", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(recentVerificationsHandler(v, immugwjson.DefaultJSON())).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var events []VerificationEvent
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &events))
+	require.Len(t, events, 1)
+	require.Equal(t, "defaultdb", events[0].Database)
+	require.Equal(t, []byte("key1"), events[0].Key)
+	require.Equal(t, VerificationInclusion, events[0].Failure)
+	require.Equal(t, uint64(6), events[0].StateTx)
+
+	for _, url := range []string{"/verifications/recent?outcome=other", "/verifications/recent?limit=0"} {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(recentVerificationsHandler(v, immugwjson.DefaultJSON())).ServeHTTP(rr, req)
+		require.Equal(t, http.StatusBadRequest, rr.Code, url)
+	}
+}
@@ -70,7 +70,7 @@ func (h *verifiedGetHandler) VerifiedGet(w http.ResponseWriter, req *http.Reques
 		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, status.Errorf(codes.InvalidArgument, "missing parameter %s", "databaseName"))
 		return
 	}
-	client, err := h.client.For(databasename)
+	client, err := clientFor(h.client, req, databasename)
 	if err != nil {
 		h.runtime.HTTPError(rctx, h.mux, outboundMarshaler, w, req, err)
 		return
@@ -89,12 +89,20 @@ func (h *verifiedGetHandler) VerifiedGet(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	msg, err := client.VerifiedGetAt(rctx, protoReq.KeyRequest.Key, protoReq.KeyRequest.AtTx)
+	vctx, span := startVerificationSpan(withStateProof(rctx), databasename, "VerifiedGet")
+	msg, err := client.VerifiedGetAt(vctx, protoReq.KeyRequest.Key, protoReq.KeyRequest.AtTx)
+	endSpan(span, err)
 	ctx = h.runtime.NewServerMetadataContext(ctx, metadata)
 	if err != nil {
+		verificationsFromContext(req.Context()).failed(vctx, databasename, "VerifiedGet", protoReq.KeyRequest.Key, protoReq.KeyRequest.AtTx, err)
 		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, mapSdkError(err))
 		return
 	}
+	verifiedTx := msg.GetTx()
+	if msg.GetReferencedBy() != nil {
+		verifiedTx = msg.GetReferencedBy().GetTx()
+	}
+	verificationsFromContext(req.Context()).verified(databasename, "VerifiedGet", protoReq.KeyRequest.Key, verifiedTx, stateProofFromContext(vctx).verifiedTx())
 
 	w.Header().Set("Content-Type", "application/json")
 	newData, err := h.json.Marshal(msg)
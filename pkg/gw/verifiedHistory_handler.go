@@ -0,0 +1,119 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/codenotary/immugw/pkg/api"
+	immugwclient "github.com/codenotary/immugw/pkg/client"
+	"github.com/codenotary/immugw/pkg/json"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/utilities"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// VerifiedHistoryHandler ...
+type VerifiedHistoryHandler interface {
+	VerifiedHistory(w http.ResponseWriter, req *http.Request, pathParams map[string]string)
+}
+
+type verifiedHistoryHandler struct {
+	mux     *runtime.ServeMux
+	client  immugwclient.Client
+	runtime Runtime
+	json    json.JSON
+}
+
+// NewVerifiedHistoryHandler ...
+func NewVerifiedHistoryHandler(mux *runtime.ServeMux, client immugwclient.Client, rt Runtime, json json.JSON) VerifiedHistoryHandler {
+	return &verifiedHistoryHandler{
+		mux:     mux,
+		client:  client,
+		runtime: rt,
+		json:    json,
+	}
+}
+
+func (h *verifiedHistoryHandler) VerifiedHistory(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	inboundMarshaler, outboundMarshaler := h.runtime.MarshalerForRequest(h.mux, req)
+	rctx, err := h.runtime.AnnotateContext(ctx, h.mux, req)
+	if err != nil {
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, err)
+		return
+	}
+
+	databasename, ok := pathParams["databaseName"]
+	if !ok {
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, status.Errorf(codes.InvalidArgument, "missing parameter %s", "databaseName"))
+		return
+	}
+	client, err := clientFor(h.client, req, databasename)
+	if err != nil {
+		h.runtime.HTTPError(rctx, h.mux, outboundMarshaler, w, req, err)
+		return
+	}
+
+	var protoReq schema.HistoryRequest
+	var metadata runtime.ServerMetadata
+
+	newReader, berr := utilities.IOReaderFactory(req.Body)
+	if berr != nil {
+		h.runtime.HTTPError(rctx, h.mux, outboundMarshaler, w, req, status.Errorf(codes.InvalidArgument, "%v", berr))
+		return
+	}
+	if err = inboundMarshaler.NewDecoder(newReader()).Decode(&protoReq); err != nil && err != io.EOF {
+		h.runtime.HTTPError(rctx, h.mux, outboundMarshaler, w, req, status.Errorf(codes.InvalidArgument, "%v", err))
+		return
+	}
+
+	entries, err := client.History(rctx, &protoReq)
+	ctx = h.runtime.NewServerMetadataContext(ctx, metadata)
+	if err != nil {
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, mapSdkError(err))
+		return
+	}
+
+	// the state is fetched after the history so that it covers every returned revision
+	vctx, span := startVerificationSpan(withStateProof(rctx), databasename, "VerifiedHistory")
+	state, err := verifyEntries(vctx, client, entries.Entries)
+	endSpan(span, err)
+	if err != nil {
+		verificationsFromContext(req.Context()).failed(vctx, databasename, "VerifiedHistory", nil, 0, err)
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, mapSdkError(err))
+		return
+	}
+	verificationsFromContext(req.Context()).verified(databasename, "VerifiedHistory", nil, state.GetTxId(), state.GetTxId())
+
+	w.Header().Set("Content-Type", "application/json")
+	newData, err := h.json.Marshal(&api.VerifiedEntries{Entries: entries.Entries, VerifiedState: state})
+	if err != nil {
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, err)
+		return
+	}
+	if _, err := w.Write(newData); err != nil {
+		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, err)
+		return
+	}
+}
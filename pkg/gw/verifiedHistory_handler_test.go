@@ -0,0 +1,168 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	immuclient "github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/client/clienttest"
+	immugwclient "github.com/codenotary/immugw/pkg/client"
+	"github.com/codenotary/immugw/pkg/json"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/stretchr/testify/require"
+)
+
+func testVerifiedHistoryHandler(t *testing.T, mux *runtime.ServeMux, client immugwclient.Client, opts *immuclient.Options) {
+	prefixPattern := "VerifiedHistoryHandler - Test case: %s"
+	method := "POST"
+	path := "/db/defaultdb/verified/history"
+	for _, tc := range verifiedHistoryHandlerTestCases(t, mux, client, opts) {
+		handlerFunc := func(res http.ResponseWriter, req *http.Request) {
+			tc.verifiedHistoryHandler.VerifiedHistory(res, req, defaultTestParams)
+		}
+		err := testHandler(
+			t,
+			fmt.Sprintf(prefixPattern, tc.name),
+			method,
+			path,
+			tc.payload,
+			handlerFunc,
+			tc.testFunc,
+		)
+		require.NoError(t, err)
+	}
+}
+
+type verifiedHistoryHandlerTestCase struct {
+	name                   string
+	verifiedHistoryHandler VerifiedHistoryHandler
+	payload                string
+	testFunc               func(*testing.T, string, int, map[string]interface{})
+}
+
+func verifiedHistoryHandlerTestCases(t *testing.T, mux *runtime.ServeMux, client immugwclient.Client, opts *immuclient.Options) []verifiedHistoryHandlerTestCase {
+	rt := newDefaultRuntime()
+	defaultJSON := json.DefaultJSON()
+	vhh := NewVerifiedHistoryHandler(mux, client, rt, defaultJSON)
+	icd, _ := client.For("defaultdb")
+
+	key := []byte("verifiedHistoryKey1")
+	for _, v := range []string{"val1", "val2", "val3"} {
+		_, err := icd.Set(context.Background(), key, []byte(v))
+		require.NoError(t, err)
+	}
+
+	_, err := icd.Delete(context.Background(), &schema.DeleteKeysRequest{Keys: [][]byte{key}})
+	require.NoError(t, err)
+
+	historyWErr := func(context.Context, *schema.HistoryRequest) (*schema.Entries, error) {
+		return nil, errors.New("history error")
+	}
+	historyTampered := func(ctx context.Context, req *schema.HistoryRequest) (*schema.Entries, error) {
+		entries, err := icd.History(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		entries.Entries[1].Value = []byte("tampered")
+		return entries, nil
+	}
+	historyMock := func(historyF func(context.Context, *schema.HistoryRequest) (*schema.Entries, error)) immuclient.ImmuClient {
+		return &clienttest.ImmuClientMock{
+			ImmuClient:      icd,
+			HistoryF:        historyF,
+			CurrentStateF:   icd.CurrentState,
+			VerifiedTxByIDF: icd.VerifiedTxByID,
+		}
+	}
+	validPayload := fmt.Sprintf(`{"key": "%s"}`, base64.StdEncoding.EncodeToString(key))
+
+	return []verifiedHistoryHandlerTestCase{
+		{
+			"Sending correct request",
+			vhh,
+			validPayload,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusOK, status)
+				requireResponseFields(t, testCase, []string{"entries", "verifiedState"}, body)
+				entries := body["entries"].([]interface{})
+				require.Len(t, entries, 4, "%sexpected 4 revisions in response %v", testCase, body)
+			},
+		},
+		{
+			"Sending paginated request",
+			vhh,
+			fmt.Sprintf(`{"key": "%s", "offset": 1, "limit": 1, "desc": true}`, base64.StdEncoding.EncodeToString(key)),
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusOK, status)
+				entries := body["entries"].([]interface{})
+				require.Len(t, entries, 1, "%sexpected 1 revision in response %v", testCase, body)
+			},
+		},
+		{
+			"Sending correct request with non-existent key",
+			vhh,
+			fmt.Sprintf(`{"key": "%s"}`, base64.StdEncoding.EncodeToString([]byte("verifiedHistoryNonExistentKey1"))),
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusNotFound, status)
+			},
+		},
+		{
+			"AnnotateContext error",
+			NewVerifiedHistoryHandler(mux, client, newTestRuntimeWithAnnotateContextErr(), defaultJSON),
+			validPayload,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusInternalServerError, status)
+				requireResponseFieldsEqual(
+					t, testCase, map[string]interface{}{"error": "annotate context error"}, body)
+			},
+		},
+		{
+			"History error",
+			NewVerifiedHistoryHandler(mux, immugwclient.NewMockClient(historyMock(historyWErr), opts), rt, defaultJSON),
+			validPayload,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusInternalServerError, status)
+				requireResponseFieldsEqual(
+					t, testCase, map[string]interface{}{"error": "history error"}, body)
+			},
+		},
+		{
+			"Tampered revision",
+			NewVerifiedHistoryHandler(mux, immugwclient.NewMockClient(historyMock(historyTampered), opts), rt, defaultJSON),
+			validPayload,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusConflict, status)
+			},
+		},
+		{
+			"JSON marshal error",
+			NewVerifiedHistoryHandler(mux, client, rt, newTestJSONWithMarshalErr()),
+			validPayload,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusInternalServerError, status)
+				requireResponseFieldsEqual(
+					t, testCase, map[string]interface{}{"error": "JSON marshal error"}, body)
+			},
+		},
+	}
+}
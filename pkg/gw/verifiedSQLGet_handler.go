@@ -71,7 +71,7 @@ func (h *verifiedSQLGetHandler) VerifiedSQLGetHandler(w http.ResponseWriter, req
 		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, status.Errorf(codes.InvalidArgument, "missing parameter %s", "databaseName"))
 		return
 	}
-	client, err := h.client.For(databasename)
+	client, err := clientFor(h.client, req, databasename)
 	if err != nil {
 		h.runtime.HTTPError(rctx, h.mux, outboundMarshaler, w, req, err)
 		return
@@ -91,12 +91,16 @@ func (h *verifiedSQLGetHandler) VerifiedSQLGetHandler(w http.ResponseWriter, req
 		return
 	}
 
-	err = client.VerifyRow(rctx, protoReq.Row, protoReq.Table, protoReq.PkValues)
+	vctx, span := startVerificationSpan(withStateProof(rctx), databasename, "VerifiableSQLGet")
+	err = client.VerifyRow(vctx, protoReq.Row, protoReq.Table, protoReq.PkValues)
+	endSpan(span, err)
 	ctx = h.runtime.NewServerMetadataContext(ctx, metadata)
 	if err != nil {
+		verificationsFromContext(req.Context()).failed(vctx, databasename, "VerifiableSQLGet", nil, 0, err)
 		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, mapSdkError(err))
 		return
 	}
+	verificationsFromContext(req.Context()).verified(databasename, "VerifiableSQLGet", nil, 0, stateProofFromContext(vctx).verifiedTx())
 
 	w.Header().Set("Content-Type", "application/json")
 }
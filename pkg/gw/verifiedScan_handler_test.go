@@ -0,0 +1,171 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	immuclient "github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/client/clienttest"
+	immugwclient "github.com/codenotary/immugw/pkg/client"
+	"github.com/codenotary/immugw/pkg/json"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/stretchr/testify/require"
+)
+
+func testVerifiedScanHandler(t *testing.T, mux *runtime.ServeMux, client immugwclient.Client, opts *immuclient.Options) {
+	prefixPattern := "VerifiedScanHandler - Test case: %s"
+	method := "POST"
+	path := "/db/defaultdb/verified/scan"
+	for _, tc := range verifiedScanHandlerTestCases(mux, client, opts) {
+		handlerFunc := func(res http.ResponseWriter, req *http.Request) {
+			tc.verifiedScanHandler.VerifiedScan(res, req, defaultTestParams)
+		}
+		err := testHandler(
+			t,
+			fmt.Sprintf(prefixPattern, tc.name),
+			method,
+			path,
+			tc.payload,
+			handlerFunc,
+			tc.testFunc,
+		)
+		require.NoError(t, err)
+	}
+}
+
+type verifiedScanHandlerTestCase struct {
+	name                string
+	verifiedScanHandler VerifiedScanHandler
+	payload             string
+	testFunc            func(*testing.T, string, int, map[string]interface{})
+}
+
+func verifiedScanHandlerTestCases(mux *runtime.ServeMux, client immugwclient.Client, opts *immuclient.Options) []verifiedScanHandlerTestCase {
+	rt := newDefaultRuntime()
+	defaultJSON := json.DefaultJSON()
+	vsh := NewVerifiedScanHandler(mux, client, rt, defaultJSON)
+	icd, _ := client.For("defaultdb")
+	scanWErr := func(context.Context, *schema.ScanRequest) (*schema.Entries, error) {
+		return nil, errors.New("scan error")
+	}
+	scanTampered := func(ctx context.Context, req *schema.ScanRequest) (*schema.Entries, error) {
+		entries, err := icd.Scan(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		entries.Entries[0].Value = []byte("tampered")
+		return entries, nil
+	}
+	scanMock := func(scanF func(context.Context, *schema.ScanRequest) (*schema.Entries, error)) immuclient.ImmuClient {
+		return &clienttest.ImmuClientMock{
+			ImmuClient:      icd,
+			ScanF:           scanF,
+			CurrentStateF:   icd.CurrentState,
+			VerifiedTxByIDF: icd.VerifiedTxByID,
+		}
+	}
+	validPayload := `{"limit": 2}`
+
+	return []verifiedScanHandlerTestCase{
+		{
+			"Sending correct request",
+			vsh,
+			validPayload,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusOK, status)
+				requireResponseFields(t, testCase, []string{"entries", "verifiedState"}, body)
+				entries := body["entries"].([]interface{})
+				require.Len(t, entries, 2, "%sexpected 2 entries in response %v", testCase, body)
+				state := body["verifiedState"].(map[string]interface{})
+				require.NotEmpty(t, state["txHash"], "%sexpected verified state hash in response %v", testCase, body)
+			},
+		},
+		{
+			"Sending descending request",
+			vsh,
+			`{"limit": 1, "desc": true}`,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusOK, status)
+				entries := body["entries"].([]interface{})
+				require.Len(t, entries, 1, "%sexpected 1 entry in response %v", testCase, body)
+			},
+		},
+		{
+			"Sending request scanning a reference",
+			vsh,
+			`{"prefix": "c2FmZVJlZmVyZW5jZUtleTE=", "limit": 1}`,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusOK, status)
+				entries := body["entries"].([]interface{})
+				require.Len(t, entries, 1, "%sexpected 1 entry in response %v", testCase, body)
+				entry := entries[0].(map[string]interface{})
+				require.NotNil(t, entry["referencedBy"], "%sexpected a reference in response %v", testCase, body)
+			},
+		},
+		{
+			"Sending plain text instead of base64 encoded",
+			vsh,
+			`{"seekKey": "setKey1"}`,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusBadRequest, status)
+			},
+		},
+		{
+			"AnnotateContext error",
+			NewVerifiedScanHandler(mux, client, newTestRuntimeWithAnnotateContextErr(), defaultJSON),
+			validPayload,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusInternalServerError, status)
+				requireResponseFieldsEqual(
+					t, testCase, map[string]interface{}{"error": "annotate context error"}, body)
+			},
+		},
+		{
+			"Scan error",
+			NewVerifiedScanHandler(mux, immugwclient.NewMockClient(scanMock(scanWErr), opts), rt, defaultJSON),
+			validPayload,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusInternalServerError, status)
+				requireResponseFieldsEqual(
+					t, testCase, map[string]interface{}{"error": "scan error"}, body)
+			},
+		},
+		{
+			"Tampered scan entry",
+			NewVerifiedScanHandler(mux, immugwclient.NewMockClient(scanMock(scanTampered), opts), rt, defaultJSON),
+			validPayload,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusConflict, status)
+			},
+		},
+		{
+			"JSON marshal error",
+			NewVerifiedScanHandler(mux, client, rt, newTestJSONWithMarshalErr()),
+			validPayload,
+			func(t *testing.T, testCase string, status int, body map[string]interface{}) {
+				requireResponseStatus(t, testCase, http.StatusInternalServerError, status)
+				requireResponseFieldsEqual(
+					t, testCase, map[string]interface{}{"error": "JSON marshal error"}, body)
+			},
+		},
+	}
+}
@@ -68,7 +68,7 @@ func (h *safeReferenceHandler) SafeReference(w http.ResponseWriter, req *http.Re
 		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, status.Errorf(codes.InvalidArgument, "missing parameter %s", "databaseName"))
 		return
 	}
-	client, err := h.client.For(databasename)
+	client, err := clientFor(h.client, req, databasename)
 	if err != nil {
 		h.runtime.HTTPError(rctx, h.mux, outboundMarshaler, w, req, err)
 		return
@@ -90,12 +90,16 @@ func (h *safeReferenceHandler) SafeReference(w http.ResponseWriter, req *http.Re
 		h.runtime.HTTPError(rctx, h.mux, outboundMarshaler, w, req, status.Error(codes.InvalidArgument, "incorrect JSON payload"))
 		return
 	}
-	msg, err := client.VerifiedSetReferenceAt(rctx, protoReq.ReferenceRequest.Key, protoReq.ReferenceRequest.ReferencedKey, protoReq.ReferenceRequest.AtTx)
+	vctx, span := startVerificationSpan(withStateProof(rctx), databasename, "VerifiedSetReference")
+	msg, err := client.VerifiedSetReferenceAt(vctx, protoReq.ReferenceRequest.Key, protoReq.ReferenceRequest.ReferencedKey, protoReq.ReferenceRequest.AtTx)
+	endSpan(span, err)
 	ctx = h.runtime.NewServerMetadataContext(ctx, metadata)
 	if err != nil {
+		verificationsFromContext(req.Context()).failed(vctx, databasename, "VerifiedSetReference", protoReq.ReferenceRequest.Key, 0, err)
 		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, mapSdkError(err))
 		return
 	}
+	verificationsFromContext(req.Context()).verified(databasename, "VerifiedSetReference", protoReq.ReferenceRequest.Key, msg.GetId(), stateProofFromContext(vctx).verifiedTx())
 
 	ctx = h.runtime.NewServerMetadataContext(rctx, metadata)
 	w.Header().Set("Content-Type", "application/json")
@@ -68,7 +68,7 @@ func (h *verifiedSetHandler) VerifiedSet(w http.ResponseWriter, req *http.Reques
 		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, status.Errorf(codes.InvalidArgument, "missing parameter %s", "databaseName"))
 		return
 	}
-	client, err := h.client.For(databasename)
+	client, err := clientFor(h.client, req, databasename)
 	if err != nil {
 		h.runtime.HTTPError(rctx, h.mux, outboundMarshaler, w, req, err)
 		return
@@ -101,11 +101,15 @@ func (h *verifiedSetHandler) VerifiedSet(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	msg, err := client.VerifiedSet(rctx, protoReq.SetRequest.KVs[0].Key, protoReq.SetRequest.KVs[0].Value)
+	vctx, span := startVerificationSpan(withStateProof(rctx), databasename, "VerifiedSet")
+	msg, err := client.VerifiedSet(vctx, protoReq.SetRequest.KVs[0].Key, protoReq.SetRequest.KVs[0].Value)
+	endSpan(span, err)
 	if err != nil {
+		verificationsFromContext(req.Context()).failed(vctx, databasename, "VerifiedSet", protoReq.SetRequest.KVs[0].Key, 0, err)
 		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, mapSdkError(err))
 		return
 	}
+	verificationsFromContext(req.Context()).verified(databasename, "VerifiedSet", protoReq.SetRequest.KVs[0].Key, msg.GetId(), stateProofFromContext(vctx).verifiedTx())
 
 	ctx = h.runtime.NewServerMetadataContext(ctx, metadata)
 	w.Header().Set("Content-Type", "application/json")
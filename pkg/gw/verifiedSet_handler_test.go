@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/codenotary/immudb/embedded/store"
 	"github.com/codenotary/immudb/pkg/api/schema"
 	immuclient "github.com/codenotary/immudb/pkg/client"
 	"github.com/codenotary/immudb/pkg/client/clienttest"
@@ -69,7 +70,7 @@ func safeSetHandlerTestCases(mux *runtime.ServeMux, client immugwclient.Client,
 		return nil, errors.New("safeset error")
 	}
 	verifiedSetCorruptedDataErr := func(context.Context, []byte, []byte) (*schema.TxHeader, error) {
-		return nil, errors.New("data is corrupted")
+		return nil, store.ErrCorruptedData
 	}
 	validKey := base64.StdEncoding.EncodeToString([]byte("safeSetKey1"))
 	validValue := base64.StdEncoding.EncodeToString([]byte("safeSetValue1"))
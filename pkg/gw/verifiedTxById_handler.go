@@ -91,7 +91,7 @@ func (h *verifiedTxByIdHandler) VerifiedTxById(w http.ResponseWriter, req *http.
 		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, status.Errorf(codes.InvalidArgument, "missing parameter %s", "key"))
 		return
 	}
-	client, err := h.client.For(databasename)
+	client, err := clientFor(h.client, req, databasename)
 	if err != nil {
 		h.runtime.HTTPError(rctx, h.mux, outboundMarshaler, w, req, err)
 		return
@@ -105,12 +105,16 @@ func (h *verifiedTxByIdHandler) VerifiedTxById(w http.ResponseWriter, req *http.
 		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, status.Errorf(codes.InvalidArgument, "%v", err))
 	}
 
-	msg, err := client.VerifiedTxByID(rctx, protoReq.Tx)
+	vctx, span := startVerificationSpan(withStateProof(rctx), databasename, "VerifiedTxById")
+	msg, err := client.VerifiedTxByID(vctx, protoReq.Tx)
+	endSpan(span, err)
 	ctx = h.runtime.NewServerMetadataContext(ctx, metadata)
 	if err != nil {
+		verificationsFromContext(req.Context()).failed(vctx, databasename, "VerifiedTxById", nil, protoReq.Tx, err)
 		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, mapSdkError(err))
 		return
 	}
+	verificationsFromContext(req.Context()).verified(databasename, "VerifiedTxById", nil, msg.GetHeader().GetId(), stateProofFromContext(vctx).verifiedTx())
 
 	w.Header().Set("Content-Type", "application/json")
 	newData, err := h.json.Marshal(msg)
@@ -68,7 +68,7 @@ func (h *verifiedZaddHandler) VerifiedZadd(w http.ResponseWriter, req *http.Requ
 		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, status.Errorf(codes.InvalidArgument, "missing parameter %s", "key"))
 		return
 	}
-	client, err := h.client.For(databasename)
+	client, err := clientFor(h.client, req, databasename)
 	if err != nil {
 		h.runtime.HTTPError(rctx, h.mux, outboundMarshaler, w, req, err)
 		return
@@ -89,12 +89,16 @@ func (h *verifiedZaddHandler) VerifiedZadd(w http.ResponseWriter, req *http.Requ
 		h.runtime.HTTPError(rctx, h.mux, outboundMarshaler, w, req, status.Error(codes.InvalidArgument, "incorrect JSON payload"))
 		return
 	}
-	msg, err := client.VerifiedZAddAt(rctx, protoReq.ZAddRequest.Set, protoReq.ZAddRequest.Score, protoReq.ZAddRequest.Key, protoReq.ZAddRequest.AtTx)
+	vctx, span := startVerificationSpan(withStateProof(rctx), databasename, "VerifiedZAdd")
+	msg, err := client.VerifiedZAddAt(vctx, protoReq.ZAddRequest.Set, protoReq.ZAddRequest.Score, protoReq.ZAddRequest.Key, protoReq.ZAddRequest.AtTx)
+	endSpan(span, err)
 	ctx = h.runtime.NewServerMetadataContext(rctx, metadata)
 	if err != nil {
+		verificationsFromContext(req.Context()).failed(vctx, databasename, "VerifiedZAdd", protoReq.ZAddRequest.Set, 0, err)
 		h.runtime.HTTPError(ctx, h.mux, outboundMarshaler, w, req, mapSdkError(err))
 		return
 	}
+	verificationsFromContext(req.Context()).verified(databasename, "VerifiedZAdd", protoReq.ZAddRequest.Set, msg.GetId(), stateProofFromContext(vctx).verifiedTx())
 	w.Header().Set("Content-Type", "application/json")
 	newData, err := h.json.Marshal(msg)
 	if err != nil {
@@ -0,0 +1,200 @@
+/*
+Copyright 2022 CodeNotary, Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gw
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+
+	"github.com/codenotary/immudb/embedded/store"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	immuclient "github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/database"
+)
+
+// verifyEntries proves every entry against a single state of the database.
+// The current server state is first checked with a dual proof against the state
+// held locally by the client, then the inclusion of each entry in its tx and
+// the consistency of that tx with the state are proven, the entry being
+// hashed from the content returned by the server.
+func verifyEntries(ctx context.Context, client immuclient.ImmuClient, entries []*schema.Entry) (*schema.ImmutableState, error) {
+	state, err := verifiedState(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if e.Tx > state.TxId || (e.ReferencedBy != nil && e.ReferencedBy.Tx > state.TxId) {
+			return nil, &verificationError{kind: VerificationInclusion, key: e.Key, tx: e.Tx, err: ErrCorruptedData}
+		}
+
+		if e.Metadata != nil && e.Metadata.Deleted {
+			if err := verifyDeletedEntry(ctx, client, state, e); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// both the reference and the entry it resolves to are proven
+		if ref := e.ReferencedBy; ref != nil {
+			entrySpec := database.EncodeReference(ref.Key, schema.KVMetadataFromProto(ref.Metadata), e.Key, ref.AtTx)
+			if err := verifyEntryAt(ctx, client, state, ref.Key, ref.Tx, entrySpec); err != nil {
+				return nil, err
+			}
+		}
+		entrySpec := database.EncodeEntrySpec(e.Key, schema.KVMetadataFromProto(e.Metadata), e.Value)
+		if err := verifyEntryAt(ctx, client, state, e.Key, e.Tx, entrySpec); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// verifyEntryAt proves that the entry spec of key is included in the tx
+// txID, not newer than state, with the proofs of a verifiable get.
+func verifyEntryAt(ctx context.Context, client immuclient.ImmuClient, state *schema.ImmutableState, key []byte, txID uint64, entrySpec *store.EntrySpec) error {
+	serviceClient := client.GetServiceClient()
+
+	vEntry, err := serviceClient.VerifiableGet(ctx, &schema.VerifiableGetRequest{
+		KeyRequest:   &schema.KeyRequest{Key: key, AtTx: txID},
+		ProveSinceTx: state.TxId,
+	})
+	if err != nil {
+		return err
+	}
+
+	dualProof := schema.DualProofFromProto(vEntry.VerifiableTx.DualProof)
+	err = schema.FillMissingLinearAdvanceProof(ctx, dualProof, txID, state.TxId, serviceClient)
+	if err != nil {
+		return err
+	}
+	sourceAlh := dualProof.SourceTxHeader.Alh()
+	if !store.VerifyDualProof(dualProof, txID, state.TxId, sourceAlh, schema.DigestFromProto(state.TxHash)) {
+		return &verificationError{kind: VerificationConsistency, key: key, tx: txID, err: ErrCorruptedData}
+	}
+
+	digest, err := entrySpecDigest(dualProof.SourceTxHeader.Version, entrySpec)
+	if err != nil {
+		return err
+	}
+	inclusionProof := schema.InclusionProofFromProto(vEntry.InclusionProof)
+	if !store.VerifyInclusion(inclusionProof, digest, dualProof.SourceTxHeader.Eh) {
+		return &verificationError{kind: VerificationInclusion, key: key, tx: txID, err: ErrCorruptedData}
+	}
+
+	return nil
+}
+
+// verifiedState returns the current server state once it has been checked
+// with a dual proof against the state held locally by the client.
+func verifiedState(ctx context.Context, client immuclient.ImmuClient) (*schema.ImmutableState, error) {
+	state, err := client.CurrentState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.TxId > 0 {
+		tx, err := client.VerifiedTxByID(ctx, state.TxId)
+		if err != nil {
+			if mapSdkError(err) == ErrCorruptedData {
+				return nil, &verificationError{kind: VerificationConsistency, tx: state.TxId, err: err}
+			}
+			return nil, err
+		}
+		alh := schema.TxHeaderFromProto(tx.Header).Alh()
+		if !bytes.Equal(alh[:], state.TxHash) {
+			return nil, &verificationError{kind: VerificationConsistency, tx: state.TxId, err: ErrCorruptedData}
+		}
+	}
+
+	return state, nil
+}
+
+// verifyDeletedEntry proves a deleted entry by rebuilding the whole tx it belongs
+// to, as immudb doesn't serve deleted revisions through verified gets.
+func verifyDeletedEntry(ctx context.Context, client immuclient.ImmuClient, state *schema.ImmutableState, e *schema.Entry) error {
+	// deletions are stored without any value
+	if len(e.Value) > 0 {
+		return &verificationError{kind: VerificationInclusion, key: e.Key, tx: e.Tx, err: ErrCorruptedData}
+	}
+	entrySpec := &store.EntrySpec{
+		Key:      database.EncodeKey(e.Key),
+		Metadata: schema.KVMetadataFromProto(e.Metadata),
+	}
+	return verifyTxEntry(ctx, client, state, e.Tx, e.Key, entrySpec)
+}
+
+// verifyTxEntry proves that the entry spec of key is included in the tx txID,
+// not newer than state, by rebuilding the whole tx.
+func verifyTxEntry(ctx context.Context, client immuclient.ImmuClient, state *schema.ImmutableState, txID uint64, key []byte, entrySpec *store.EntrySpec) error {
+	serviceClient := client.GetServiceClient()
+
+	vTx, err := serviceClient.VerifiableTxById(ctx, &schema.VerifiableTxRequest{
+		Tx:           txID,
+		ProveSinceTx: state.TxId,
+	})
+	if err != nil {
+		return err
+	}
+
+	dualProof := schema.DualProofFromProto(vTx.DualProof)
+	err = schema.FillMissingLinearAdvanceProof(ctx, dualProof, txID, state.TxId, serviceClient)
+	if err != nil {
+		return err
+	}
+	sourceAlh := dualProof.SourceTxHeader.Alh()
+	if !store.VerifyDualProof(dualProof, txID, state.TxId, sourceAlh, schema.DigestFromProto(state.TxHash)) {
+		return &verificationError{kind: VerificationConsistency, key: key, tx: txID, err: ErrCorruptedData}
+	}
+
+	// the hash tree is rebuilt from the returned entries, so the tx only
+	// matches the proven one if none of them has been altered
+	tx := schema.TxFromProto(vTx.Tx)
+	if tx.Header().Alh() != sourceAlh {
+		return &verificationError{kind: VerificationInclusion, key: key, tx: txID, err: ErrCorruptedData}
+	}
+
+	inclusionProof, err := tx.Proof(entrySpec.Key)
+	if err != nil {
+		return &verificationError{kind: VerificationInclusion, key: key, tx: txID, err: ErrCorruptedData}
+	}
+	digest, err := entrySpecDigest(tx.Header().Version, entrySpec)
+	if err != nil {
+		return err
+	}
+	if !store.VerifyInclusion(inclusionProof, digest, tx.Header().Eh) {
+		return &verificationError{kind: VerificationInclusion, key: key, tx: txID, err: ErrCorruptedData}
+	}
+
+	return nil
+}
+
+// entrySpecDigest returns the digest of the entry spec in a tx of version,
+// the value of the spec can be truncated to its hash.
+func entrySpecDigest(version int, entrySpec *store.EntrySpec) ([sha256.Size]byte, error) {
+	// the digest of the first version ignores the hash of truncated values
+	if version == 0 && entrySpec.IsValueTruncated {
+		return sha256.Sum256(append(append([]byte{}, entrySpec.Key...), entrySpec.HashValue[:]...)), nil
+	}
+	digest, err := store.EntrySpecDigestFor(version)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return digest(entrySpec), nil
+}